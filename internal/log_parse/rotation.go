@@ -0,0 +1,115 @@
+// Package log_parse contains the parsing of log file names and time zones shared by the nginx_log_file source and
+// the tables.
+package log_parse
+
+import (
+	"cmp"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// extensions added by logrotate when compressing rotated files
+var compressionExtensions = []string{".gz", ".bz2", ".zst", ".zstd"}
+
+// rotation suffixes added by logrotate, after any compression extension is removed:
+// - dateext, e.g. 'access.log-20241016', 'access.log-2024101612', 'access.log-20241016-1729080000' or 'access.log.2024-10-16'
+// - numbered, e.g. 'access.log.1'
+var (
+	dateSuffixRegex   = regexp.MustCompile(`^(.+?)[-.](\d{4})-?(\d{2})-?(\d{2})(?:-?(\d{2}))?(?:-(\d{9,}))?$`)
+	numberSuffixRegex = regexp.MustCompile(`^(.+)\.(\d+)$`)
+)
+
+// RotatedName describes a log file name in terms of the logrotate naming schemes
+type RotatedName struct {
+	// the path of the log file this was rotated from, e.g. '/var/log/nginx/access.log'
+	Base string
+	// the rotation number, for numbered rotation (1 is the most recent), or 0
+	Index int
+	// the rotation date, for dateext rotation, or zero
+	Date time.Time
+	// the compression extension, if any, e.g. '.gz'
+	Extension string
+}
+
+// ParseRotatedName parses a log file path, recognising numbered and dateext rotation and compression extensions
+func ParseRotatedName(path string) RotatedName {
+	dir, name := filepath.Split(path)
+	var res RotatedName
+
+	for _, ext := range compressionExtensions {
+		if trimmed, ok := strings.CutSuffix(name, ext); ok && trimmed != "" {
+			res.Extension = ext
+			name = trimmed
+			break
+		}
+	}
+
+	if match := dateSuffixRegex.FindStringSubmatch(name); match != nil {
+		if date, ok := rotationDate(match[2:]); ok {
+			res.Base = dir + match[1]
+			res.Date = date
+			return res
+		}
+	}
+	if match := numberSuffixRegex.FindStringSubmatch(name); match != nil {
+		if index, err := strconv.Atoi(match[2]); err == nil && index > 0 {
+			res.Base = dir + match[1]
+			res.Index = index
+			return res
+		}
+	}
+
+	res.Base = dir + name
+	return res
+}
+
+// IsRotated returns whether the name has a rotation suffix, i.e. it is not the live log file
+func (n RotatedName) IsRotated() bool {
+	return n.Index > 0 || !n.Date.IsZero()
+}
+
+// CompareRotatedNames orders log files chronologically within each base, oldest first:
+// dated files by date, then numbered files from the highest number, then the live log file
+func CompareRotatedNames(a, b RotatedName) int {
+	rank := func(n RotatedName) int {
+		switch {
+		case !n.Date.IsZero():
+			return 0
+		case n.Index > 0:
+			return 1
+		default:
+			return 2
+		}
+	}
+	return cmp.Or(
+		cmp.Compare(a.Base, b.Base),
+		cmp.Compare(rank(a), rank(b)),
+		a.Date.Compare(b.Date),
+		cmp.Compare(b.Index, a.Index),
+	)
+}
+
+// rotationDate parses the year, month, day, hour and unix time captured from a dateext suffix
+func rotationDate(parts []string) (time.Time, bool) {
+	if parts[4] != "" {
+		secs, err := strconv.ParseInt(parts[4], 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(secs, 0).UTC(), true
+	}
+	value := parts[0] + parts[1] + parts[2]
+	layout := "20060102"
+	if parts[3] != "" {
+		value += parts[3]
+		layout += "15"
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
@@ -0,0 +1,64 @@
+package log_parse
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_ParseRotatedName(t *testing.T) {
+	tests := []struct {
+		path string
+		want RotatedName
+	}{
+		{"/var/log/nginx/access.log", RotatedName{Base: "/var/log/nginx/access.log"}},
+		{"/var/log/nginx/access.log.1", RotatedName{Base: "/var/log/nginx/access.log", Index: 1}},
+		{"/var/log/nginx/access.log.12.gz", RotatedName{Base: "/var/log/nginx/access.log", Index: 12, Extension: ".gz"}},
+		{"/var/log/nginx/error.log.2.bz2", RotatedName{Base: "/var/log/nginx/error.log", Index: 2, Extension: ".bz2"}},
+		{"access.log-20241016", RotatedName{Base: "access.log", Date: time.Date(2024, 10, 16, 0, 0, 0, 0, time.UTC)}},
+		{"access.log-20241016.zst", RotatedName{Base: "access.log", Date: time.Date(2024, 10, 16, 0, 0, 0, 0, time.UTC), Extension: ".zst"}},
+		{"access.log-2024101612.gz", RotatedName{Base: "access.log", Date: time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC), Extension: ".gz"}},
+		{"access.log-20241016-1729080000", RotatedName{Base: "access.log", Date: time.Unix(1729080000, 0).UTC()}},
+		{"access.log.2024-10-16", RotatedName{Base: "access.log", Date: time.Date(2024, 10, 16, 0, 0, 0, 0, time.UTC)}},
+		{"access-example.com.log-20241010.gz", RotatedName{Base: "access-example.com.log", Date: time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC), Extension: ".gz"}},
+		// not valid dates or rotation numbers
+		{"access.log-20241399", RotatedName{Base: "access.log-20241399"}},
+		{"access.log.0", RotatedName{Base: "access.log.0"}},
+		{".gz", RotatedName{Base: ".gz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := ParseRotatedName(tt.path)
+			if got.Base != tt.want.Base || got.Index != tt.want.Index || !got.Date.Equal(tt.want.Date) || got.Extension != tt.want.Extension {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_CompareRotatedNames(t *testing.T) {
+	paths := []string{
+		"access.log",
+		"error.log.1",
+		"access.log.1",
+		"access.log-20241016.gz",
+		"access.log.10.gz",
+		"access.log.2.gz",
+		"access.log-20241015.gz",
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		return CompareRotatedNames(ParseRotatedName(a), ParseRotatedName(b))
+	})
+	want := []string{
+		"access.log-20241015.gz",
+		"access.log-20241016.gz",
+		"access.log.10.gz",
+		"access.log.2.gz",
+		"access.log.1",
+		"access.log",
+		"error.log.1",
+	}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,47 @@
+package log_parse
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeZones caches the time zones parsed by ParseTimeZone, keyed by default_time_zone, as loading a named time
+// zone reads the time zone database
+var timeZones sync.Map
+
+// ParseTimeZone parses a default_time_zone, an IANA time zone name such as 'Europe/London' or a UTC offset such
+// as '+02:00', returning UTC if it is not set
+//
+// parsed time zones are cached, so it may be called for each row
+func ParseTimeZone(value string) (*time.Location, error) {
+	if value == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := timeZones.Load(value); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := parseTimeZone(value)
+	if err != nil {
+		return nil, err
+	}
+	timeZones.Store(value, loc)
+	return loc, nil
+}
+
+func parseTimeZone(value string) (*time.Location, error) {
+	if strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+		t, err := time.Parse("-07:00", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default_time_zone '%s': must be a time zone name such as 'Europe/London' or an offset such as '+02:00'", value)
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(value, offset), nil
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default_time_zone '%s': must be a time zone name such as 'Europe/London' or an offset such as '+02:00'", value)
+	}
+	return loc, nil
+}
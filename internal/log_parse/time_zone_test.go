@@ -0,0 +1,44 @@
+package log_parse
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseTimeZone(t *testing.T) {
+	loc, err := ParseTimeZone("")
+	if err != nil || loc != time.UTC {
+		t.Errorf("got %v, %v, want UTC for an empty time zone", loc, err)
+	}
+
+	loc, err = ParseTimeZone("-03:30")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, offset := time.Date(2024, 10, 10, 0, 0, 0, 0, loc).Zone(); offset != -(3*60*60 + 30*60) {
+		t.Errorf("got offset %d, want -12600", offset)
+	}
+
+	for _, value := range []string{"Not/AZone", "+25:00", "+0200"} {
+		if _, err := ParseTimeZone(value); err == nil {
+			t.Errorf("expected an error for '%s'", value)
+		}
+	}
+}
+
+func Test_ParseTimeZone_Cached(t *testing.T) {
+	first, err := ParseTimeZone("Europe/London")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := ParseTimeZone("Europe/London")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Error("expected the time zone to be loaded once and cached")
+	}
+	if _, err := ParseTimeZone("Not/AZone"); err == nil {
+		t.Error("expected an error for an invalid time zone parsed again")
+	}
+}
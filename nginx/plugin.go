@@ -1,8 +1,14 @@
 package nginx
 
 import (
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
 	"github.com/turbot/tailpipe-plugin-nginx/tables/access_log"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/error_log"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/modsecurity_audit_log"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/plus_api_snapshot"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/stub_status_snapshot"
 	"github.com/turbot/tailpipe-plugin-sdk/plugin"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
 	"github.com/turbot/tailpipe-plugin-sdk/table"
 )
 
@@ -12,6 +18,19 @@ func init() {
 	// Register the table, with type parameter:
 	// 1. table type
 	table.RegisterCustomTable[*access_log.AccessLogTable]()
+	table.RegisterCustomTable[*access_log.AccessLogRollupTable]()
+	table.RegisterCustomTable[*access_log.AccessSessionTable]()
+
+	// Register the static tables, with type parameters:
+	// 1. row struct
+	// 2. table type
+	table.RegisterTable[*error_log.ErrorLog, *error_log.ErrorLogTable]()
+	table.RegisterTable[*modsecurity_audit_log.ModSecurityAuditLog, *modsecurity_audit_log.ModSecurityAuditLogTable]()
+	table.RegisterTable[*plus_api_snapshot.PlusApiSnapshot, *plus_api_snapshot.PlusApiSnapshotTable]()
+	table.RegisterTable[*stub_status_snapshot.StubStatusSnapshot, *stub_status_snapshot.StubStatusSnapshotTable]()
+
+	// register sources
+	row_source.RegisterRowSource[*log_file.LogFileSource]()
 
 	// register formats
 	table.RegisterFormatPresets(access_log.AccessLogTableFormatPresets...)
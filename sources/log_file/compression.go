@@ -0,0 +1,61 @@
+package log_file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression types, detected from the file content rather than the extension
+const (
+	CompressionNone  = ""
+	CompressionGzip  = "gzip"
+	CompressionBzip2 = "bzip2"
+	CompressionZstd  = "zstd"
+)
+
+// detectCompression returns the compression type of a stream from its magic bytes
+func detectCompression(r *bufio.Reader) string {
+	// errors are ignored - a short stream is simply not compressed
+	header, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return CompressionGzip
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return CompressionBzip2
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// newDecompressingReader returns a reader for the decompressed content of r and the compression detected
+// the returned close func must be called when done, but does not close r
+func newDecompressingReader(r io.Reader) (io.Reader, string, func(), error) {
+	br := bufio.NewReader(r)
+	compression := detectCompression(br)
+	switch compression {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, compression, nil, fmt.Errorf("error creating gzip reader: %w", err)
+		}
+		return gz, compression, func() { gz.Close() }, nil
+	case CompressionBzip2:
+		return bzip2.NewReader(br), compression, func() {}, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, compression, nil, fmt.Errorf("error creating zstd reader: %w", err)
+		}
+		return zr, compression, zr.Close, nil
+	default:
+		return br, compression, func() {}, nil
+	}
+}
@@ -0,0 +1,61 @@
+package log_file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func Test_newDecompressingReader(t *testing.T) {
+	const content = "first line\nsecond line\n"
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, _ = gw.Write([]byte(content))
+	_ = gw.Close()
+
+	var zs bytes.Buffer
+	zw, _ := zstd.NewWriter(&zs)
+	_, _ = zw.Write([]byte(content))
+	_ = zw.Close()
+
+	bz, err := os.ReadFile("testdata/access.log.3.bz2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		data []byte
+		want string
+	}{
+		"plain":  {[]byte(content), CompressionNone},
+		"empty":  {nil, CompressionNone},
+		"gzip":   {gz.Bytes(), CompressionGzip},
+		"zstd":   {zs.Bytes(), CompressionZstd},
+		"bzip2":  {bz, CompressionBzip2},
+		"binary": {[]byte{0x1f}, CompressionNone},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, compression, closeReader, err := newDecompressingReader(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer closeReader()
+			if compression != tt.want {
+				t.Errorf("got compression %q, want %q", compression, tt.want)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.want != CompressionNone && string(got) != content {
+				t.Errorf("got content %q, want %q", got, content)
+			}
+		})
+	}
+}
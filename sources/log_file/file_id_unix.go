@@ -0,0 +1,18 @@
+//go:build unix
+
+package log_file
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns an identifier for the file which does not change when it is renamed - its device and inode
+func fileID(info fs.FileInfo) (string, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino), true
+}
@@ -0,0 +1,172 @@
+package log_file
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/collection_state"
+)
+
+// LogFileState is the collection state of a single log file
+type LogFileState struct {
+	// the path the file was last collected from - a file keeps its state when it is renamed or compressed
+	Path string `json:"path"`
+	// the number of bytes of (decompressed) content collected, always at the end of a line
+	Offset int64 `json:"offset"`
+
+	// the device and inode of the file, and its size and modification time when it was last collected
+	// these are used to skip files which have not changed without reading them
+	FileID  string    `json:"file_id,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitempty"`
+	// true if the file was collected as complete, i.e. rotated or compressed, so a final line without a newline
+	// was collected rather than held back
+	Complete bool `json:"complete,omitempty"`
+}
+
+// LogFileCollectionState records how much of each log file has been collected
+//
+// files are keyed by their base name and a fingerprint of their first line, rather than their path,
+// so a file which is rotated (renamed and/or compressed) is recognised and only content added since the
+// last collection is collected
+type LogFileCollectionState struct {
+	Files map[string]*LogFileState `json:"files"`
+	// the 'to' time of the last successful collection
+	LastCollectionTime time.Time `json:"last_collection_time,omitempty"`
+
+	// the keys of the files seen in this collection - files which are not seen are removed on completion
+	seen                map[string]struct{}
+	collectionTimeRange collection_state.DirectionalTimeRange
+	mut                 sync.Mutex
+}
+
+func NewLogFileCollectionState() collection_state.CollectionState {
+	return &LogFileCollectionState{
+		Files: make(map[string]*LogFileState),
+		seen:  make(map[string]struct{}),
+	}
+}
+
+func (s *LogFileCollectionState) Init(collectionTimeRange collection_state.DirectionalTimeRange, _ time.Duration) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.collectionTimeRange = collectionTimeRange
+	if s.Files == nil {
+		s.Files = make(map[string]*LogFileState)
+	}
+	s.seen = make(map[string]struct{})
+}
+
+func (s *LogFileCollectionState) IsEmpty() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return len(s.Files) == 0 && s.LastCollectionTime.IsZero()
+}
+
+// ShouldCollect implements collection_state.CollectionState
+// files are always opened, as GetOffset determines which part of a file to collect
+func (s *LogFileCollectionState) ShouldCollect(string, time.Time) bool {
+	return true
+}
+
+// OnCollected implements collection_state.CollectionState - SetFile is used to update the state
+func (s *LogFileCollectionState) OnCollected(string, time.Time) error {
+	return nil
+}
+
+func (s *LogFileCollectionState) GetFromTime() time.Time {
+	return time.Time{}
+}
+
+func (s *LogFileCollectionState) GetToTime() time.Time {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.LastCollectionTime
+}
+
+// GetOffset returns the collected offset for a file key and marks the file as seen
+func (s *LogFileCollectionState) GetOffset(key string) int64 {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.seen[key] = struct{}{}
+	if f, ok := s.Files[key]; ok {
+		return f.Offset
+	}
+	return 0
+}
+
+// SetFile records the state of a file key
+func (s *LogFileCollectionState) SetFile(key string, file *LogFileState) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.seen[key] = struct{}{}
+	s.Files[key] = file
+}
+
+// SkipUnchanged returns true, and marks the file as seen, if a file with the given identifier, size and
+// modification time has already been collected
+//
+// a live log file which has since been rotated is not skipped unless it was collected to the end, as a final
+// line without a newline was held back when it was collected, and is complete now the file has been rotated
+func (s *LogFileCollectionState) SkipUnchanged(fileID string, size int64, modTime time.Time, complete bool) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	for key, f := range s.Files {
+		if f.FileID == fileID && f.Size == size && f.ModTime.Equal(modTime) && (f.Complete || !complete || f.Offset == size) {
+			s.seen[key] = struct{}{}
+			return true
+		}
+	}
+	return false
+}
+
+// OnCollectionComplete removes the state of files which no longer exist and sets the last collection time
+func (s *LogFileCollectionState) OnCollectionComplete() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	// if no files were found, the paths may be temporarily unavailable, so keep the existing state
+	if len(s.seen) > 0 {
+		for key := range s.Files {
+			if _, ok := s.seen[key]; !ok {
+				delete(s.Files, key)
+			}
+		}
+	}
+	s.LastCollectionTime = s.collectionTimeRange.UpperBoundary
+	return nil
+}
+
+func (s *LogFileCollectionState) MigrateFromLegacyState([]byte) error {
+	return nil
+}
+
+func (s *LogFileCollectionState) Validate() error {
+	return nil
+}
+
+// Clear removes the state of all files, so they are collected again in full
+// offsets are not associated with times, so the whole state is cleared whatever the time range
+func (s *LogFileCollectionState) Clear(collection_state.DirectionalTimeRange) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.Files = make(map[string]*LogFileState)
+	s.LastCollectionTime = time.Time{}
+}
+
+// MarshalJSON locks the state, as it may be saved while a collection is updating it
+func (s *LogFileCollectionState) MarshalJSON() ([]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	type state LogFileCollectionState
+	return json.Marshal((*state)(s))
+}
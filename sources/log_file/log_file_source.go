@@ -0,0 +1,404 @@
+package log_file
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/context_values"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+const LogFileSourceIdentifier = "nginx_log_file"
+
+// HostnameMetadataKey is the source enrichment metadata key holding the hostname of the source, for tables which
+// identify the server that logged each row
+const HostnameMetadataKey = "hostname"
+
+// the maximum length of the first line used to fingerprint a file
+const fingerprintLength = 4096
+
+// the size of the chunks of lines passed to an extractor, which bounds the memory used to collect a large file
+const extractChunkSize = 16 * 1024 * 1024
+
+// LogFileSource is a source which collects nginx log files from the local file system, a line per row
+//
+// it understands the logrotate naming schemes, so the live log file and its rotated files are collected
+// oldest first, decompressed according to their content and, as files are identified by their content rather
+// than their path, rotating a file does not cause it to be collected again
+type LogFileSource struct {
+	row_source.RowSourceImpl[*LogFileSourceConfig, *artifact_source.EmptyConnection]
+
+	// if set, converts the lines collected from each file into rows, rather than collecting a row per line
+	extractor artifact_source.Extractor
+}
+
+// WithExtractor sets an extractor which converts the lines collected from each file into rows, e.g. to aggregate
+// them, rather than collecting a row per line
+// the extractor is passed the lines collected from a file in chunks of up to around 16 MiB, as the artifact
+// sources pass it the content of an artifact
+func WithExtractor(extractor artifact_source.Extractor) row_source.RowSourceOption {
+	return func(r row_source.RowSource) error {
+		if s, ok := r.(*LogFileSource); ok {
+			s.extractor = extractor
+		}
+		return nil
+	}
+}
+
+// RecordExtractor is implemented by an extractor whose records may span several lines, e.g. a native ModSecurity audit
+// log entry, so that a file is only split into chunks, and its offset only recorded, at the end of a record
+type RecordExtractor interface {
+	artifact_source.Extractor
+	// RecordEnd returns a function which is passed each line of a file in turn, from the start of a record, and
+	// returns true if the line ends a record
+	RecordEnd() func(line string) bool
+}
+
+func (s *LogFileSource) Init(ctx context.Context, params *row_source.RowSourceParams, opts ...row_source.RowSourceOption) error {
+	s.NewCollectionStateFunc = NewLogFileCollectionState
+	return s.RowSourceImpl.Init(ctx, params, opts...)
+}
+
+func (s *LogFileSource) Identifier() string {
+	return LogFileSourceIdentifier
+}
+
+func (s *LogFileSource) Description() (string, error) {
+	return "Collect nginx log files, including rotated and compressed files, from the local file system.", nil
+}
+
+func (s *LogFileSource) Collect(ctx context.Context) error {
+	state, ok := s.CollectionState.State.(*LogFileCollectionState)
+	if !ok {
+		return fmt.Errorf("unexpected collection state type %T", s.CollectionState.State)
+	}
+	executionId, err := context_values.ExecutionIdFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	files, err := discoverLogFiles(s.Config)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		metadata := map[string]string{
+			constants.TpSourceType:     LogFileSourceIdentifier,
+			constants.TpSourceLocation: file.path,
+		}
+		if s.Config.DefaultTimeZone != "" {
+			metadata[DefaultTimeZoneMetadataKey] = s.Config.DefaultTimeZone
+		}
+		if s.Config.Hostname != "" {
+			metadata[HostnameMetadataKey] = s.Config.Hostname
+		}
+		enrichment := schema.NewSourceEnrichment(metadata)
+		if err := s.collectFile(ctx, file, state, enrichment); err != nil {
+			// continue with the remaining files - the error count ensures the collection is not marked complete
+			slog.Error("Error collecting log file", "path", file.path, "error", err)
+			atomic.AddInt32(&s.ErrorCount, 1)
+			s.NotifyError(ctx, executionId, fmt.Errorf("%s: %w", file.path, err))
+		}
+	}
+	return nil
+}
+
+// collectFile collects the lines of a file not yet collected, a row per line, or as the rows returned by the
+// extractor if the source has one
+func (s *LogFileSource) collectFile(ctx context.Context, file logFile, state *LogFileCollectionState, enrichment *schema.SourceEnrichment) error {
+	if s.extractor == nil {
+		return collectLogFile(file, state, func(line string) error {
+			return s.OnRow(ctx, &types.RowData{Data: line, SourceEnrichment: enrichment})
+		})
+	}
+
+	// the extractor parses the times of the lines itself, so is passed the source's time zone
+	extractCtx := ctx
+	if name := enrichment.Metadata[DefaultTimeZoneMetadataKey]; name != "" {
+		timeZone, err := log_parse.ParseTimeZone(name)
+		if err != nil {
+			return err
+		}
+		extractCtx = WithTimeZone(ctx, timeZone)
+	}
+
+	// the lines are extracted in chunks, so a large file is not held in memory, and the offset of a chunk is only
+	// recorded once its rows have been extracted and collected
+	// a chunk whose rows fail part way through is extracted again by the next collection
+	var recordEnd func(string) bool
+	if r, ok := s.extractor.(RecordExtractor); ok {
+		recordEnd = r.RecordEnd()
+	}
+	key, fileState, err := readLogFile(file, state, extractChunkSize, recordEnd, func(lines []string) error {
+		rows, err := s.extractor.Extract(extractCtx, []byte(strings.Join(lines, "\n")+"\n"))
+		if err != nil {
+			return fmt.Errorf("error extracting rows: %w", err)
+		}
+		for _, row := range rows {
+			if err := s.OnRow(ctx, &types.RowData{Data: row, SourceEnrichment: enrichment}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if fileState != nil {
+		state.SetFile(key, fileState)
+	}
+	return err
+}
+
+// logFile is a log file discovered by the source
+type logFile struct {
+	path string
+	name log_parse.RotatedName
+}
+
+// discoverLogFiles returns the files matching the config, ordered chronologically within each base name
+func discoverLogFiles(config *LogFileSourceConfig) ([]logFile, error) {
+	var paths []string
+	for _, p := range config.Paths {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path '%s': %w", p, err)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				paths = append(paths, match)
+				continue
+			}
+			entries, err := os.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					paths = append(paths, filepath.Join(match, entry.Name()))
+				}
+			}
+		}
+	}
+
+	var res []logFile
+	for _, path := range paths {
+		if slices.ContainsFunc(res, func(f logFile) bool { return f.path == path }) {
+			continue
+		}
+		name := log_parse.ParseRotatedName(path)
+		if !matchesBaseNames(config.BaseNames, filepath.Base(name.Base)) {
+			continue
+		}
+		res = append(res, logFile{path: path, name: name})
+	}
+
+	slices.SortFunc(res, func(a, b logFile) int {
+		if c := log_parse.CompareRotatedNames(a.name, b.name); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.path, b.path)
+	})
+	return res, nil
+}
+
+func matchesBaseNames(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		// patterns are validated with the config
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+	}
+	return false
+}
+
+// collectLogFile passes each line of the file which has not already been collected to emit, and updates the state
+//
+// the offset recorded is the end of the last line emitted without error, so a line which fails is collected again
+func collectLogFile(file logFile, state *LogFileCollectionState, emit func(string) error) error {
+	key, fileState, err := readLogFile(file, state, 0, nil, func(lines []string) error {
+		for _, line := range lines {
+			if err := emit(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if fileState != nil {
+		state.SetFile(key, fileState)
+	}
+	return err
+}
+
+// readLogFile passes the lines of the file which have not already been collected to emit, in chunks of at least
+// chunkSize bytes, or a line at a time if chunkSize is 0, and returns the state of the file to record, keyed by the
+// returned key, or nil if there is nothing to record
+//
+// if recordEnd is set, chunks end at the end of a record, i.e. a line for which recordEnd returns true, and the
+// lines of a record the live log file does not yet end are left for the next collection
+//
+// the state is not recorded, so the caller can record it once the emitted lines have been processed - its offset is
+// the end of the last chunk emitted without error, so lines are never recorded as collected before they are processed
+//
+// only complete lines are collected from the live log file, as nginx may be part way through writing the last line
+// - the live log file is read from the offset collected so far, and files which have not changed since they were
+// last collected are skipped without being read, so frequent collections of a large log file are cheap
+func readLogFile(file logFile, state *LogFileCollectionState, chunkSize int, recordEnd func(string) bool, emit func([]string) error) (key string, fileState *LogFileState, err error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	id, hasID := fileID(info)
+	// compressing a file writes a new file, so only the name is needed to tell whether a file may be skipped
+	if hasID && state.SkipUnchanged(id, info.Size(), info.ModTime(), file.name.IsRotated()) {
+		return "", nil, nil
+	}
+
+	r, compression, closeReader, err := newDecompressingReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	defer closeReader()
+	// rotated and compressed files are no longer written to, so a final line without a newline is complete
+	complete := file.name.IsRotated() || compression != CompressionNone
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	// offset is the end of the last line read, ended the end of the last record read, and committed the end of the
+	// last record emitted
+	var offset, ended, collected, committed int64
+	// the lines read and not yet emitted, of which the first endedLines, of endedBytes bytes, end a record
+	var chunk []string
+	var endedLines, endedBytes, pendingBytes int
+	// flush emits the lines of the records read, or all of the lines read if all is set
+	flush := func(all bool) error {
+		lines, to := endedLines, ended
+		if all {
+			lines, to = len(chunk), offset
+		}
+		if lines > 0 {
+			if err := emit(chunk[:lines]); err != nil {
+				return err
+			}
+			chunk = slices.Clone(chunk[lines:])
+		}
+		if all {
+			pendingBytes = 0
+		}
+		endedLines, endedBytes = 0, 0
+		committed = max(to, collected)
+		return nil
+	}
+	// record the progress however the collection ends
+	defer func() {
+		if key == "" {
+			return
+		}
+		fileState = &LogFileState{Path: file.path, Offset: committed}
+		// the file is only skipped next time if it was collected to the end
+		if err == nil && hasID {
+			fileState.FileID = id
+			fileState.Size = info.Size()
+			fileState.ModTime = info.ModTime()
+			fileState.Complete = complete
+		}
+	}()
+
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return key, nil, readErr
+		}
+		if len(line) == 0 || (errors.Is(readErr, io.EOF) && !complete) {
+			break
+		}
+
+		// the file is identified by its first line
+		if key == "" {
+			key = fileKey(file.name.Base, line)
+			collected = state.GetOffset(key)
+			committed = collected
+
+			if compression == CompressionNone {
+				// a file which is smaller than the collected offset has been truncated in place (e.g. by
+				// logrotate copytruncate) and rewritten, so it is collected from the start
+				if collected > info.Size() {
+					slog.Info("Log file truncated, collecting from the start", "path", file.path, "offset", collected, "size", info.Size())
+					collected, committed = 0, 0
+				}
+				// skip the content already collected
+				if collected > int64(len(line)) {
+					if _, err := f.Seek(collected, io.SeekStart); err != nil {
+						return key, nil, err
+					}
+					br.Reset(f)
+					offset = collected
+					continue
+				}
+			}
+		}
+
+		end := offset + int64(len(line))
+		offset = end
+		if end <= collected {
+			ended = end
+		} else {
+			text := string(bytes.TrimRight(line, "\r\n"))
+			if text != "" {
+				chunk = append(chunk, text)
+				pendingBytes += len(line)
+			}
+			if recordEnd == nil || (text != "" && recordEnd(text)) {
+				ended, endedLines = end, len(chunk)
+				endedBytes, pendingBytes = endedBytes+pendingBytes, 0
+			}
+		}
+		if (endedLines > 0 && endedBytes >= chunkSize) || len(chunk) == 0 {
+			if err := flush(false); err != nil {
+				return key, nil, err
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+	// a rotated or compressed file is no longer written to, so its last record is complete, whether or not it ends
+	return key, nil, flush(complete)
+}
+
+// fileKey returns the state key for a file, from its base name and a fingerprint of its first line
+func fileKey(base string, firstLine []byte) string {
+	hash := sha256.Sum256(firstLine[:min(len(firstLine), fingerprintLength)])
+	return base + "#" + hex.EncodeToString(hash[:16])
+}
@@ -0,0 +1,41 @@
+package log_file
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+)
+
+// LogFileSourceConfig is the configuration for a LogFileSource
+type LogFileSourceConfig struct {
+	// the log files to collect - each path may be a file, a directory or a glob pattern
+	Paths []string `hcl:"paths"`
+	// glob patterns matched against file names with any rotation and compression suffix removed, e.g. 'access.log'
+	BaseNames []string `hcl:"base_names,optional"`
+	// the time zone of times logged without an offset, i.e. by the error log, e.g. 'Europe/London' or '+02:00'
+	// (defaults to UTC)
+	DefaultTimeZone string `hcl:"default_time_zone,optional"`
+	// the hostname of the nginx server that wrote the log files, which identifies the server in the connection and
+	// request keys if it is not logged
+	Hostname string `hcl:"hostname,optional"`
+}
+
+func (c *LogFileSourceConfig) Validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("paths must be specified")
+	}
+	for _, pattern := range c.BaseNames {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid base_names pattern '%s': %w", pattern, err)
+		}
+	}
+	if _, err := log_parse.ParseTimeZone(c.DefaultTimeZone); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *LogFileSourceConfig) Identifier() string {
+	return LogFileSourceIdentifier
+}
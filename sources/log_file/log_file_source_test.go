@@ -0,0 +1,429 @@
+package log_file
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-sdk/collection_state"
+	"github.com/turbot/tailpipe-plugin-sdk/context_values"
+	"github.com/turbot/tailpipe-plugin-sdk/events"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+func Test_collectLogFile_rotation(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "access.log")
+	state := newTestState()
+
+	collect := func() []string {
+		t.Helper()
+		files, err := discoverLogFiles(&LogFileSourceConfig{Paths: []string{dir}, BaseNames: []string{"access.log"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var lines []string
+		for _, file := range files {
+			if err := collectLogFile(file, state, func(line string) error {
+				lines = append(lines, line)
+				return nil
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		return lines
+	}
+
+	// the last line is still being written, so is not collected
+	writeFile(t, live, "line 1\nline 2\nline 3 (partial")
+	writeFile(t, filepath.Join(dir, "error.log"), "not an access log line\n")
+	assertLines(t, collect(), "line 1", "line 2")
+
+	// the partial line is completed and a line added
+	appendFile(t, live, ")\nline 4\n")
+	assertLines(t, collect(), "line 3 (partial)", "line 4")
+
+	// logrotate renames the file and nginx writes more lines to it before reopening its logs
+	if err := os.Rename(live, live+".1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	appendFile(t, live+".1", "line 5\n")
+	writeFile(t, live, "line 6\n")
+	assertLines(t, collect(), "line 5", "line 6")
+
+	// the rotated file is compressed on the next rotation
+	gzipFile(t, live+".1", live+".2.gz")
+	if err := os.Rename(live, live+".1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writeFile(t, live, "line 7\n")
+	assertLines(t, collect(), "line 7")
+
+	// clearing the state collects everything again, oldest first
+	state.Clear(collection_state.DirectionalTimeRange{})
+	assertLines(t, collect(), "line 1", "line 2", "line 3 (partial)", "line 4", "line 5", "line 6", "line 7")
+}
+
+func Test_collectLogFile_rotation_partialLine(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "access.log")
+	state := newTestState()
+
+	collect := func() []string {
+		t.Helper()
+		files, err := discoverLogFiles(&LogFileSourceConfig{Paths: []string{dir}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var lines []string
+		for _, file := range files {
+			if err := collectLogFile(file, state, func(line string) error {
+				lines = append(lines, line)
+				return nil
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		return lines
+	}
+
+	// the last line has no newline, so is held back while the file is live
+	writeFile(t, live, "line 1\nline 2 (partial")
+	assertLines(t, collect(), "line 1")
+	assertLines(t, collect())
+
+	// logrotate renames the file without it being written to, so it is unchanged apart from its name,
+	// and nginx never completes the last line
+	if err := os.Rename(live, live+".1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertLines(t, collect(), "line 2 (partial")
+
+	// the rotated file has now been collected to the end
+	assertLines(t, collect())
+}
+
+func Test_collectLogFile_tailing(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "access.log")
+	file := logFile{path: live, name: log_parse.ParseRotatedName(live)}
+	state := newTestState()
+
+	collect := func() []string {
+		t.Helper()
+		var lines []string
+		if err := collectLogFile(file, state, func(line string) error {
+			lines = append(lines, line)
+			return nil
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return lines
+	}
+
+	writeFile(t, live, "line 1\nline 2\n")
+	assertLines(t, collect(), "line 1", "line 2")
+
+	// only lines appended since the last collection are collected
+	appendFile(t, live, "line 3\n")
+	assertLines(t, collect(), "line 3")
+
+	// the file is truncated in place (logrotate copytruncate) and rewritten
+	writeFile(t, live, "line 1\n")
+	assertLines(t, collect(), "line 1")
+	appendFile(t, live, "line 4\n")
+	assertLines(t, collect(), "line 4")
+}
+
+func Test_collectLogFile_unchanged(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "access.log")
+	writeFile(t, live, "line 1\nline 2\n")
+	info, err := os.Stat(live)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	id, ok := fileID(info)
+	if !ok {
+		t.Skip("file identifiers are not supported on this platform")
+	}
+
+	// the file is recorded as unchanged, so is not read, even though no lines have been collected
+	state := newTestState()
+	state.SetFile("key", &LogFileState{Path: live, FileID: id, Size: info.Size(), ModTime: info.ModTime()})
+	var lines []string
+	if err := collectLogFile(logFile{path: live, name: log_parse.ParseRotatedName(live)}, state, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertLines(t, lines)
+}
+
+// lineCountExtractor is an extractor which returns a single row, the lines it is passed
+type lineCountExtractor struct{}
+
+func (e *lineCountExtractor) Identifier() string {
+	return "line_count_extractor"
+}
+
+func (e *lineCountExtractor) Extract(_ context.Context, a any) ([]any, error) {
+	return []any{strings.Split(strings.TrimSuffix(string(a.([]byte)), "\n"), "\n")}, nil
+}
+
+// rowObserver records the rows extracted by a source
+type rowObserver struct {
+	rows []any
+	// if set, the observer fails to process rows
+	err error
+}
+
+func (o *rowObserver) Notify(_ context.Context, e events.Event) error {
+	if row, ok := e.(*events.RowExtracted); ok {
+		if o.err != nil {
+			return o.err
+		}
+		o.rows = append(o.rows, row.Row)
+	}
+	return nil
+}
+
+func Test_LogFileSource_collectFile_extractor(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "access.log")
+	file := logFile{path: live, name: log_parse.ParseRotatedName(live)}
+	state := newTestState()
+	ctx := context_values.WithExecutionId(context.Background(), "test")
+
+	source := &LogFileSource{}
+	if err := WithExtractor(&lineCountExtractor{})(source); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	observer := &rowObserver{}
+	if err := source.AddObserver(observer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	collect := func() []any {
+		t.Helper()
+		observer.rows = nil
+		if err := source.collectFile(ctx, file, state, schema.NewSourceEnrichment(nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return observer.rows
+	}
+
+	// the lines collected from the file are passed to the extractor together
+	writeFile(t, live, "line 1\nline 2\nline 3 (partial")
+	if got := collect(); len(got) != 1 || !slices.Equal(got[0].([]string), []string{"line 1", "line 2"}) {
+		t.Errorf("got rows %q, want a row of the complete lines", got)
+	}
+
+	// only lines added since the last collection are extracted, and nothing is extracted if there are none
+	appendFile(t, live, ")\n")
+	if got := collect(); len(got) != 1 || !slices.Equal(got[0].([]string), []string{"line 3 (partial)"}) {
+		t.Errorf("got rows %q, want a row of the new line", got)
+	}
+	if got := collect(); len(got) != 0 {
+		t.Errorf("got rows %q, want none", got)
+	}
+}
+
+func Test_LogFileSource_collectFile_rowError(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "access.log")
+	file := logFile{path: live, name: log_parse.ParseRotatedName(live)}
+	key := fileKey(file.name.Base, []byte("line 1\n"))
+	ctx := context_values.WithExecutionId(context.Background(), "test")
+	writeFile(t, live, "line 1\nline 2\n")
+
+	for name, extractor := range map[string]*lineCountExtractor{"Row per line": nil, "Extractor": {}} {
+		t.Run(name, func(t *testing.T) {
+			state := newTestState()
+			source := &LogFileSource{}
+			if extractor != nil {
+				if err := WithExtractor(extractor)(source); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			observer := &rowObserver{err: errors.New("row failed")}
+			if err := source.AddObserver(observer); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the rows are not collected, so the offset does not move
+			if err := source.collectFile(ctx, file, state, schema.NewSourceEnrichment(nil)); err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := state.GetOffset(key); got != 0 {
+				t.Errorf("got offset %d after a failed row, want 0", got)
+			}
+
+			// the lines are collected by the next collection
+			observer.err = nil
+			if err := source.collectFile(ctx, file, state, schema.NewSourceEnrichment(nil)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(observer.rows) == 0 {
+				t.Error("got no rows, want the lines to be collected again")
+			}
+			if got, want := state.GetOffset(key), int64(len("line 1\nline 2\n")); got != want {
+				t.Errorf("got offset %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func Test_readLogFile_chunks(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "access.log")
+	file := logFile{path: live, name: log_parse.ParseRotatedName(live)}
+	writeFile(t, live, "line 1\nline 2\nline 3\nline 4\nline 5\n")
+
+	// the lines are emitted in chunks of at least the chunk size, and the offset is the end of the last chunk
+	// emitted without error
+	var chunks [][]string
+	_, fileState, err := readLogFile(file, newTestState(), len("line 1\nline 2\n"), nil, func(lines []string) error {
+		if len(chunks) == 2 {
+			return errors.New("chunk failed")
+		}
+		chunks = append(chunks, lines)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(chunks) != 2 || !slices.Equal(chunks[0], []string{"line 1", "line 2"}) || !slices.Equal(chunks[1], []string{"line 3", "line 4"}) {
+		t.Errorf("got chunks %q, want two chunks of two lines", chunks)
+	}
+	if want := int64(len("line 1\nline 2\nline 3\nline 4\n")); fileState == nil || fileState.Offset != want || fileState.Complete {
+		t.Errorf("got state %+v, want an incomplete state with offset %d", fileState, want)
+	}
+}
+
+func Test_readLogFile_records(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "audit.log")
+	file := logFile{path: live, name: log_parse.ParseRotatedName(live)}
+	writeFile(t, live, "a1\na2\nEND\nb1\nEND\nc1\n")
+	recordEnd := func(line string) bool { return line == "END" }
+
+	// chunks end at the end of a record, and the record the live log file does not yet end is not collected
+	state := newTestState()
+	var chunks [][]string
+	read := func() {
+		t.Helper()
+		key, fileState, err := readLogFile(file, state, 1, recordEnd, func(lines []string) error {
+			chunks = append(chunks, lines)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		state.SetFile(key, fileState)
+	}
+	read()
+	if want := [][]string{{"a1", "a2", "END"}, {"b1", "END"}}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("got chunks %q, want %q", chunks, want)
+	}
+
+	// the record is collected once it ends
+	chunks = nil
+	appendFile(t, live, "END\n")
+	read()
+	if want := [][]string{{"c1", "END"}}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("got chunks %q, want %q", chunks, want)
+	}
+}
+
+func Test_LogFileCollectionState_OnCollectionComplete(t *testing.T) {
+	state := newTestState()
+	state.SetFile("a", &LogFileState{Path: "/logs/a", Offset: 10})
+	state.SetFile("b", &LogFileState{Path: "/logs/b", Offset: 20})
+	if err := state.OnCollectionComplete(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// files which are not seen in a collection are removed
+	to := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	state.Init(collection_state.DirectionalTimeRange{UpperBoundary: to}, 0)
+	if got := state.GetOffset("a"); got != 10 {
+		t.Errorf("got offset %d, want 10", got)
+	}
+	if err := state.OnCollectionComplete(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := state.Files["b"]; ok {
+		t.Error("expected the state of an unseen file to be removed")
+	}
+	if !state.GetToTime().Equal(to) {
+		t.Errorf("got to time %v, want %v", state.GetToTime(), to)
+	}
+
+	// unless no files were seen
+	state.Init(collection_state.DirectionalTimeRange{UpperBoundary: to}, 0)
+	if err := state.OnCollectionComplete(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := state.Files["a"]; !ok {
+		t.Error("expected the state to be kept when no files were seen")
+	}
+}
+
+func newTestState() *LogFileCollectionState {
+	state := NewLogFileCollectionState().(*LogFileCollectionState)
+	state.Init(collection_state.DirectionalTimeRange{}, 0)
+	return state
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func appendFile(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// gzipFile compresses src to dst and removes src, as logrotate does
+func gzipFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	w := gzip.NewWriter(f)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.Remove(src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func assertLines(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package log_file
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeZoneMetadataKey is the source enrichment metadata key holding the default_time_zone of the source,
+// for tables which parse times logged without an offset
+const DefaultTimeZoneMetadataKey = "default_time_zone"
+
+type timeZoneContextKey struct{}
+
+// WithTimeZone returns a context holding the default_time_zone of the source, which is passed to the extractor
+// so it can parse times logged without an offset
+func WithTimeZone(ctx context.Context, timeZone *time.Location) context.Context {
+	return context.WithValue(ctx, timeZoneContextKey{}, timeZone)
+}
+
+// TimeZoneFromContext returns the default_time_zone of the source an extractor was called by, if it is set
+func TimeZoneFromContext(ctx context.Context) (*time.Location, bool) {
+	timeZone, ok := ctx.Value(timeZoneContextKey{}).(*time.Location)
+	return timeZone, ok
+}
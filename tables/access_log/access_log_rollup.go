@@ -0,0 +1,330 @@
+package access_log
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/context_values"
+	"github.com/turbot/tailpipe-plugin-sdk/mappers"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+const AccessLogRollupExtractorIdentifier = "nginx_access_log_rollup_extractor"
+
+// DefaultRollupInterval is the length of a rollup time bucket if rollup_interval is not set
+const DefaultRollupInterval = time.Minute
+
+// rollupFields are the source fields read when aggregating a line
+var rollupFields = []string{
+	"time_local", "time_iso8601", "msec",
+	"host", "http_host", "server_name",
+	"status", "request_method", "upstream_addr",
+	"body_bytes_sent", "bytes_sent",
+	"request_time", "upstream_response_time",
+}
+
+// rollupKey identifies a rollup row
+type rollupKey struct {
+	bucket        time.Time
+	host          string
+	statusClass   string
+	requestMethod string
+	// the address and port of the upstream server, as in the upstream_addr and upstream_port columns of
+	// nginx_access_log, with a port of 0 if there is none
+	upstreamAddr string
+	upstreamPort int64
+}
+
+// rollup holds the aggregated metrics for a rollupKey
+type rollup struct {
+	requestCount  int64
+	errorCount    int64
+	bodyBytesSent *int64
+	bytesSent     *int64
+
+	// request and upstream response times are aggregated in milliseconds, as in nginx_access_log
+	requestTimeSum       int64
+	requestTimeMax       int64
+	requestTime          *latencySketch
+	upstreamResponseTime *latencySketch
+}
+
+// accessLogRollupExtractor parses the lines of an access log and aggregates them into a row per rollupKey
+//
+// lines which cannot be parsed, or which have no timestamp, are not included in the rollup
+type accessLogRollupExtractor struct {
+	mapper   mappers.Mapper[*types.DynamicRow]
+	interval time.Duration
+	// applies any redaction rules configured on the format, so redacted values are not used as keys
+	redactor *redactor
+	// the time zone of times logged without an offset, from the format's default_time_zone, or nil if it is not set
+	timeZone *time.Location
+}
+
+func newAccessLogRollupExtractor(mapper mappers.Mapper[*types.DynamicRow], interval time.Duration, r *redactor, timeZone *time.Location) *accessLogRollupExtractor {
+	return &accessLogRollupExtractor{
+		mapper:   mapper,
+		interval: interval,
+		redactor: r,
+		timeZone: timeZone,
+	}
+}
+
+func (c *accessLogRollupExtractor) Identifier() string {
+	return AccessLogRollupExtractorIdentifier
+}
+
+// Extract implements artifact_source.Extractor
+func (c *accessLogRollupExtractor) Extract(ctx context.Context, a any) ([]any, error) {
+	var data []byte
+	switch v := a.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("expected []byte or string, got %T", a)
+	}
+
+	rollups := make(map[rollupKey]*rollup)
+	timeZone := extractorTimeZone(ctx, c.timeZone)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+		row, err := c.mapper.Map(ctx, line)
+		if err != nil {
+			continue
+		}
+		source := make(map[string]string, len(rollupFields))
+		for _, field := range rollupFields {
+			if v, ok := row.GetSourceValue(field); ok && !isNullValue(v) {
+				source[field] = v
+			}
+		}
+		if c.redactor != nil {
+			source = c.redactor.redact(source)
+		}
+		c.add(rollups, source, timeZone)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading access log: %w", err)
+	}
+
+	keys := make([]rollupKey, 0, len(rollups))
+	for key := range rollups {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b rollupKey) int {
+		return cmp.Or(
+			a.bucket.Compare(b.bucket),
+			cmp.Compare(a.host, b.host),
+			cmp.Compare(a.statusClass, b.statusClass),
+			cmp.Compare(a.requestMethod, b.requestMethod),
+			cmp.Compare(a.upstreamAddr, b.upstreamAddr),
+			cmp.Compare(a.upstreamPort, b.upstreamPort),
+		)
+	})
+
+	id := collectionID(ctx)
+	res := make([]any, 0, len(keys))
+	for _, key := range keys {
+		row, err := c.rollupRow(key, rollups[key], id)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, nil
+}
+
+// add aggregates the source fields of a single line
+func (c *accessLogRollupExtractor) add(rollups map[rollupKey]*rollup, source map[string]string, timeZone *time.Location) {
+	timestamp, ok := rollupTimestamp(source, timeZone)
+	if !ok {
+		return
+	}
+
+	key := rollupKey{
+		// use UTC so equal times in different zones share a bucket
+		bucket:        timestamp.UTC().Truncate(c.interval),
+		requestMethod: source["request_method"],
+	}
+	for _, field := range []string{"host", "http_host", "server_name"} {
+		if v := source[field]; v != "" {
+			key.host = v
+			break
+		}
+	}
+	var code int
+	if code, ok = parseStatus(source["status"]); ok {
+		key.statusClass, _ = statusClass(code)
+	}
+	if values := splitUpstreamValues(source["upstream_addr"]); len(values) > 0 {
+		addr, port := splitAddress(values[len(values)-1])
+		key.upstreamAddr, _ = addr.(string)
+		key.upstreamPort, _ = port.(int64)
+	}
+
+	r, ok := rollups[key]
+	if !ok {
+		r = &rollup{
+			requestTime:          newLatencySketch(),
+			upstreamResponseTime: newLatencySketch(),
+		}
+		rollups[key] = r
+	}
+
+	r.requestCount++
+	if isErrorStatus(code) {
+		r.errorCount++
+	}
+	r.bodyBytesSent = addCounter(r.bodyBytesSent, source["body_bytes_sent"])
+	r.bytesSent = addCounter(r.bytesSent, source["bytes_sent"])
+
+	if requestTime, ok := parseMilliseconds(source["request_time"]); ok {
+		r.requestTime.add(float64(requestTime))
+		r.requestTimeSum += requestTime
+		r.requestTimeMax = max(r.requestTimeMax, requestTime)
+	}
+	// use the response time of the last upstream server contacted, as for the upstream key
+	if values := splitUpstreamValues(source["upstream_response_time"]); len(values) > 0 {
+		if upstreamResponseTime, ok := parseMilliseconds(values[len(values)-1]); ok {
+			r.upstreamResponseTime.add(float64(upstreamResponseTime))
+		}
+	}
+}
+
+// rollupRow builds the output row for a rollup
+func (c *accessLogRollupExtractor) rollupRow(key rollupKey, r *rollup, collectionID string) (*types.DynamicRow, error) {
+	row := &types.DynamicRow{}
+	if err := row.InitialiseFromMap(map[string]string{}); err != nil {
+		return nil, err
+	}
+
+	row.OutputColumns[constants.TpTimestamp] = key.bucket
+	row.OutputColumns["interval_seconds"] = int64(c.interval / time.Second)
+	row.OutputColumns["collection_id"] = collectionID
+	if key.host != "" {
+		row.OutputColumns["host"] = key.host
+		row.OutputColumns[constants.TpDomains] = []string{key.host}
+	}
+	for column, value := range map[string]string{
+		"status_class":   key.statusClass,
+		"request_method": key.requestMethod,
+		"upstream_addr":  key.upstreamAddr,
+	} {
+		if value != "" {
+			row.OutputColumns[column] = value
+		}
+	}
+	if key.upstreamPort != 0 {
+		row.OutputColumns["upstream_port"] = key.upstreamPort
+	}
+
+	row.OutputColumns["request_count"] = r.requestCount
+	row.OutputColumns["error_count"] = r.errorCount
+	if r.bodyBytesSent != nil {
+		row.OutputColumns["body_bytes_sent"] = *r.bodyBytesSent
+	}
+	if r.bytesSent != nil {
+		row.OutputColumns["bytes_sent"] = *r.bytesSent
+	}
+
+	if r.requestTime.count > 0 {
+		row.OutputColumns["request_time_ms_sum"] = r.requestTimeSum
+		row.OutputColumns["request_time_ms_max"] = r.requestTimeMax
+		addQuantileColumns(row, "request_time_ms", r.requestTime)
+	}
+	if r.upstreamResponseTime.count > 0 {
+		addQuantileColumns(row, "upstream_response_time_ms", r.upstreamResponseTime)
+	}
+
+	return row, nil
+}
+
+// collectionID returns the ID of the collection the lines are aggregated in, which is the execution ID of the
+// collection, or a new ID if there is none
+//
+// the lines of a file may be aggregated in several collections, e.g. as lines are added to the live log file, so a
+// bucket may have a row for each, and the ID together with tp_source_location identifies where a row came from
+func collectionID(ctx context.Context) string {
+	if executionId, err := context_values.ExecutionIdFromContext(ctx); err == nil && executionId != "" {
+		return executionId
+	}
+	return xid.New().String()
+}
+
+// addQuantileColumns adds the percentile and sketch columns for a sketch of times in milliseconds, with the given
+// column prefix
+// percentiles are rounded to whole milliseconds, as the times are logged with millisecond resolution
+func addQuantileColumns(row *types.DynamicRow, prefix string, s *latencySketch) {
+	for suffix, q := range map[string]float64{"p50": 0.5, "p95": 0.95, "p99": 0.99} {
+		if v, ok := s.quantile(q); ok {
+			row.OutputColumns[prefix+"_"+suffix] = int64(math.Round(v))
+		}
+	}
+	row.OutputColumns[prefix+"_sketch"] = s
+}
+
+// extractorTimeZone returns the time zone of times logged without an offset, which is the format's
+// default_time_zone if set, otherwise the default_time_zone of the nginx_log_file source, otherwise UTC
+func extractorTimeZone(ctx context.Context, formatTimeZone *time.Location) *time.Location {
+	if formatTimeZone != nil {
+		return formatTimeZone
+	}
+	if timeZone, ok := log_file.TimeZoneFromContext(ctx); ok {
+		return timeZone
+	}
+	return time.UTC
+}
+
+// rollupTimestamp returns the time of a line from msec, time_iso8601 or time_local, in that order of precedence as
+// in the nginx_access_log table
+// unlike the table, a time_local without a date is not placed on the date of the log file, so a line with no valid
+// time returns false and is not counted
+func rollupTimestamp(source map[string]string, timeZone *time.Location) (time.Time, bool) {
+	if msec, ok := source["msec"]; ok {
+		if t, err := parseMsec(msec); err == nil {
+			return t, true
+		}
+	}
+	if ts, ok := source["time_iso8601"]; ok {
+		if t, err := parseTimeISO8601(ts, timeZone); err == nil {
+			return t, true
+		}
+	}
+	if ts, ok := source["time_local"]; ok {
+		if t, err := parseTimeLocal(ts, timeZone); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// addCounter adds an integer source value to a counter, leaving the counter unchanged for missing or invalid values
+func addCounter(counter *int64, value string) *int64 {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return counter
+	}
+	if counter == nil {
+		counter = new(int64)
+	}
+	*counter += i
+	return counter
+}
@@ -0,0 +1,83 @@
+package access_log
+
+import (
+	"math"
+	"slices"
+)
+
+// the relative accuracy of quantiles returned by a latencySketch
+const sketchRelativeAccuracy = 0.01
+
+// values below this are counted as zero, e.g. request times logged as 0.000
+const sketchMinValue = 1e-6
+
+var (
+	sketchGamma    = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// latencySketch is a mergeable quantile sketch with a bounded relative error
+//
+// values are counted in logarithmically sized bins, where bin i holds values in (gamma^(i-1), gamma^i],
+// so any quantile is accurate to within sketchRelativeAccuracy of the true value
+// as bins are fixed, sketches from different rows can be merged by summing the counts of each bin
+type latencySketch struct {
+	RelativeAccuracy float64 `json:"relative_accuracy"`
+	ZeroCount        int64   `json:"zero_count"`
+	// counts keyed by bin index
+	Bins map[int]int64 `json:"bins"`
+
+	count int64
+}
+
+func newLatencySketch() *latencySketch {
+	return &latencySketch{
+		RelativeAccuracy: sketchRelativeAccuracy,
+		Bins:             make(map[int]int64),
+	}
+}
+
+func (s *latencySketch) add(value float64) {
+	s.count++
+	if value < sketchMinValue {
+		s.ZeroCount++
+		return
+	}
+	s.Bins[sketchBin(value)]++
+}
+
+// quantile returns the value at quantile q (0 <= q <= 1), or false if the sketch is empty
+func (s *latencySketch) quantile(q float64) (float64, bool) {
+	if s.count == 0 {
+		return 0, false
+	}
+	rank := int64(q * float64(s.count-1))
+	if rank < s.ZeroCount {
+		return 0, true
+	}
+
+	bins := make([]int, 0, len(s.Bins))
+	for bin := range s.Bins {
+		bins = append(bins, bin)
+	}
+	slices.Sort(bins)
+
+	cumulative := s.ZeroCount
+	for _, bin := range bins {
+		cumulative += s.Bins[bin]
+		if cumulative > rank {
+			return sketchBinValue(bin), true
+		}
+	}
+	return sketchBinValue(bins[len(bins)-1]), true
+}
+
+// sketchBin returns the index of the bin holding value
+func sketchBin(value float64) int {
+	return int(math.Ceil(math.Log(value) / sketchLogGamma))
+}
+
+// sketchBinValue returns the representative value of a bin, which is within the relative accuracy of all values in it
+func sketchBinValue(bin int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(bin)) / (sketchGamma + 1)
+}
@@ -0,0 +1,46 @@
+package access_log
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_latencySketch_quantile(t *testing.T) {
+	s := newLatencySketch()
+	if _, ok := s.quantile(0.5); ok {
+		t.Fatal("expected no quantile for an empty sketch")
+	}
+
+	// 1ms to 1000ms
+	for i := 1; i <= 1000; i++ {
+		s.add(float64(i) / 1000)
+	}
+	for q, want := range map[float64]float64{0.5: 0.5, 0.95: 0.95, 0.99: 0.99, 1: 1} {
+		got, ok := s.quantile(q)
+		if !ok {
+			t.Fatalf("expected a quantile for q=%v", q)
+		}
+		if math.Abs(got-want)/want > sketchRelativeAccuracy+0.001 {
+			t.Errorf("quantile(%v) = %v, want %v within %v", q, got, want, sketchRelativeAccuracy)
+		}
+	}
+}
+
+func Test_latencySketch_zero(t *testing.T) {
+	s := newLatencySketch()
+	for i := 0; i < 90; i++ {
+		s.add(0)
+	}
+	for i := 0; i < 10; i++ {
+		s.add(2)
+	}
+	if got, _ := s.quantile(0.5); got != 0 {
+		t.Errorf("quantile(0.5) = %v, want 0", got)
+	}
+	if got, _ := s.quantile(0.99); math.Abs(got-2)/2 > sketchRelativeAccuracy {
+		t.Errorf("quantile(0.99) = %v, want 2", got)
+	}
+	if s.ZeroCount != 90 {
+		t.Errorf("zero_count = %d, want 90", s.ZeroCount)
+	}
+}
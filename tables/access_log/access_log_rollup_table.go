@@ -0,0 +1,201 @@
+package access_log
+
+import (
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/formats"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/table"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+const AccessLogRollupTableIdentifier = "nginx_access_log_rollup"
+
+// AccessLogRollupTable - table of time-bucketed metrics aggregated from nginx access logs
+//
+// the table uses the same formats as the nginx_access_log table, so the same log files can be collected into both
+type AccessLogRollupTable struct {
+	table.CustomTableImpl
+}
+
+func (c *AccessLogRollupTable) Identifier() string {
+	return AccessLogRollupTableIdentifier
+}
+
+func (c *AccessLogRollupTable) GetDescription() string {
+	return "Nginx access log rollups hold request counts, bytes and latency percentiles per time bucket, host, status class, method and upstream."
+}
+
+func (c *AccessLogRollupTable) GetDefaultFormat() formats.Format {
+	return defaultAccessLogTableFormat
+}
+
+func (c *AccessLogRollupTable) GetTableDefinition() *schema.TableSchema {
+	return &schema.TableSchema{
+		Name: AccessLogRollupTableIdentifier,
+		Columns: []*schema.ColumnSchema{
+			// rollup key
+			{
+				ColumnName:  "interval_seconds",
+				Description: "Length of the time bucket in seconds, starting at tp_timestamp",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "collection_id",
+				Description: "ID of the collection the row was aggregated in; a time bucket may have several rows for each log file and collection",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "host",
+				Description: "Hostname from the 'Host' request header, or the server name matching the request",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "status_class",
+				Description: "Class of the response status code (1xx, 2xx, 3xx, 4xx or 5xx)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "request_method",
+				Description: "Request method (GET, POST, etc.)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "upstream_addr",
+				Description: "IP address of the upstream server whose response was used, in canonical form so it can be cast to inet, or the path of a unix socket, or null if the request was not proxied",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "upstream_port",
+				Description: "Port of the upstream server whose response was used",
+				Type:        "integer",
+			},
+			// counters
+			{
+				ColumnName:  "request_count",
+				Description: "Number of requests",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "error_count",
+				Description: "Number of requests with a response status code of 400 or above",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "body_bytes_sent",
+				Description: "Total bytes sent to clients, excluding headers, if body_bytes_sent is in the log format",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "bytes_sent",
+				Description: "Total bytes sent to clients, if bytes_sent is in the log format",
+				Type:        "bigint",
+			},
+			// request time
+			{
+				ColumnName:  "request_time_ms_sum",
+				Description: "Total request processing time in milliseconds, if request_time is in the log format",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "request_time_ms_max",
+				Description: "Maximum request processing time in milliseconds",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "request_time_ms_p50",
+				Description: "Median request processing time in milliseconds, accurate to within 1%",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "request_time_ms_p95",
+				Description: "95th percentile request processing time in milliseconds, accurate to within 1%",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "request_time_ms_p99",
+				Description: "99th percentile request processing time in milliseconds, accurate to within 1%",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "request_time_ms_sketch",
+				Description: "Mergeable sketch of request processing times in milliseconds, with the count of requests per logarithmic bin",
+				Type:        "json",
+			},
+			// upstream response time
+			{
+				ColumnName:  "upstream_response_time_ms_p50",
+				Description: "Median time to receive the response from the upstream server in milliseconds, accurate to within 1%",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "upstream_response_time_ms_p95",
+				Description: "95th percentile time to receive the response from the upstream server in milliseconds, accurate to within 1%",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "upstream_response_time_ms_p99",
+				Description: "99th percentile time to receive the response from the upstream server in milliseconds, accurate to within 1%",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "upstream_response_time_ms_sketch",
+				Description: "Mergeable sketch of upstream response times in milliseconds, with the count of requests per logarithmic bin",
+				Type:        "json",
+			},
+		},
+	}
+}
+
+func (c *AccessLogRollupTable) GetSourceMetadata() ([]*table.SourceMetadata[*types.DynamicRow], error) {
+	// ask our CustomTableImpl for the mapper - the extractor uses it to parse each line
+	mapper, err := c.Format.GetMapper()
+	if err != nil {
+		return nil, err
+	}
+
+	var interval = DefaultRollupInterval
+	var r *redactor
+	var timeZone *time.Location
+	if format, ok := c.Format.(*AccessLogTableFormat); ok {
+		if interval, err = format.rollupInterval(); err != nil {
+			return nil, err
+		}
+		if r, err = newRedactor(format); err != nil {
+			return nil, err
+		}
+		if format.DefaultTimeZone != "" {
+			if timeZone, err = log_parse.ParseTimeZone(format.DefaultTimeZone); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return []*table.SourceMetadata[*types.DynamicRow]{
+		{
+			// any artifact source
+			// each artifact is aggregated as a whole, so the extractor returns the rollup rows and no mapper is needed
+			SourceName: constants.ArtifactSourceIdentifier,
+			Options: []row_source.RowSourceOption{
+				artifact_source.WithArtifactExtractor(newAccessLogRollupExtractor(mapper, interval, r, timeZone)),
+			},
+		},
+		{
+			// the nginx log file source, which handles rotated and compressed files
+			// the lines collected from each file are aggregated as a whole, as for an artifact
+			SourceName: log_file.LogFileSourceIdentifier,
+			Options: []row_source.RowSourceOption{
+				log_file.WithExtractor(newAccessLogRollupExtractor(mapper, interval, r, timeZone)),
+			},
+		},
+	}, nil
+}
+
+func (c *AccessLogRollupTable) EnrichRow(row *types.DynamicRow, sourceEnrichmentFields schema.SourceEnrichment) (*types.DynamicRow, error) {
+	return c.CustomTableImpl.EnrichRow(row, sourceEnrichmentFields)
+}
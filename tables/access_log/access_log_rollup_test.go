@@ -0,0 +1,168 @@
+package access_log
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/context_values"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_accessLogRollupExtractor_Extract(t *testing.T) {
+	format := &AccessLogTableFormat{
+		Layout: `$remote_addr [$time_local] "$request" $status $body_bytes_sent "$host" $request_time "$upstream_addr" "$upstream_response_time"`,
+	}
+	mapper, err := format.GetMapper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	interval, err := (&AccessLogTableFormat{RollupInterval: "5m"}).rollupInterval()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := []string{
+		`203.0.113.5 [16/Oct/2024:12:00:01 +0000] "GET / HTTP/1.1" 200 100 "example.com" 0.010 "10.0.0.1:80" "0.008"`,
+		`203.0.113.6 [16/Oct/2024:12:04:59 +0000] "GET /a HTTP/1.1" 200 300 "example.com" 0.030 "10.0.0.2:80, 10.0.0.1:80" "0.002, 0.020"`,
+		`203.0.113.7 [16/Oct/2024:12:03:00 +0000] "GET /b HTTP/1.1" 502 50 "example.com" 1.000 "10.0.0.1:80" "1.000"`,
+		`203.0.113.5 [16/Oct/2024:12:05:00 +0000] "POST /login HTTP/1.1" 404 10 "example.com" 0.001 "-" "-"`,
+		`not an access log line`,
+	}
+	rows, err := newAccessLogRollupExtractor(mapper, interval, nil, time.UTC).Extract(context.Background(), []byte(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	bucket := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []map[string]any{
+		{
+			constants.TpTimestamp: bucket,
+			"interval_seconds":    int64(300),
+			"host":                "example.com",
+			"status_class":        "2xx",
+			"request_method":      "GET",
+			"upstream_addr":       "10.0.0.1",
+			"upstream_port":       int64(80),
+			"request_count":       int64(2),
+			"error_count":         int64(0),
+			"body_bytes_sent":     int64(400),
+		},
+		{
+			constants.TpTimestamp: bucket,
+			"status_class":        "5xx",
+			"request_count":       int64(1),
+			"error_count":         int64(1),
+			"request_time_ms_max": int64(1000),
+		},
+		{
+			constants.TpTimestamp: bucket.Add(5 * time.Minute),
+			"status_class":        "4xx",
+			"request_method":      "POST",
+			"upstream_addr":       nil,
+			"upstream_port":       nil,
+			"error_count":         int64(1),
+		},
+	}
+	for i, want := range tests {
+		got := rows[i].(*types.DynamicRow).OutputColumns
+		for column, value := range want {
+			if got[column] != value {
+				t.Errorf("row %d %s: got %v, want %v", i, column, got[column], value)
+			}
+		}
+	}
+
+	first := rows[0].(*types.DynamicRow).OutputColumns
+	// times are aggregated in milliseconds, and the percentiles are rounded to whole milliseconds
+	for column, want := range map[string]int64{
+		"request_time_ms_p50":           10,
+		"request_time_ms_p99":           10,
+		"request_time_ms_sum":           40,
+		"upstream_response_time_ms_p50": 8,
+	} {
+		if got := first[column]; got != want {
+			t.Errorf("%s: got %v (%T), want %d", column, got, got, want)
+		}
+	}
+	if _, ok := first["request_time_ms_sketch"].(*latencySketch); !ok {
+		t.Errorf("request_time_ms_sketch: got %T, want *latencySketch", first["request_time_ms_sketch"])
+	}
+	if _, ok := rows[2].(*types.DynamicRow).OutputColumns["upstream_response_time_ms_p50"]; ok {
+		t.Error("upstream_response_time_ms_p50: expected no value for a request which was not proxied")
+	}
+}
+
+func Test_AccessLogTableFormat_rollupInterval(t *testing.T) {
+	for value, valid := range map[string]bool{"": true, "1m": true, "15m": true, "1h": true, "24h": true, "7m": false, "500ms": false, "48h": false, "-1m": false, "soon": false} {
+		_, err := (&AccessLogTableFormat{RollupInterval: value}).rollupInterval()
+		if valid != (err == nil) {
+			t.Errorf("rollup_interval '%s': got error %v, want valid %v", value, err, valid)
+		}
+	}
+}
+
+func TestAccessLogRollupTable_GetSourceMetadata(t *testing.T) {
+	tbl := &AccessLogRollupTable{}
+	if err := tbl.Initialize(tbl.GetDefaultFormat(), tbl.GetTableDefinition()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	metadata, err := tbl.GetSourceMetadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var sources []string
+	for _, m := range metadata {
+		sources = append(sources, m.SourceName)
+		// the rollup rows are built by the extractor, so no source has a mapper
+		if m.Mapper != nil || len(m.Options) != 1 {
+			t.Errorf("%s: got mapper %v and %d options, want an extractor option and no mapper", m.SourceName, m.Mapper, len(m.Options))
+		}
+	}
+	if want := []string{constants.ArtifactSourceIdentifier, log_file.LogFileSourceIdentifier}; !slices.Equal(sources, want) {
+		t.Errorf("got sources %v, want %v", sources, want)
+	}
+}
+
+func Test_accessLogRollupExtractor_Extract_CollectionID(t *testing.T) {
+	format := &AccessLogTableFormat{Layout: `$remote_addr [$time_local] "$request" $status`}
+	mapper, err := format.GetMapper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	extractor := newAccessLogRollupExtractor(mapper, time.Minute, nil, nil)
+	line := []byte(`203.0.113.5 [16/Oct/2024:12:00:01 +0000] "GET / HTTP/1.1" 200`)
+
+	collect := func(ctx context.Context) string {
+		t.Helper()
+		rows, err := extractor.Extract(ctx, line)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("got %d rows, want 1", len(rows))
+		}
+		id, _ := rows[0].(*types.DynamicRow).OutputColumns["collection_id"].(string)
+		return id
+	}
+
+	// the same bucket aggregated in two collections has a row for each, identified by the collection
+	first := collect(context_values.WithExecutionId(context.Background(), "exec_1"))
+	second := collect(context_values.WithExecutionId(context.Background(), "exec_2"))
+	if first != "exec_1" || second != "exec_2" {
+		t.Errorf("collection_id: got %q and %q, want the execution IDs", first, second)
+	}
+
+	// without an execution ID, each aggregation still has its own ID
+	if a, b := collect(context.Background()), collect(context.Background()); a == "" || a == b {
+		t.Errorf("collection_id: got %q and %q, want distinct IDs", a, b)
+	}
+}
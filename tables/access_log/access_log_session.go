@@ -0,0 +1,241 @@
+package access_log
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/mappers"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+const AccessLogSessionExtractorIdentifier = "nginx_access_session_extractor"
+
+// sessionFields are the source fields read when sessionizing a line
+var sessionFields = []string{
+	"time_local", "time_iso8601", "msec",
+	"remote_addr", "http_user_agent", "http_cookie",
+	"host", "http_host", "server_name",
+	"status", "request_uri", "uri",
+	"body_bytes_sent", "bytes_sent",
+}
+
+// sessionRequest is a single request read from an access log
+type sessionRequest struct {
+	timestamp time.Time
+	visitor   string
+	source    map[string]string
+}
+
+// sessionSummary holds the aggregated metrics of a visitor session
+type sessionSummary struct {
+	session *visitorSession
+
+	remoteAddr    string
+	userAgent     string
+	host          string
+	end           time.Time
+	requestCount  int64
+	errorCount    int64
+	bodyBytesSent *int64
+	bytesSent     *int64
+	entryPage     string
+	exitPage      string
+}
+
+// accessLogSessionExtractor parses the lines of an access log, groups them into visitor sessions and returns
+// a row per session
+//
+// the lines are sorted by time before they are grouped, and lines which cannot be parsed, or which have no
+// timestamp or visitor, are not included in any session
+type accessLogSessionExtractor struct {
+	mapper  mappers.Mapper[*types.DynamicRow]
+	timeout time.Duration
+	cookie  string
+	// applies any redaction rules configured on the format, so redacted values identify visitors and are stored
+	redactor *redactor
+	// the time zone of times logged without an offset, from the format's default_time_zone, or nil if it is not set
+	timeZone *time.Location
+}
+
+func newAccessLogSessionExtractor(mapper mappers.Mapper[*types.DynamicRow], timeout time.Duration, cookie string, r *redactor, timeZone *time.Location) *accessLogSessionExtractor {
+	return &accessLogSessionExtractor{
+		mapper:   mapper,
+		timeout:  timeout,
+		cookie:   cookie,
+		redactor: r,
+		timeZone: timeZone,
+	}
+}
+
+func (c *accessLogSessionExtractor) Identifier() string {
+	return AccessLogSessionExtractorIdentifier
+}
+
+// Extract implements artifact_source.Extractor
+func (c *accessLogSessionExtractor) Extract(ctx context.Context, a any) ([]any, error) {
+	var data []byte
+	switch v := a.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("expected []byte or string, got %T", a)
+	}
+
+	fields := sessionFields
+	if c.cookie != "" {
+		fields = append(slices.Clone(fields), "cookie_"+c.cookie)
+	}
+
+	timeZone := extractorTimeZone(ctx, c.timeZone)
+	var requests []sessionRequest
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+		row, err := c.mapper.Map(ctx, line)
+		if err != nil {
+			continue
+		}
+		source := make(map[string]string, len(fields))
+		for _, field := range fields {
+			if v, ok := row.GetSourceValue(field); ok && !isNullValue(v) {
+				source[field] = v
+			}
+		}
+		if c.redactor != nil {
+			source = c.redactor.redact(source)
+		}
+		timestamp, ok := rollupTimestamp(source, timeZone)
+		if !ok {
+			continue
+		}
+		visitor, ok := visitorKey(func(field string) (string, bool) {
+			v, ok := source[field]
+			return v, ok
+		}, c.cookie)
+		if !ok {
+			continue
+		}
+		// sessions are stored in UTC, as tp_timestamp is in nginx_access_log
+		requests = append(requests, sessionRequest{timestamp: timestamp.UTC(), visitor: visitor, source: source})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading access log: %w", err)
+	}
+
+	// group the requests in time order, keeping the order of requests logged at the same time
+	slices.SortStableFunc(requests, func(a, b sessionRequest) int {
+		return a.timestamp.Compare(b.timestamp)
+	})
+	tracker := newSessionTracker(c.timeout)
+	summaries := make(map[*visitorSession]*sessionSummary)
+	for _, request := range requests {
+		session := tracker.assign(request.visitor, request.timestamp)
+		summary, ok := summaries[session]
+		if !ok {
+			summary = &sessionSummary{session: session}
+			summaries[session] = summary
+		}
+		summary.add(request)
+	}
+
+	res := make([]any, 0, len(summaries))
+	for _, summary := range slices.SortedFunc(maps.Values(summaries), func(a, b *sessionSummary) int {
+		return cmp.Or(a.session.start.Compare(b.session.start), cmp.Compare(a.session.id, b.session.id))
+	}) {
+		row, err := summary.sessionRow()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, nil
+}
+
+// add aggregates a request, which must be no earlier than the requests already added
+func (s *sessionSummary) add(request sessionRequest) {
+	source := request.source
+	if s.requestCount == 0 {
+		s.remoteAddr, _ = normalizeIP(source["remote_addr"])
+		s.userAgent = source["http_user_agent"]
+		for _, field := range []string{"host", "http_host", "server_name"} {
+			if v := source[field]; v != "" {
+				s.host = v
+				break
+			}
+		}
+	}
+	s.end = request.timestamp
+	s.requestCount++
+	if code, ok := parseStatus(source["status"]); ok && isErrorStatus(code) {
+		s.errorCount++
+	}
+	s.bodyBytesSent = addCounter(s.bodyBytesSent, source["body_bytes_sent"])
+	s.bytesSent = addCounter(s.bytesSent, source["bytes_sent"])
+
+	page := source["request_uri"]
+	if page == "" {
+		page = source["uri"]
+	}
+	if page != "" {
+		if s.entryPage == "" {
+			s.entryPage = page
+		}
+		s.exitPage = page
+	}
+}
+
+// sessionRow builds the output row for a session
+func (s *sessionSummary) sessionRow() (*types.DynamicRow, error) {
+	row := &types.DynamicRow{}
+	if err := row.InitialiseFromMap(map[string]string{}); err != nil {
+		return nil, err
+	}
+
+	row.OutputColumns[constants.TpTimestamp] = s.session.start
+	row.OutputColumns["session_id"] = s.session.id
+	row.OutputColumns["session_start"] = s.session.start
+	row.OutputColumns["session_end"] = s.end
+	row.OutputColumns["duration_ms"] = s.end.Sub(s.session.start).Milliseconds()
+	if s.remoteAddr != "" {
+		row.OutputColumns["remote_addr"] = s.remoteAddr
+		row.OutputColumns[constants.TpSourceIP] = s.remoteAddr
+		row.OutputColumns[constants.TpIps] = []string{s.remoteAddr}
+	}
+	if s.host != "" {
+		row.OutputColumns["host"] = s.host
+		row.OutputColumns[constants.TpDomains] = []string{s.host}
+	}
+	for column, value := range map[string]string{
+		"http_user_agent": s.userAgent,
+		"entry_page":      s.entryPage,
+		"exit_page":       s.exitPage,
+	} {
+		if value != "" {
+			row.OutputColumns[column] = value
+		}
+	}
+
+	row.OutputColumns["request_count"] = s.requestCount
+	row.OutputColumns["error_count"] = s.errorCount
+	if s.bodyBytesSent != nil {
+		row.OutputColumns["body_bytes_sent"] = *s.bodyBytesSent
+	}
+	if s.bytesSent != nil {
+		row.OutputColumns["bytes_sent"] = *s.bytesSent
+	}
+
+	return row, nil
+}
@@ -0,0 +1,162 @@
+package access_log
+
+import (
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/formats"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/table"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+const AccessSessionTableIdentifier = "nginx_access_session"
+
+// AccessSessionTable - table of visitor sessions derived from nginx access logs
+//
+// the table uses the same formats as the nginx_access_log table, so the same log files can be collected into both
+type AccessSessionTable struct {
+	table.CustomTableImpl
+}
+
+func (c *AccessSessionTable) Identifier() string {
+	return AccessSessionTableIdentifier
+}
+
+func (c *AccessSessionTable) GetDescription() string {
+	return "Nginx access sessions group the requests of each visitor, separated by an inactivity timeout, with their start and end, request count, bytes and entry and exit pages."
+}
+
+func (c *AccessSessionTable) GetDefaultFormat() formats.Format {
+	return defaultAccessLogTableFormat
+}
+
+func (c *AccessSessionTable) GetTableDefinition() *schema.TableSchema {
+	return &schema.TableSchema{
+		Name: AccessSessionTableIdentifier,
+		Columns: []*schema.ColumnSchema{
+			{
+				ColumnName:  "session_id",
+				Description: "Unique identifier of the session, matching the session_id of its requests in nginx_access_log",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "session_start",
+				Description: "Time of the first request of the session",
+				Type:        "timestamp",
+			},
+			{
+				ColumnName:  "session_end",
+				Description: "Time of the last request of the session",
+				Type:        "timestamp",
+			},
+			{
+				ColumnName:  "duration_ms",
+				Description: "Time between the first and last requests of the session, in milliseconds",
+				Type:        "bigint",
+			},
+			// visitor
+			{
+				ColumnName:  "remote_addr",
+				Description: "Client IP address of the first request of the session, in canonical form so it can be cast to inet",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "http_user_agent",
+				Description: "Value of the 'User-Agent' request header of the first request of the session",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "host",
+				Description: "Hostname from the 'Host' request header, or the server name matching the first request of the session",
+				Type:        "varchar",
+			},
+			// counters
+			{
+				ColumnName:  "request_count",
+				Description: "Number of requests in the session",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "error_count",
+				Description: "Number of requests in the session with a response status code of 400 or above",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "body_bytes_sent",
+				Description: "Total bytes sent to the visitor, excluding headers, if body_bytes_sent is in the log format",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "bytes_sent",
+				Description: "Total bytes sent to the visitor, if bytes_sent is in the log format",
+				Type:        "bigint",
+			},
+			// pages
+			{
+				ColumnName:  "entry_page",
+				Description: "Request URI of the first request of the session",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "exit_page",
+				Description: "Request URI of the last request of the session",
+				Type:        "varchar",
+			},
+		},
+	}
+}
+
+func (c *AccessSessionTable) GetSourceMetadata() ([]*table.SourceMetadata[*types.DynamicRow], error) {
+	// ask our CustomTableImpl for the mapper - the extractor uses it to parse each line
+	mapper, err := c.Format.GetMapper()
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout = DefaultSessionTimeout
+	var cookie string
+	var r *redactor
+	var timeZone *time.Location
+	if format, ok := c.Format.(*AccessLogTableFormat); ok {
+		if timeout, err = format.sessionTimeout(); err != nil {
+			return nil, err
+		}
+		cookie = format.SessionCookie
+		if r, err = newRedactor(format); err != nil {
+			return nil, err
+		}
+		if format.DefaultTimeZone != "" {
+			if timeZone, err = log_parse.ParseTimeZone(format.DefaultTimeZone); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return []*table.SourceMetadata[*types.DynamicRow]{
+		{
+			// any artifact source
+			// each artifact is sessionized as a whole, so the extractor returns the session rows and no mapper is needed
+			SourceName: constants.ArtifactSourceIdentifier,
+			Options: []row_source.RowSourceOption{
+				artifact_source.WithArtifactExtractor(newAccessLogSessionExtractor(mapper, timeout, cookie, r, timeZone)),
+			},
+		},
+		{
+			// the nginx log file source, which handles rotated and compressed files
+			// the lines collected from each file are sessionized in chunks of about 16 MiB
+			SourceName: log_file.LogFileSourceIdentifier,
+			Options: []row_source.RowSourceOption{
+				log_file.WithExtractor(newAccessLogSessionExtractor(mapper, timeout, cookie, r, timeZone)),
+			},
+		},
+	}, nil
+}
+
+func (c *AccessSessionTable) EnrichRow(row *types.DynamicRow, sourceEnrichmentFields schema.SourceEnrichment) (*types.DynamicRow, error) {
+	return c.CustomTableImpl.EnrichRow(row, sourceEnrichmentFields)
+}
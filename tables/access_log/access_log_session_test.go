@@ -0,0 +1,118 @@
+package access_log
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_accessLogSessionExtractor_Extract(t *testing.T) {
+	mapper, err := defaultAccessLogTableFormat.GetMapper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the lines are not in time order, and the first visitor's requests span the 12:30 boundary of a fixed window
+	lines := []string{
+		`203.0.113.5 - - [16/Oct/2024:12:20:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Firefox"`,
+		`203.0.113.5 - - [16/Oct/2024:12:40:00 +0000] "GET /pricing HTTP/1.1" 404 10 "-" "Firefox"`,
+		`203.0.113.5 - - [16/Oct/2024:12:35:00 +0000] "GET /about HTTP/1.1" 200 300 "-" "Firefox"`,
+		`198.51.100.7 - - [16/Oct/2024:12:21:00 +0000] "GET /api HTTP/1.1" 200 50 "-" "curl/8.0"`,
+		`203.0.113.5 - - [16/Oct/2024:13:30:00 +0000] "GET /contact HTTP/1.1" 200 20 "-" "Firefox"`,
+		`not an access log line`,
+	}
+	rows, err := newAccessLogSessionExtractor(mapper, 30*time.Minute, "", nil, time.UTC).Extract(context.Background(), []byte(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	start := time.Date(2024, 10, 16, 12, 20, 0, 0, time.UTC)
+	tests := []map[string]any{
+		{
+			constants.TpTimestamp: start,
+			"session_start":       start,
+			"session_end":         start.Add(20 * time.Minute),
+			"duration_ms":         int64(20 * 60 * 1000),
+			"remote_addr":         "203.0.113.5",
+			"http_user_agent":     "Firefox",
+			"request_count":       int64(3),
+			"error_count":         int64(1),
+			"body_bytes_sent":     int64(410),
+			"entry_page":          "/",
+			"exit_page":           "/pricing",
+		},
+		{
+			constants.TpTimestamp: start.Add(time.Minute),
+			"remote_addr":         "198.51.100.7",
+			"request_count":       int64(1),
+			"entry_page":          "/api",
+			"exit_page":           "/api",
+		},
+		{
+			// the request after 50 minutes of inactivity starts a new session
+			constants.TpTimestamp: start.Add(70 * time.Minute),
+			"request_count":       int64(1),
+			"duration_ms":         int64(0),
+			"entry_page":          "/contact",
+		},
+	}
+	for i, want := range tests {
+		got := rows[i].(*types.DynamicRow).OutputColumns
+		for column, value := range want {
+			if gotTime, ok := got[column].(time.Time); ok {
+				if !gotTime.Equal(value.(time.Time)) {
+					t.Errorf("row %d %s: got %v, want %v", i, column, got[column], value)
+				}
+			} else if got[column] != value {
+				t.Errorf("row %d %s: got %v, want %v", i, column, got[column], value)
+			}
+		}
+	}
+
+	// the session IDs match those assigned to the requests in nginx_access_log, which are collected in time order
+	s, err := newSessionizer(&AccessLogTableFormat{Sessionize: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	row := &types.DynamicRow{}
+	if err := row.InitialiseFromMap(map[string]string{"remote_addr": "203.0.113.5", "http_user_agent": "Firefox"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	row.OutputColumns[constants.TpTimestamp] = start
+	s.enrichSession(row, "access.log")
+	if got, want := rows[0].(*types.DynamicRow).OutputColumns["session_id"], row.OutputColumns["session_id"]; got != want {
+		t.Errorf("session_id: got %v, want %v as assigned by nginx_access_log", got, want)
+	}
+}
+
+func TestAccessSessionTable_GetSourceMetadata(t *testing.T) {
+	tbl := &AccessSessionTable{}
+	if err := tbl.Initialize(tbl.GetDefaultFormat(), tbl.GetTableDefinition()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	metadata, err := tbl.GetSourceMetadata()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var sources []string
+	for _, m := range metadata {
+		sources = append(sources, m.SourceName)
+		// the session rows are built by the extractor, so no source has a mapper
+		if m.Mapper != nil || len(m.Options) != 1 {
+			t.Errorf("%s: got mapper %v and %d options, want an extractor option and no mapper", m.SourceName, m.Mapper, len(m.Options))
+		}
+	}
+	if want := []string{constants.ArtifactSourceIdentifier, log_file.LogFileSourceIdentifier}; !slices.Equal(sources, want) {
+		t.Errorf("got sources %v, want %v", sources, want)
+	}
+}
@@ -1,7 +1,12 @@
 package access_log
 
 import (
-	"github.com/turbot/go-kit/helpers"
+	"slices"
+	"time"
+
+	typehelpers "github.com/turbot/go-kit/types"
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
 	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
 	"github.com/turbot/tailpipe-plugin-sdk/constants"
 	"github.com/turbot/tailpipe-plugin-sdk/error_types"
@@ -19,12 +24,58 @@ const AccessLogTableNilValue = "-"
 // AccessLogTable - table for nginx access logs
 type AccessLogTable struct {
 	table.CustomTableImpl
+
+	// applies any redaction rules configured on the format
+	redactor *redactor
+	// assigns rows to visitor sessions, if enabled on the format
+	sessionizer *sessionizer
+	// extracts partition metadata from file paths, if a path template is set on the format
+	pathTemplate *pathTemplate
+	// the time zone of times logged without an offset, from the format's default_time_zone, or nil if it is not set
+	timeZone *time.Location
 }
 
 func (c *AccessLogTable) Identifier() string {
 	return AccessLogTableIdentifier
 }
 
+// Initialize overrides CustomTableImpl.Initialize to build the enrichment state for the format
+func (c *AccessLogTable) Initialize(format formats.Format, customTableSchema *schema.TableSchema) error {
+	if err := c.CustomTableImpl.Initialize(format, customTableSchema); err != nil {
+		return err
+	}
+
+	r, err := newRedactor(c.accessLogFormat())
+	if err != nil {
+		return err
+	}
+	c.redactor = r
+
+	sessionizer, err := newSessionizer(c.accessLogFormat())
+	if err != nil {
+		return err
+	}
+	c.sessionizer = sessionizer
+
+	if format := c.accessLogFormat(); format != nil {
+		pathTemplate, err := newPathTemplate(format.PathTemplate)
+		if err != nil {
+			return err
+		}
+		c.pathTemplate = pathTemplate
+
+		if format.DefaultTimeZone != "" {
+			timeZone, err := log_parse.ParseTimeZone(format.DefaultTimeZone)
+			if err != nil {
+				return err
+			}
+			c.timeZone = timeZone
+		}
+	}
+
+	return nil
+}
+
 func (c *AccessLogTable) GetDefaultFormat() formats.Format {
 	return defaultAccessLogTableFormat
 }
@@ -40,9 +91,19 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 			// default format fields
 			{
 				ColumnName:  "remote_addr",
-				Description: "Client IP address",
+				Description: "Client IP address, in canonical form so it can be cast to inet",
 				Type:        "varchar",
 			},
+			{
+				ColumnName:  "remote_addr_type",
+				Description: "Classification of the client IP address (loopback, private, link_local, cgnat, multicast, unspecified, reserved or public)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "remote_addr_is_internal",
+				Description: "True if the client IP address is a loopback, private, link-local or carrier-grade NAT address",
+				Type:        "boolean",
+			},
 			{
 				ColumnName:  "host",
 				Description: "Hostname from the 'Host' request header, or the server name matching the request",
@@ -58,6 +119,16 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 				Description: "Local time in Common Log Format",
 				Type:        "varchar",
 			},
+			{
+				ColumnName:  "time_zone",
+				Description: "UTC offset of the logged local time (e.g. '-07:00'), from time_local or time_iso8601, or from the default_time_zone of the format or nginx_log_file source if the time was logged without an offset",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "time_zone_mismatch",
+				Description: "True if the time was logged with a UTC offset other than that of the default_time_zone of the format or nginx_log_file source at the time, e.g. because the server's time zone is misconfigured, or null if default_time_zone is not set",
+				Type:        "boolean",
+			},
 			{
 				ColumnName:  "request_method",
 				Description: "Request method (GET, POST, etc.)",
@@ -73,11 +144,51 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 				Description: "Protocol used in the request (e.g. 'HTTP/1.1')",
 				Type:        "varchar",
 			},
+			{
+				ColumnName:  "http_version",
+				Description: "Normalized HTTP version of the request (1.0, 1.1, 2 or 3), derived from server_protocol, http2 and http3",
+				Type:        "varchar",
+			},
 			{
 				ColumnName:  "status",
 				Description: "Response status code",
 				Type:        "integer",
 			},
+			{
+				ColumnName:  "status_class",
+				Description: "Class of the response status code (1xx, 2xx, 3xx, 4xx or 5xx)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "is_error",
+				Description: "True if the response status code is 400 or above",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "is_connection_closed",
+				Description: "True if nginx closed the connection without sending a response (444)",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "is_client_closed_request",
+				Description: "True if the client closed the connection before nginx sent the response (499)",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "is_request_header_too_large",
+				Description: "True if the request header or cookie was too large (494)",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "is_ssl_error",
+				Description: "True if the request failed due to a client certificate error (495), a missing client certificate (496) or a plain HTTP request sent to an HTTPS port (497)",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "error_origin",
+				Description: "Where an error response originated: upstream if the upstream server returned an error, otherwise nginx; null if the response was not an error, even if the upstream server returned one",
+				Type:        "varchar",
+			},
 			{
 				ColumnName:  "body_bytes_sent",
 				Description: "Number of bytes sent to the client, excluding headers",
@@ -132,7 +243,7 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 			},
 			{
 				ColumnName:  "server_addr",
-				Description: "Server address",
+				Description: "Server IP address, in canonical form so it can be cast to inet",
 				Type:        "varchar",
 			},
 			{
@@ -144,13 +255,33 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 			{
 				ColumnName:  "connection",
 				Description: "Connection serial number",
-				Type:        "varchar",
+				Type:        "bigint",
 			},
 			{
 				ColumnName:  "connection_requests",
 				Description: "Number of requests made through this connection",
 				Type:        "integer",
 			},
+			{
+				ColumnName:  "is_keepalive_reuse",
+				Description: "True if the request reused a keep-alive connection, i.e. was not the first request on the connection",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "connection_key",
+				Description: "Key identifying the connection across rows, built from the server, worker PID, connection serial number and date, where the server is the first of $hostname or the nginx_log_file source's hostname, $server_addr and $server_name",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "session_id",
+				Description: "ID of the visitor session the request belongs to, if sessionization is enabled on the format",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "request_key",
+				Description: "Key identifying the request by the server of connection_key, worker PID, connection, date and request line, matching the request_key of nginx_error_log entries logged for the request",
+				Type:        "varchar",
+			},
 			{
 				ColumnName:  "msec",
 				Description: "Current time in seconds with milliseconds resolution",
@@ -158,8 +289,8 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 			},
 			{
 				ColumnName:  "time_iso8601",
-				Description: "Local time in ISO 8601 format",
-				Type:        "timestamp",
+				Description: "Local time in ISO 8601 format, including its UTC offset",
+				Type:        "varchar",
 			},
 			// additional response variables
 			{
@@ -168,40 +299,140 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 				Type:        "integer",
 			},
 			{
-				ColumnName:  "request_time",
-				Description: "Time spent processing the request, in seconds with milliseconds resolution",
-				Type:        "float",
+				ColumnName:  "request_time_ms",
+				Description: "Time spent processing the request, in milliseconds",
+				Type:        "bigint",
 			},
 			{
-				ColumnName:  "pipe",
-				Description: "Indicates if the request was pipelined (p) or not (.)",
-				Type:        "varchar",
+				ColumnName:  "pipelined",
+				Description: "True if the request was pipelined",
+				Type:        "boolean",
 			},
 			// additional upstream variables
 			{
 				ColumnName:  "upstream_addr",
-				Description: "Address of the upstream server handling the request",
+				Description: "IP address of the upstream server handling the request (the last server contacted if there were several), in canonical form so it can be cast to inet, or the path of a unix socket",
 				Type:        "varchar",
 			},
+			{
+				ColumnName:  "upstream_port",
+				Description: "Port of the upstream server handling the request (the last server contacted if there were several)",
+				Type:        "integer",
+			},
 			{
 				ColumnName:  "upstream_status",
-				Description: "Status code returned by the upstream server",
+				Description: "Status code returned by the upstream server (the last server contacted if there were several)",
 				Type:        "integer",
 			},
 			{
-				ColumnName:  "upstream_connect_time",
-				Description: "Time spent establishing a connection with the upstream server",
-				Type:        "float",
+				ColumnName:  "upstream_status_class",
+				Description: "Class of the final status code returned by the upstream server (1xx, 2xx, 3xx, 4xx or 5xx)",
+				Type:        "varchar",
 			},
 			{
-				ColumnName:  "upstream_header_time",
-				Description: "Time between establishing a connection and receiving the first byte of the response header from the upstream server",
-				Type:        "float",
+				ColumnName:  "upstream_is_error",
+				Description: "True if the final status code returned by the upstream server is 400 or above",
+				Type:        "boolean",
 			},
 			{
-				ColumnName:  "upstream_response_time",
-				Description: "Time between establishing a connection and receiving the last byte of the response body from the upstream server",
-				Type:        "float",
+				ColumnName:  "upstream_connect_time_ms",
+				Description: "Time spent establishing a connection with the upstream server, in milliseconds",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "upstream_header_time_ms",
+				Description: "Time between establishing a connection and receiving the first byte of the response header from the upstream server, in milliseconds",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "upstream_response_time_ms",
+				Description: "Time between establishing a connection and receiving the last byte of the response body from the upstream server, in milliseconds",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "upstream_queue_time_ms",
+				Description: "Time the request spent in the upstream queue, in milliseconds",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "upstream_bytes_received",
+				Description: "Number of bytes received from the upstream server",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "upstream_bytes_sent",
+				Description: "Number of bytes sent to the upstream server",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "upstream_response_length",
+				Description: "Length of the response obtained from the upstream server, in bytes",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "upstream_cache_status",
+				Description: "Status of accessing the response cache (MISS, BYPASS, EXPIRED, STALE, UPDATING, REVALIDATED or HIT)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "cache_hit",
+				Description: "True if the response was served from the cache (HIT, STALE, UPDATING or REVALIDATED)",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "upstream_attempts",
+				Description: "Number of upstream servers contacted while processing the request",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "upstream_addr_values",
+				Description: "IP addresses, or unix socket paths, of all upstream servers contacted, in order",
+				Type:        "varchar[]",
+			},
+			{
+				ColumnName:  "upstream_port_values",
+				Description: "Ports of all upstream servers contacted, in order",
+				Type:        "integer[]",
+			},
+			{
+				ColumnName:  "upstream_status_values",
+				Description: "Status codes returned by all upstream servers contacted, in order",
+				Type:        "integer[]",
+			},
+			{
+				ColumnName:  "upstream_connect_time_ms_values",
+				Description: "Connection times for all upstream servers contacted, in order, in milliseconds",
+				Type:        "bigint[]",
+			},
+			{
+				ColumnName:  "upstream_header_time_ms_values",
+				Description: "Header times for all upstream servers contacted, in order, in milliseconds",
+				Type:        "bigint[]",
+			},
+			{
+				ColumnName:  "upstream_response_time_ms_values",
+				Description: "Response times for all upstream servers contacted, in order, in milliseconds",
+				Type:        "bigint[]",
+			},
+			{
+				ColumnName:  "upstream_queue_time_ms_values",
+				Description: "Queue times for all upstream servers contacted, in order, in milliseconds",
+				Type:        "bigint[]",
+			},
+			{
+				ColumnName:  "upstream_bytes_received_values",
+				Description: "Bytes received from all upstream servers contacted, in order",
+				Type:        "integer[]",
+			},
+			{
+				ColumnName:  "upstream_bytes_sent_values",
+				Description: "Bytes sent to all upstream servers contacted, in order",
+				Type:        "integer[]",
+			},
+			{
+				ColumnName:  "upstream_response_length_values",
+				Description: "Response lengths from all upstream servers contacted, in order",
+				Type:        "integer[]",
 			},
 			// additional ssl variables
 			{
@@ -224,14 +455,319 @@ func (c *AccessLogTable) GetTableDefinition() *schema.TableSchema {
 				Description: "Client certificate in PEM format",
 				Type:        "varchar",
 			},
+			{
+				ColumnName:  "ssl_client_raw_cert",
+				Description: "Client certificate in PEM format, without the tab continuation characters",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_escaped_cert",
+				Description: "Client certificate in URL encoded PEM format",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_cert_subject",
+				Description: "Subject of the client certificate, decoded from the PEM certificate",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_cert_issuer",
+				Description: "Issuer of the client certificate, decoded from the PEM certificate",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_cert_serial",
+				Description: "Serial number of the client certificate in hexadecimal, decoded from the PEM certificate",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_cert_san",
+				Description: "Subject alternative names (DNS names, email addresses, IP addresses and URIs) of the client certificate",
+				Type:        "varchar[]",
+			},
+			{
+				ColumnName:  "ssl_client_cert_not_before",
+				Description: "Start of the client certificate validity period",
+				Type:        "timestamp",
+			},
+			{
+				ColumnName:  "ssl_client_cert_not_after",
+				Description: "End of the client certificate validity period",
+				Type:        "timestamp",
+			},
+			{
+				ColumnName:  "ssl_client_cert_sha256_fingerprint",
+				Description: "SHA-256 fingerprint of the client certificate",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_session_reused",
+				Description: "True if the SSL session was reused",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "ssl_server_name",
+				Description: "Server name requested through SNI",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_curves",
+				Description: "List of curves supported by the client",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_early_data",
+				Description: "True if TLS 1.3 early data was used and the handshake is not complete",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "ssl_client_verify",
+				Description: "Result of client certificate verification (SUCCESS, FAILED:reason or NONE)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_s_dn",
+				Description: "Subject DN of the client certificate",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_i_dn",
+				Description: "Issuer DN of the client certificate",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_serial",
+				Description: "Serial number of the client certificate",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "ssl_client_fingerprint",
+				Description: "SHA1 fingerprint of the client certificate",
+				Type:        "varchar",
+			},
 			// additional miscellaneous variables
 			{
 				ColumnName:  "gzip_ratio",
 				Description: "Compression ratio achieved by gzip",
 				Type:        "float",
 			},
+			// additional core module variables
+			{
+				ColumnName:  "request_id",
+				Description: "Unique request identifier generated from 16 random bytes, in hexadecimal",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "uri",
+				Description: "Current URI in the request, normalized and decoded",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "document_uri",
+				Description: "Same as uri",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "document_root",
+				Description: "Root or alias directive's value for the current request",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "realpath_root",
+				Description: "Absolute pathname corresponding to the root or alias directive's value, with all symbolic links resolved",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "request_filename",
+				Description: "File path for the current request, based on the root or alias directives and the request URI",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "args",
+				Description: "Arguments in the request line",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "query_string",
+				Description: "Same as args",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "is_args",
+				Description: "True if the request line has arguments",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "request_body",
+				Description: "Request body, when read to a memory buffer",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "request_body_file",
+				Description: "Name of the temporary file holding the request body",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "request_completion",
+				Description: "True if the request has completed",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "remote_port",
+				Description: "Client port",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "binary_remote_addr",
+				Description: "Client address in binary form, decoded to an IP address",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "https",
+				Description: "True if the connection operates in SSL mode",
+				Type:        "boolean",
+			},
+			{
+				ColumnName:  "hostname",
+				Description: "Host name of the nginx server, or the hostname extracted from the log file path by the format's path_template if it is not logged",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "pid",
+				Description: "PID of the worker process",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "nginx_version",
+				Description: "Nginx version",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "connection_time_ms",
+				Description: "Connection time in milliseconds",
+				Type:        "bigint",
+			},
+			{
+				ColumnName:  "limit_rate",
+				Description: "Response rate limit, in bytes per second",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "proxy_protocol_addr",
+				Description: "Client IP address from the PROXY protocol header, in canonical form so it can be cast to inet",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "proxy_protocol_port",
+				Description: "Client port from the PROXY protocol header",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "proxy_protocol_server_addr",
+				Description: "Server IP address from the PROXY protocol header, in canonical form so it can be cast to inet",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "proxy_protocol_server_port",
+				Description: "Server port from the PROXY protocol header",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "tcpinfo_rtt",
+				Description: "Round trip time of the client connection, in microseconds",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "tcpinfo_rttvar",
+				Description: "Round trip time variance of the client connection, in microseconds",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "tcpinfo_snd_cwnd",
+				Description: "Send congestion window of the client connection",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "tcpinfo_rcv_space",
+				Description: "Receive space of the client connection",
+				Type:        "integer",
+			},
+			{
+				ColumnName:  "http_x_forwarded_for",
+				Description: "Value of the 'X-Forwarded-For' request header",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "http_x_real_ip",
+				Description: "Value of the 'X-Real-IP' request header",
+				Type:        "varchar",
+			},
+			// http2 and http3 module variables
+			{
+				ColumnName:  "http2",
+				Description: "Negotiated HTTP/2 protocol identifier (h2 for HTTP/2 over TLS, h2c for HTTP/2 over cleartext TCP)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "http3",
+				Description: "Negotiated HTTP/3 protocol identifier (h3)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "quic",
+				Description: "True if the request was made over QUIC",
+				Type:        "boolean",
+			},
+			// limit_req and limit_conn module variables
+			{
+				ColumnName:  "limit_req_status",
+				Description: "Result of request rate limiting (PASSED, DELAYED, REJECTED, DELAYED_DRY_RUN or REJECTED_DRY_RUN)",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "limit_conn_status",
+				Description: "Result of connection limiting (PASSED, REJECTED or REJECTED_DRY_RUN)",
+				Type:        "varchar",
+			},
+			// realip module variables
+			{
+				ColumnName:  "realip_remote_addr",
+				Description: "Original client IP address, before it was replaced by the realip module, in canonical form so it can be cast to inet",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "realip_remote_port",
+				Description: "Original client port, before it was replaced by the realip module",
+				Type:        "integer",
+			},
+			// partition metadata, populated when the format sets path_template
+			{
+				ColumnName:  "environment",
+				Description: "Environment extracted from the log file path by the format's path_template",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "vhost",
+				Description: "Virtual host extracted from the log file path by the format's path_template",
+				Type:        "varchar",
+			},
+			{
+				ColumnName:  "file_date",
+				Description: "Date extracted from the log file path by the format's path_template, or from its logrotate date suffix",
+				Type:        "date",
+			},
+			// attack detection, populated when the format enables detect_attacks
+			{
+				ColumnName:  "attack_categories",
+				Description: "Categories of web attack signatures matched by the request (sqli, xss, lfi, rfi, command_injection, scanner)",
+				Type:        "varchar[]",
+			},
+			{
+				ColumnName:  "matched_rules",
+				Description: "Identifiers of the web attack signatures matched by the request",
+				Type:        "varchar[]",
+			},
 		},
-		NullIf: AccessLogTableNilValue,
 	}
 }
 
@@ -252,32 +788,79 @@ func (c *AccessLogTable) GetSourceMetadata() ([]*table.SourceMetadata[*types.Dyn
 				artifact_source.WithRowPerLine(),
 			},
 		},
+		{
+			// the nginx log file source, which handles rotated and compressed files
+			SourceName: log_file.LogFileSourceIdentifier,
+			Mapper:     mapper,
+		},
 	}, nil
 }
 
 func (c *AccessLogTable) EnrichRow(row *types.DynamicRow, sourceEnrichmentFields schema.SourceEnrichment) (*types.DynamicRow, error) {
 	var invalidFields []string
 
-	// tp_timestamp can be parsed from time_local OR time_iso8601
+	// apply redaction before any other enrichment, so no later enrichment sees the original values
+	if c.redactor != nil {
+		source := make(map[string]string, len(c.redactor.sourceFields))
+		for _, field := range c.redactor.sourceFields {
+			if v, ok := row.GetSourceValue(field); ok {
+				source[field] = v
+			}
+		}
+		if err := row.InitialiseFromMap(c.redactor.redact(source)); err != nil {
+			return nil, err
+		}
+	}
+
+	// tp_timestamp can be parsed from time_local OR time_iso8601, and is normalized to UTC
+	// the offset the time was logged with is kept in time_zone
 	// We don't have a fallback for Source so we should populate prior to calling c.CustomTableImpl.EnrichRow
 	// if neither are set in the source, the base call will throw the missing fields error for tp_timestamp/tp_date
-	if ts, ok := row.GetSourceValue("time_local"); ok && ts != AccessLogTableNilValue {
-		t, err := helpers.ParseTime(ts)
+	timeZone, timeZoneSet, err := c.rowTimeZone(sourceEnrichmentFields)
+	if err != nil {
+		return nil, err
+	}
+	if ts, ok := row.GetSourceValue("time_local"); ok && !isNullValue(ts) {
+		t, err := parseTimeLocal(ts, timeZone)
+		if err != nil {
+			// a time logged without a date is on the date of the log file, if the file is dated
+			if date, ok := c.fileDate(sourceEnrichmentFields); ok {
+				t, err = parseTimeOfDay(ts, date, timeZone)
+			}
+		}
 		if err != nil {
 			invalidFields = append(invalidFields, "time_local")
 		} else {
-			row.OutputColumns[constants.TpTimestamp] = t
+			setLoggedTime(row, t, timeZone, timeZoneSet)
 		}
 	}
-	if ts, ok := row.GetSourceValue("time_iso8601"); ok && ts != AccessLogTableNilValue {
-		t, err := helpers.ParseTime(ts)
+	if ts, ok := row.GetSourceValue("time_iso8601"); ok && !isNullValue(ts) {
+		t, err := parseTimeISO8601(ts, timeZone)
 		if err != nil {
 			invalidFields = append(invalidFields, "time_iso8601")
+		} else {
+			setLoggedTime(row, t, timeZone, timeZoneSet)
+		}
+	}
+
+	// msec is the most precise time available, so takes precedence if present
+	if msec, ok := row.GetSourceValue("msec"); ok && !isNullValue(msec) {
+		t, err := parseMsec(msec)
+		if err != nil {
+			invalidFields = append(invalidFields, "msec")
 		} else {
 			row.OutputColumns[constants.TpTimestamp] = t
 		}
 	}
 
+	// client certificate metadata, which is not extracted from a redacted certificate
+	enrichClientCert(row, c.redactor)
+	if format := c.accessLogFormat(); format != nil && format.DropSSLClientCert {
+		for _, field := range clientCertFields {
+			row.OutputColumns[field] = nil
+		}
+	}
+
 	if len(invalidFields) > 0 {
 		return nil, error_types.NewRowErrorWithFields([]string{}, invalidFields)
 	}
@@ -285,15 +868,46 @@ func (c *AccessLogTable) EnrichRow(row *types.DynamicRow, sourceEnrichmentFields
 	// Enrich Array Based TP Fields as we don't have a mechanism to do this via direct mapping
 
 	//tp_ips
+	// addresses with no value are null, and are not included
 	var ips []string
-	if remoteAddr, ok := row.GetSourceValue("remote_addr"); ok {
-		ips = append(ips, remoteAddr)
+	if remoteAddr, ok := row.GetSourceValue("remote_addr"); ok && !isNullValue(remoteAddr) {
+		if ip, valid := normalizeIP(remoteAddr); valid {
+			ips = append(ips, ip)
+
+			ipType := classifyIP(ip)
+			row.OutputColumns[constants.TpSourceIP] = ip
+			row.OutputColumns["remote_addr_type"] = ipType
+			row.OutputColumns["remote_addr_is_internal"] = isInternalIpType(ipType)
+		} else {
+			row.OutputColumns[constants.TpSourceIP] = nil
+		}
+	} else if ok {
+		row.OutputColumns[constants.TpSourceIP] = nil
 	}
-	if serverAddr, ok := row.GetSourceValue("server_addr"); ok {
-		ips = append(ips, serverAddr)
+	if serverAddr, ok := row.GetSourceValue("server_addr"); ok && !isNullValue(serverAddr) {
+		if ip, valid := normalizeIP(serverAddr); valid {
+			ips = append(ips, ip)
+			row.OutputColumns[constants.TpDestinationIP] = ip
+		}
 	}
-	if upstreamAddr, ok := row.GetSourceValue("upstream_addr"); ok {
-		ips = append(ips, upstreamAddr)
+	for _, field := range []string{"realip_remote_addr", "proxy_protocol_addr"} {
+		if addr, ok := row.GetSourceValue(field); ok && !isNullValue(addr) {
+			if ip, valid := normalizeIP(addr); valid && !slices.Contains(ips, ip) {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if binaryAddr, ok := row.GetSourceValue("binary_remote_addr"); ok && !isNullValue(binaryAddr) {
+		if ip, valid := decodeBinaryAddr(binaryAddr); valid {
+			row.OutputColumns["binary_remote_addr"] = ip
+		}
+	}
+	if upstreamAddr, ok := row.GetSourceValue("upstream_addr"); ok && !isNullValue(upstreamAddr) {
+		for _, addr := range splitUpstreamValues(upstreamAddr) {
+			if ip, valid := normalizeIP(addr); valid {
+				ips = append(ips, ip)
+			}
+		}
 	}
 	if len(ips) > 0 {
 		row.OutputColumns[constants.TpIps] = ips
@@ -301,10 +915,10 @@ func (c *AccessLogTable) EnrichRow(row *types.DynamicRow, sourceEnrichmentFields
 
 	// tp_domains
 	var domains []string
-	if host, ok := row.GetSourceValue("host"); ok && host != AccessLogTableNilValue {
+	if host, ok := row.GetSourceValue("host"); ok && !isNullValue(host) {
 		domains = append(domains, host)
 	}
-	if httpHost, ok := row.GetSourceValue("http_host"); ok && httpHost != AccessLogTableNilValue {
+	if httpHost, ok := row.GetSourceValue("http_host"); ok && !isNullValue(httpHost) {
 		domains = append(domains, httpHost)
 	}
 	if len(domains) > 0 {
@@ -314,13 +928,114 @@ func (c *AccessLogTable) EnrichRow(row *types.DynamicRow, sourceEnrichmentFields
 
 	// tp_usernames
 	var usernames []string
-	if remoteUser, ok := row.GetSourceValue("remote_user"); ok && remoteUser != AccessLogTableNilValue {
+	if remoteUser, ok := row.GetSourceValue("remote_user"); ok && !isNullValue(remoteUser) {
 		usernames = append(usernames, remoteUser)
 	}
 	if len(usernames) > 0 {
 		row.OutputColumns[constants.TpUsernames] = usernames
 	}
 
+	// canonical ip addresses
+	enrichAddresses(row)
+
+	// status derived fields
+	enrichStatus(row)
+
+	// boolean flags
+	enrichFlags(row)
+
+	// upstream multi-value variables and cache status
+	enrichUpstream(row)
+
+	// timings in milliseconds
+	enrichTimings(row)
+
+	// normalized http version
+	enrichProtocol(row)
+
+	// connection correlation keys
+	enrichConnection(row, sourceEnrichmentFields.Metadata[log_file.HostnameMetadataKey])
+
+	// visitor sessions
+	if c.sessionizer != nil {
+		c.sessionizer.enrichSession(row, typehelpers.SafeString(sourceEnrichmentFields.CommonFields.TpSourceLocation))
+	}
+
+	// attack signatures
+	if format := c.accessLogFormat(); format != nil && format.DetectAttacks {
+		fields := make(map[string]string, len(allAttackFields))
+		for _, field := range allAttackFields {
+			if value, ok := row.GetSourceValue(field); ok {
+				fields[field] = value
+			}
+		}
+		if categories, rules := detectAttacks(fields); len(rules) > 0 {
+			row.OutputColumns["attack_categories"] = categories
+			row.OutputColumns["matched_rules"] = rules
+		}
+	}
+
+	// partition metadata from the file path
+	if c.pathTemplate != nil {
+		c.pathTemplate.enrichPath(row, sourceEnrichmentFields)
+	}
+
+	// null any remaining columns whose variable has no value
+	applyNullValues(row, c.Schema)
+
 	// now call the base class to do the rest of the enrichment
 	return c.CustomTableImpl.EnrichRow(row, sourceEnrichmentFields)
 }
+
+// setLoggedTime populates tp_timestamp and the time zone columns from a time parsed from the log
+// the logged offset can only be checked against a time zone which has been set
+func setLoggedTime(row *types.DynamicRow, t time.Time, timeZone *time.Location, timeZoneSet bool) {
+	row.OutputColumns[constants.TpTimestamp] = t.UTC()
+	row.OutputColumns["time_zone"] = timeZoneOffset(t)
+	if timeZoneSet {
+		row.OutputColumns["time_zone_mismatch"] = isTimeZoneMismatch(t, timeZone)
+	}
+}
+
+// rowTimeZone returns the time zone of times logged without an offset, and whether it has been set
+//
+// this is the format's default_time_zone if set, otherwise the default_time_zone of the nginx_log_file source the
+// row was collected by, as used by the nginx_error_log table, otherwise UTC
+func (c *AccessLogTable) rowTimeZone(sourceEnrichmentFields schema.SourceEnrichment) (*time.Location, bool, error) {
+	if c.timeZone != nil {
+		return c.timeZone, true, nil
+	}
+	name := sourceEnrichmentFields.Metadata[log_file.DefaultTimeZoneMetadataKey]
+	if name == "" {
+		return time.UTC, false, nil
+	}
+	timeZone, err := log_parse.ParseTimeZone(name)
+	if err != nil {
+		return nil, false, err
+	}
+	return timeZone, true, nil
+}
+
+// fileDate returns the date of the log file the row was collected from, from the {date} field of the format's
+// path_template
+//
+// the date of a file rotated with dateext is not used, as it is the date the file was rotated, which is usually
+// the day after the lines were logged
+func (c *AccessLogTable) fileDate(sourceEnrichmentFields schema.SourceEnrichment) (time.Time, bool) {
+	location := typehelpers.SafeString(sourceEnrichmentFields.CommonFields.TpSourceLocation)
+	if c.pathTemplate == nil || !c.pathTemplate.hasDate() || location == "" {
+		return time.Time{}, false
+	}
+	fields, ok := c.pathTemplate.match(location)
+	if !ok {
+		return time.Time{}, false
+	}
+	return parseFileDate(fields["file_date"])
+}
+
+// accessLogFormat returns the table format as an AccessLogTableFormat,
+// or nil if the table is using another format type (e.g. a regex)
+func (c *AccessLogTable) accessLogFormat() *AccessLogTableFormat {
+	format, _ := c.Format.(*AccessLogTableFormat)
+	return format
+}
@@ -0,0 +1,113 @@
+package access_log
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// attack categories written to the attack_categories column
+const (
+	AttackCategorySQLi             = "sqli"
+	AttackCategoryXSS              = "xss"
+	AttackCategoryLFI              = "lfi"
+	AttackCategoryRFI              = "rfi"
+	AttackCategoryCommandInjection = "command_injection"
+	AttackCategoryScanner          = "scanner"
+)
+
+// attackSignature is a single detection rule, matched against one or more source fields
+type attackSignature struct {
+	// the rule identifier, written to the matched_rules column
+	ID       string
+	Category string
+	// the source fields the rule is evaluated against
+	Fields  []string
+	Pattern *regexp.Regexp
+}
+
+var (
+	requestFields   = []string{"request_uri", "http_referer"}
+	userAgentFields = []string{"http_user_agent"}
+	allAttackFields = []string{"request_uri", "http_referer", "http_user_agent"}
+)
+
+// attackSignatures is the embedded signature set used when attack detection is enabled
+var attackSignatures = []attackSignature{
+	// SQL injection
+	{ID: "sqli_union_select", Category: AttackCategorySQLi, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)\bunion\b[\s/*]+(all[\s/*]+)?select\b`)},
+	{ID: "sqli_tautology", Category: AttackCategorySQLi, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)['"]\s*(or|and)\s+['"]?\w+['"]?\s*=\s*['"]?\w+|\b(or|and)\s+1\s*=\s*1\b`)},
+	{ID: "sqli_comment_terminator", Category: AttackCategorySQLi, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)['"]\s*(--|#|/\*)`)},
+	{ID: "sqli_stacked_query", Category: AttackCategorySQLi, Fields: requestFields, Pattern: regexp.MustCompile(`(?i);\s*(drop|delete|insert|update|alter|create|truncate|exec)\b`)},
+	{ID: "sqli_time_based", Category: AttackCategorySQLi, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)\b(sleep|benchmark|pg_sleep)\s*\(|\bwaitfor\s+delay\b`)},
+	{ID: "sqli_schema_probe", Category: AttackCategorySQLi, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)\binformation_schema\b|\b(load_file|into\s+(out|dump)file)\b`)},
+
+	// cross site scripting
+	{ID: "xss_script_tag", Category: AttackCategoryXSS, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)<\s*/?\s*script\b`)},
+	{ID: "xss_event_handler", Category: AttackCategoryXSS, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)<[^>]*\bon(error|load|mouseover|focus|click)\s*=`)},
+	{ID: "xss_javascript_uri", Category: AttackCategoryXSS, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)\b(javascript|vbscript)\s*:`)},
+	{ID: "xss_dangerous_tag", Category: AttackCategoryXSS, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)<\s*(iframe|svg|object|embed|img)\b[^>]*>`)},
+
+	// local file inclusion / path traversal
+	{ID: "lfi_path_traversal", Category: AttackCategoryLFI, Fields: requestFields, Pattern: regexp.MustCompile(`(\.\.[/\\]){2,}`)},
+	{ID: "lfi_sensitive_file", Category: AttackCategoryLFI, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)/etc/(passwd|shadow|hosts)\b|\bboot\.ini\b|\bwin\.ini\b|/proc/self/`)},
+	{ID: "lfi_php_wrapper", Category: AttackCategoryLFI, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)\b(php|file|zip|phar|data|expect)://`)},
+
+	// remote file inclusion
+	{ID: "rfi_remote_url_param", Category: AttackCategoryRFI, Fields: []string{"request_uri"}, Pattern: regexp.MustCompile(`(?i)[?&][^=&]*=(https?|ftp)://[^&]*\.(php|txt|sh|pl)\b`)},
+
+	// command injection
+	// the command must be followed by an argument, the end of the value or another command, so a query parameter
+	// named after a command (e.g. '&id=42') is not matched
+	// a single '&' also separates query parameters, so a command after it must be followed by an argument or another
+	// command, and a trailing parameter with no value (e.g. '?sort=price&id') is not matched
+	{ID: "cmdi_shell_metachar", Category: AttackCategoryCommandInjection, Fields: requestFields, Pattern: regexp.MustCompile(`(?i)(&&|[;|` + "`" + `])\s*(cat|ls|id|whoami|uname|wget|curl|nc|bash|sh|ping)(\s|$|[;|<>/` + "`" + `])|&\s*(cat|ls|id|whoami|uname|wget|curl|nc|bash|sh|ping)(\s|[;|<>/` + "`" + `])`)},
+	{ID: "cmdi_subshell", Category: AttackCategoryCommandInjection, Fields: requestFields, Pattern: regexp.MustCompile(`\$\([^)]*\)|\$\{[^}]*\}`)},
+	{ID: "cmdi_shellshock", Category: AttackCategoryCommandInjection, Fields: allAttackFields, Pattern: regexp.MustCompile(`\(\)\s*\{\s*:;\s*\}`)},
+	{ID: "cmdi_jndi_lookup", Category: AttackCategoryCommandInjection, Fields: allAttackFields, Pattern: regexp.MustCompile(`(?i)\$\{jndi:`)},
+
+	// known scanner user agents
+	{ID: "scanner_user_agent", Category: AttackCategoryScanner, Fields: userAgentFields, Pattern: regexp.MustCompile(`(?i)\b(sqlmap|nikto|nmap|masscan|zgrab|nuclei|wpscan|dirbuster|gobuster|ffuf|acunetix|nessus|openvas|w3af|burp|zap|arachni|whatweb|jaeles)\b`)},
+}
+
+// detectAttacks evaluates the signature set against the given source field values
+// and returns the distinct attack categories and the IDs of the rules which matched
+func detectAttacks(fields map[string]string) (categories []string, rules []string) {
+	// decode each field once
+	decoded := make(map[string]string, len(fields))
+	for name, value := range fields {
+		if isNullValue(value) {
+			continue
+		}
+		decoded[name] = decodeAttackValue(value)
+	}
+
+	for _, sig := range attackSignatures {
+		for _, field := range sig.Fields {
+			value, ok := decoded[field]
+			if !ok || !sig.Pattern.MatchString(value) {
+				continue
+			}
+			rules = append(rules, sig.ID)
+			if !slices.Contains(categories, sig.Category) {
+				categories = append(categories, sig.Category)
+			}
+			break
+		}
+	}
+	return categories, rules
+}
+
+// decodeAttackValue percent-decodes a value (twice, to catch double encoding) so that
+// signatures can be written against the plain text form
+func decodeAttackValue(value string) string {
+	for range 2 {
+		unescaped, err := url.QueryUnescape(value)
+		if err != nil || unescaped == value {
+			break
+		}
+		value = unescaped
+	}
+	return strings.ReplaceAll(value, `\"`, `"`)
+}
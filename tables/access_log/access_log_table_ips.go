@@ -0,0 +1,178 @@
+package access_log
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// ip address classifications used for the remote_addr_type column
+const (
+	IpTypeLoopback    = "loopback"
+	IpTypePrivate     = "private"
+	IpTypeLinkLocal   = "link_local"
+	IpTypeCGNAT       = "cgnat"
+	IpTypeMulticast   = "multicast"
+	IpTypeUnspecified = "unspecified"
+	IpTypeReserved    = "reserved"
+	IpTypePublic      = "public"
+)
+
+// reservedPrefixes are address ranges which are neither private nor publicly routable
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("100::/64"),
+}
+
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// addressColumns are the columns holding a single IP address, keyed by column name, with the column holding the
+// port of the same address
+// addresses are output in the canonical form returned by normalizeIP so they can be cast to inet, and any port
+// logged with an address is output to the port column - values which are not IP addresses (e.g. 'unix:' or
+// redacted values) are kept as logged
+var addressColumns = map[string]string{
+	"remote_addr":                "remote_port",
+	"server_addr":                "server_port",
+	"realip_remote_addr":         "realip_remote_port",
+	"proxy_protocol_addr":        "proxy_protocol_port",
+	"proxy_protocol_server_addr": "proxy_protocol_server_port",
+}
+
+// enrichAddresses outputs the address columns present in the row in canonical form, and the port of each address
+// logged with one, unless the port is also logged by its own variable
+func enrichAddresses(row *types.DynamicRow) {
+	for column, portColumn := range addressColumns {
+		value, ok := row.GetSourceValue(column)
+		if !ok {
+			continue
+		}
+		if ip, valid := normalizeIP(value); valid {
+			row.OutputColumns[column] = ip
+		}
+		if _, port := splitAddress(value); port != nil {
+			if _, logged := row.GetSourceValue(portColumn); !logged {
+				row.OutputColumns[portColumn] = port
+			}
+		}
+	}
+}
+
+// splitAddress splits an address as written by nginx into the IP, in the canonical form returned by normalizeIP,
+// and the port, if it has one
+// values which are not IP addresses (e.g. unix sockets) are returned as logged, with no port
+func splitAddress(value string) (addr, port any) {
+	if isNullValue(value) {
+		return nil, nil
+	}
+	ip, valid := normalizeIP(value)
+	if !valid {
+		return value, nil
+	}
+	if _, p, err := net.SplitHostPort(strings.TrimSpace(value)); err == nil {
+		if n, err := strconv.ParseUint(p, 10, 16); err == nil {
+			return ip, int64(n)
+		}
+	}
+	return ip, nil
+}
+
+// normalizeIP validates an address as written by nginx and returns the bare IP
+// it strips any port and IPv6 brackets, and rejects unix sockets and other non-IP values
+func normalizeIP(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if isNullValue(value) || strings.HasPrefix(value, "unix:") {
+		return "", false
+	}
+
+	// try as a plain address first - this also handles IPv6 addresses without brackets
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap().WithZone("").String(), true
+	}
+
+	// then try host:port / [host]:port
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", false
+	}
+	return addr.Unmap().WithZone("").String(), true
+}
+
+// classifyIP returns the address classification for a normalized IP
+func classifyIP(value string) string {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case addr.IsUnspecified():
+		return IpTypeUnspecified
+	case addr.IsLoopback():
+		return IpTypeLoopback
+	case addr.IsLinkLocalUnicast():
+		return IpTypeLinkLocal
+	case addr.IsMulticast(), addr.IsLinkLocalMulticast(), addr.IsInterfaceLocalMulticast():
+		return IpTypeMulticast
+	case addr.IsPrivate():
+		return IpTypePrivate
+	case cgnatPrefix.Contains(addr):
+		return IpTypeCGNAT
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return IpTypeReserved
+		}
+	}
+
+	return IpTypePublic
+}
+
+// splitUpstreamValues splits a multi-value upstream variable
+// nginx separates values for servers tried in turn with ", " and values for internal redirects between upstream groups with " : "
+func splitUpstreamValues(value string) []string {
+	var res []string
+	for _, group := range strings.Split(value, " : ") {
+		for _, v := range strings.Split(group, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				res = append(res, v)
+			}
+		}
+	}
+	return res
+}
+
+// isInternalIpType returns true for address classifications which are not reachable from the public internet
+func isInternalIpType(ipType string) bool {
+	switch ipType {
+	case IpTypeLoopback, IpTypePrivate, IpTypeLinkLocal, IpTypeCGNAT:
+		return true
+	default:
+		return false
+	}
+}
+
+// decodeBinaryAddr decodes $binary_remote_addr, as escaped by nginx in the access log, to an IP address
+func decodeBinaryAddr(value string) (string, bool) {
+	addr, ok := netip.AddrFromSlice([]byte(unescapeLogValue(value)))
+	if !ok {
+		return "", false
+	}
+	return addr.Unmap().String(), true
+}
@@ -0,0 +1,171 @@
+package access_log
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_normalizeIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   string
+		wantOk bool
+	}{
+		{name: "IPv4", value: "192.168.1.5", want: "192.168.1.5", wantOk: true},
+		{name: "IPv4 with port", value: "192.168.1.10:80", want: "192.168.1.10", wantOk: true},
+		{name: "IPv6", value: "2001:db8::1", want: "2001:db8::1", wantOk: true},
+		{name: "IPv6 bracketed with port", value: "[2001:db8::1]:8080", want: "2001:db8::1", wantOk: true},
+		{name: "IPv6 bracketed", value: "[::1]", want: "::1", wantOk: true},
+		{name: "IPv4 mapped IPv6", value: "::ffff:10.0.0.1", want: "10.0.0.1", wantOk: true},
+		{name: "nil value", value: "-", wantOk: false},
+		{name: "empty", value: "", wantOk: false},
+		{name: "unix socket", value: "unix:/var/run/app.sock", wantOk: false},
+		{name: "hostname", value: "backend.local:80", wantOk: false},
+		{name: "invalid octets", value: "123.456.123.456", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := normalizeIP(tt.value)
+			if ok != tt.wantOk {
+				t.Fatalf("normalizeIP(%q) ok = %v, want %v", tt.value, ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeIP(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_enrichAddresses(t *testing.T) {
+	row := &types.DynamicRow{}
+	if err := row.InitialiseFromMap(map[string]string{
+		"remote_addr":                "2001:0db8:0000:0000:0000:0000:0000:0001",
+		"server_addr":                "::ffff:10.0.0.5",
+		"realip_remote_addr":         "unix:",
+		"proxy_protocol_addr":        "fe80::1%eth0",
+		"proxy_protocol_server_addr": "-",
+		"upstream_addr":              "10.0.1.10:8080",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enrichAddresses(row)
+
+	// values which are not IP addresses are left to the schema mapping
+	want := map[string]any{
+		"remote_addr":         "2001:db8::1",
+		"server_addr":         "10.0.0.5",
+		"proxy_protocol_addr": "fe80::1",
+	}
+	if !reflect.DeepEqual(row.OutputColumns, want) {
+		t.Errorf("got %v, want %v", row.OutputColumns, want)
+	}
+
+	// a port logged with an address is output to the port column, unless the port is also logged
+	row = &types.DynamicRow{}
+	if err := row.InitialiseFromMap(map[string]string{
+		"remote_addr":         "[2001:db8::1]:51234",
+		"server_addr":         "10.0.0.5:443",
+		"server_port":         "8443",
+		"proxy_protocol_addr": "192.0.2.1:99999",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enrichAddresses(row)
+
+	want = map[string]any{
+		"remote_addr":         "2001:db8::1",
+		"remote_port":         int64(51234),
+		"server_addr":         "10.0.0.5",
+		"proxy_protocol_addr": "192.0.2.1",
+	}
+	if !reflect.DeepEqual(row.OutputColumns, want) {
+		t.Errorf("got %v, want %v", row.OutputColumns, want)
+	}
+}
+
+func Test_splitAddress(t *testing.T) {
+	tests := []struct {
+		value    string
+		wantAddr any
+		wantPort any
+	}{
+		{value: "10.0.1.10:8080", wantAddr: "10.0.1.10", wantPort: int64(8080)},
+		{value: "[2001:db8::10]:443", wantAddr: "2001:db8::10", wantPort: int64(443)},
+		{value: "2001:db8::10", wantAddr: "2001:db8::10"},
+		{value: "::ffff:10.0.0.5", wantAddr: "10.0.0.5"},
+		{value: "10.0.1.10", wantAddr: "10.0.1.10"},
+		{value: "unix:/run/php/php8.3-fpm.sock", wantAddr: "unix:/run/php/php8.3-fpm.sock"},
+		{value: "backend:8080", wantAddr: "backend:8080"},
+		{value: "-"},
+		{value: ""},
+	}
+	for _, tt := range tests {
+		addr, port := splitAddress(tt.value)
+		if addr != tt.wantAddr || port != tt.wantPort {
+			t.Errorf("splitAddress(%q): got %v, %v, want %v, %v", tt.value, addr, port, tt.wantAddr, tt.wantPort)
+		}
+	}
+}
+
+func Test_classifyIP(t *testing.T) {
+	tests := map[string]string{
+		"127.0.0.1":     IpTypeLoopback,
+		"::1":           IpTypeLoopback,
+		"10.1.2.3":      IpTypePrivate,
+		"172.16.0.1":    IpTypePrivate,
+		"192.168.0.1":   IpTypePrivate,
+		"fd00::1":       IpTypePrivate,
+		"169.254.1.1":   IpTypeLinkLocal,
+		"fe80::1":       IpTypeLinkLocal,
+		"100.64.0.1":    IpTypeCGNAT,
+		"224.0.0.1":     IpTypeMulticast,
+		"0.0.0.0":       IpTypeUnspecified,
+		"203.0.113.1":   IpTypeReserved,
+		"2001:db8::1":   IpTypeReserved,
+		"8.8.8.8":       IpTypePublic,
+		"2606:4700::11": IpTypePublic,
+		"not-an-ip":     "",
+	}
+	for ip, want := range tests {
+		if got := classifyIP(ip); got != want {
+			t.Errorf("classifyIP(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func Test_splitUpstreamValues(t *testing.T) {
+	tests := map[string][]string{
+		"10.0.0.1:80":                             {"10.0.0.1:80"},
+		"10.0.0.1:80, 10.0.0.2:80":                {"10.0.0.1:80", "10.0.0.2:80"},
+		"10.0.0.1:80, 10.0.0.2:80 : unix:/a.sock": {"10.0.0.1:80", "10.0.0.2:80", "unix:/a.sock"},
+		"10.0.0.1:80,":                            {"10.0.0.1:80"},
+		"":                                        nil,
+	}
+	for value, want := range tests {
+		if got := splitUpstreamValues(value); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitUpstreamValues(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func Test_decodeBinaryAddr(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   string
+		wantOk bool
+	}{
+		{value: `\x0A\x00\x00A`, want: "10.0.0.65", wantOk: true},
+		{value: `\x7F\x00\x00\x01`, want: "127.0.0.1", wantOk: true},
+		{value: `\x20\x01\x0D\xB8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01`, want: "2001:db8::1", wantOk: true},
+		{value: `\x0A\x00`, wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := decodeBinaryAddr(tt.value)
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("decodeBinaryAddr(%q) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package access_log
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// a quoted variable with no value is captured as an empty quoted string by mappers which do not strip the quotes,
+// e.g. a regex format, or a layout which does not quote the variable
+const emptyQuotedValue = `""`
+
+// nullValues are the values nginx writes for a variable with no value: '-', nothing if the format uses
+// escape=json or escape=none, or an empty quoted string
+var nullValues = []string{AccessLogTableNilValue, "", emptyQuotedValue}
+
+// isNullValue returns true if a variable has no value, i.e. is '-', empty or an empty quoted string
+func isNullValue(value string) bool {
+	return slices.Contains(nullValues, value)
+}
+
+// applyNullValues sets each column whose source value has no value to null, unless the column has already been
+// populated by enrichment
+//
+// this is the only null handling of the table, rather than a null_if on each column, as a column's null_if only
+// matches a single value
+func applyNullValues(row *types.DynamicRow, tableSchema *schema.TableSchema) {
+	for _, column := range tableSchema.Columns {
+		if _, ok := row.OutputColumns[column.ColumnName]; ok || column.Transform != "" || !nullableType(column.Type) {
+			continue
+		}
+		if value, ok := row.GetSourceValue(columnSourceName(column)); ok && isNullValue(value) {
+			row.OutputColumns[column.ColumnName] = nil
+		}
+	}
+}
+
+// columnSourceName returns the name of the source field a column is mapped from
+func columnSourceName(column *schema.ColumnSchema) string {
+	if column.SourceName != "" {
+		return column.SourceName
+	}
+	return column.ColumnName
+}
+
+// nullableType returns true if a column of the type may be mapped directly from a variable with no value
+//
+// a varchar column would store the null value as a string, and a numeric or boolean column would fail to convert it
+// time and list columns are only populated by enrichment, which handles the null values itself
+func nullableType(columnType string) bool {
+	columnType = strings.ToLower(columnType)
+	switch {
+	case strings.HasSuffix(columnType, "[]"):
+		return false
+	case columnType == "timestamp", columnType == "date", columnType == "time":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package access_log
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// enrichLine collects a single line written with the layout through the table, returning the typed row
+func enrichLine(t *testing.T, layout, line string) map[string]any {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte(line+"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res := collectArtifact(t, &AccessLogTableFormat{Name: "test", Layout: layout}, path)
+	if len(res.rows) != 1 {
+		t.Fatalf("line %q: got %d rows and row errors for %q, want 1 row", line, len(res.rows), res.errors)
+	}
+	return res.rows[0]
+}
+
+func Test_isNullValue(t *testing.T) {
+	for value, want := range map[string]bool{
+		"-":   true,
+		"":    true,
+		`""`:  true,
+		"--":  false,
+		" ":   false,
+		"0":   false,
+		"foo": false,
+	} {
+		if got := isNullValue(value); got != want {
+			t.Errorf("isNullValue(%q): got %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestAccessLogTable_GetTableDefinition_NullIf(t *testing.T) {
+	// null values are handled by applyNullValues, so no column has a null_if
+	tableSchema := (&AccessLogTable{}).GetTableDefinition()
+	if tableSchema.NullIf != "" {
+		t.Errorf("got table null_if %q, want none", tableSchema.NullIf)
+	}
+	for _, column := range tableSchema.Columns {
+		if column.NullIf != "" {
+			t.Errorf("%s: got null_if %q, want none", column.ColumnName, column.NullIf)
+		}
+	}
+}
+
+func Test_nullableType(t *testing.T) {
+	for columnType, want := range map[string]bool{
+		"varchar":   true,
+		"bigint":    true,
+		"float":     true,
+		"boolean":   true,
+		"":          true,
+		"timestamp": false,
+		"date":      false,
+		"integer[]": false,
+		"varchar[]": false,
+	} {
+		if got := nullableType(columnType); got != want {
+			t.Errorf("nullableType(%q): got %v, want %v", columnType, got, want)
+		}
+	}
+}
+
+func TestAccessLogTable_EnrichRow_NullValues(t *testing.T) {
+	layout := `$remote_addr $server_addr "$upstream_addr" "$upstream_status" "$upstream_response_time" "$gzip_ratio" "$content_length" "$http_user_agent" [$time_local] "$request" $status`
+
+	// nginx writes '-' for variables with no value
+	row := enrichLine(t, layout, `- - "-" "-" "-" "-" "-" "-" [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200`)
+	assertColumns(t, row, map[string]any{
+		constants.TpSourceIP:        nil,
+		constants.TpDestinationIP:   nil,
+		constants.TpIps:             nil,
+		"remote_addr":               nil,
+		"remote_addr_type":          nil,
+		"server_addr":               nil,
+		"upstream_addr":             nil,
+		"upstream_addr_values":      nil,
+		"upstream_status":           nil,
+		"upstream_response_time_ms": nil,
+		"upstream_attempts":         nil,
+		"gzip_ratio":                nil,
+		"content_length":            nil,
+		"status":                    int64(200),
+		"http_user_agent":           nil,
+	})
+
+	// formats using escape=json write nothing for variables with no value
+	row = enrichLine(t, `$remote_addr $server_addr "$upstream_addr" "$upstream_status" "$upstream_response_time" "$http_user_agent" [$time_local] "$request" $status`,
+		`10.0.0.1 10.0.0.2 "" "" "" "" [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200`)
+	assertColumns(t, row, map[string]any{
+		constants.TpIps:             []any{"10.0.0.1", "10.0.0.2"},
+		"upstream_addr":             nil,
+		"upstream_addr_values":      nil,
+		"upstream_status":           nil,
+		"upstream_response_time_ms": nil,
+		"http_user_agent":           nil,
+	})
+
+	// values which are present are kept, and only valid addresses are included in tp_ips
+	row = enrichLine(t, layout, `10.0.0.1 10.0.0.2 "10.0.1.1:8080, -" "502, -" "0.001, -" "3.25" "42" "curl/8.0" [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 502`)
+	assertColumns(t, row, map[string]any{
+		constants.TpSourceIP:               "10.0.0.1",
+		constants.TpDestinationIP:          "10.0.0.2",
+		constants.TpIps:                    []any{"10.0.0.1", "10.0.0.2", "10.0.1.1"},
+		"upstream_addr":                    nil,
+		"upstream_addr_values":             []any{"10.0.1.1", nil},
+		"upstream_status_values":           []any{int64(502), nil},
+		"upstream_response_time_ms_values": []any{int64(1), nil},
+		"gzip_ratio":                       3.25,
+		"content_length":                   int64(42),
+		"http_user_agent":                  "curl/8.0",
+	})
+}
+
+func TestAccessLogTable_EnrichRow_NullSentinels(t *testing.T) {
+	tbl := &AccessLogTable{}
+	if err := tbl.Initialize(&AccessLogTableFormat{Name: "test"}, (&AccessLogTable{}).GetTableDefinition()); err != nil {
+		t.Fatalf("unexpected error initializing the table: %v", err)
+	}
+
+	for name, sentinel := range map[string]string{
+		"dash":         "-",
+		"empty":        "",
+		"quoted empty": `""`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			row := &types.DynamicRow{}
+			if err := row.InitialiseFromMap(map[string]string{
+				"time_local":      "10/Oct/2024:13:55:36 +0000",
+				"content_length":  sentinel,
+				"body_bytes_sent": sentinel,
+				"server_name":     sentinel,
+				"http_host":       sentinel,
+				"http_referer":    sentinel,
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			row, err := tbl.EnrichRow(row, *schema.NewSourceEnrichment(map[string]string{}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, err := json.Marshal(row)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var columns map[string]any
+			if err := json.Unmarshal(data, &columns); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// each column must also convert to its type, which fails for a sentinel which is not nulled
+			typed := typedRow(t, tbl.GetSchema(), columns)
+			for _, column := range []string{"content_length", "body_bytes_sent", "server_name", "http_host", "http_referer"} {
+				if value, ok := typed[column]; !ok || value != nil {
+					t.Errorf("%s: got %v, want null", column, value)
+				}
+			}
+		})
+	}
+}
+
+func TestAccessLogTable_EnrichRow_NullSentinels_Layout(t *testing.T) {
+	layout := `$content_length $server_name "$http_referer" [$time_local] "$request" $status`
+
+	for _, line := range []string{
+		`- - "-" [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200`,
+		`"" "" "" [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200`,
+	} {
+		assertColumns(t, enrichLine(t, layout, line), map[string]any{
+			"content_length": nil,
+			"server_name":    nil,
+			"http_referer":   nil,
+			"status":         int64(200),
+		})
+	}
+}
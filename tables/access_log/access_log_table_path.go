@@ -0,0 +1,162 @@
+package access_log
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	typehelpers "github.com/turbot/go-kit/types"
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// pathTemplateFields maps the fields which may be used in a path_template to the columns they populate
+var pathTemplateFields = map[string]string{
+	"env":         "environment",
+	"environment": "environment",
+	"hostname":    "hostname",
+	"vhost":       "vhost",
+	"date":        "file_date",
+}
+
+// the regex patterns for path template fields - a field matches part of a single path segment
+var pathTemplateFieldPatterns = map[string]string{
+	"file_date": `\d{4}-?\d{2}-?\d{2}`,
+}
+
+// path template tokens: {field} placeholders, '**' (any number of directories) and '*' (part of a segment)
+var pathTemplateTokenRegex = regexp.MustCompile(`\{([^{}]*)\}|\*\*/|\*`)
+
+// pathTemplate extracts partition metadata, such as the server hostname, from the path of a log file
+//
+// a template such as '/logs/{env}/{hostname}/nginx/access-{vhost}.log' is matched against the path of the file,
+// with any rotation and compression suffix removed if the full path does not match
+// a template which does not start with '/' is matched against the end of the path
+type pathTemplate struct {
+	regex *regexp.Regexp
+}
+
+func newPathTemplate(template string) (*pathTemplate, error) {
+	if template == "" {
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	if strings.HasPrefix(template, "/") {
+		sb.WriteString("^")
+	} else {
+		sb.WriteString("(?:^|/)")
+	}
+
+	seen := make(map[string]struct{})
+	last := 0
+	for _, match := range pathTemplateTokenRegex.FindAllStringSubmatchIndex(template, -1) {
+		sb.WriteString(regexp.QuoteMeta(template[last:match[0]]))
+		last = match[1]
+
+		token := template[match[0]:match[1]]
+		switch {
+		case token == "**/":
+			sb.WriteString(`(?:[^/]+/)*`)
+		case token == "*":
+			sb.WriteString(`[^/]*`)
+		default:
+			field := template[match[2]:match[3]]
+			column, ok := pathTemplateFields[field]
+			if !ok {
+				return nil, fmt.Errorf("invalid path_template '%s': unsupported field '{%s}', must be one of {env}, {hostname}, {vhost} or {date}", template, field)
+			}
+			if _, ok := seen[column]; ok {
+				return nil, fmt.Errorf("invalid path_template '%s': field '{%s}' is used more than once", template, field)
+			}
+			seen[column] = struct{}{}
+
+			pattern, ok := pathTemplateFieldPatterns[column]
+			if !ok {
+				pattern = `[^/]+?`
+			}
+			fmt.Fprintf(&sb, `(?P<%s>%s)`, column, pattern)
+		}
+	}
+	sb.WriteString(regexp.QuoteMeta(template[last:]))
+	sb.WriteString("$")
+
+	regex, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid path_template '%s': %w", template, err)
+	}
+	return &pathTemplate{regex: regex}, nil
+}
+
+// hasDate returns true if the template has a {date} field
+func (t *pathTemplate) hasDate() bool {
+	return slices.Contains(t.regex.SubexpNames(), "file_date")
+}
+
+// match returns the columns extracted from the path, keyed by column name
+// if the path has a dateext rotation suffix and the template has no {date} field, file_date is the rotation date
+func (t *pathTemplate) match(path string) (map[string]string, bool) {
+	rotated := log_parse.ParseRotatedName(path)
+	values := t.regex.FindStringSubmatch(filepath.ToSlash(path))
+	if values == nil {
+		values = t.regex.FindStringSubmatch(filepath.ToSlash(rotated.Base))
+	}
+	if values == nil {
+		return nil, false
+	}
+
+	res := make(map[string]string)
+	for i, name := range t.regex.SubexpNames() {
+		if name != "" && values[i] != "" {
+			res[name] = values[i]
+		}
+	}
+	if _, ok := res["file_date"]; !ok && !rotated.Date.IsZero() {
+		res["file_date"] = rotated.Date.Format(time.DateOnly)
+	}
+	return res, true
+}
+
+// enrichPath populates the columns extracted from the path of the file the row was collected from
+// the hostname from the path is used for tp_index, and for the hostname column if $hostname is not logged
+func (t *pathTemplate) enrichPath(row *types.DynamicRow, sourceEnrichmentFields schema.SourceEnrichment) {
+	location := typehelpers.SafeString(sourceEnrichmentFields.CommonFields.TpSourceLocation)
+	if location == "" {
+		return
+	}
+	fields, ok := t.match(location)
+	if !ok {
+		return
+	}
+
+	for _, column := range []string{"environment", "vhost"} {
+		if value, ok := fields[column]; ok {
+			row.OutputColumns[column] = value
+		}
+	}
+	if value, ok := fields["file_date"]; ok {
+		if date, ok := parseFileDate(value); ok {
+			row.OutputColumns["file_date"] = date
+		}
+	}
+	if hostname, ok := fields["hostname"]; ok {
+		if logged, ok := row.GetSourceValue("hostname"); !ok || isNullValue(logged) {
+			row.OutputColumns["hostname"] = hostname
+		}
+		row.OutputColumns[constants.TpIndex] = hostname
+	}
+}
+
+// parseFileDate parses a date extracted from a path, e.g. '2024-10-10' or '20241010'
+func parseFileDate(value string) (time.Time, bool) {
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		date, err = time.Parse("20060102", value)
+	}
+	return date, err == nil
+}
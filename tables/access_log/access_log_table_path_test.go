@@ -0,0 +1,142 @@
+package access_log
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_pathTemplate_match(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		path     string
+		want     map[string]string
+		wantOk   bool
+	}{
+		{
+			name:     "rotated and compressed file",
+			template: "/logs/{env}/{hostname}/nginx/access-{vhost}.log",
+			path:     "/logs/prod/web-01/nginx/access-shop.example.com.log-20241010.gz",
+			want:     map[string]string{"environment": "prod", "hostname": "web-01", "vhost": "shop.example.com", "file_date": "2024-10-10"},
+			wantOk:   true,
+		},
+		{
+			name:     "live file",
+			template: "/logs/{env}/{hostname}/nginx/access-{vhost}.log",
+			path:     "/logs/prod/web-01/nginx/access-shop.example.com.log",
+			want:     map[string]string{"environment": "prod", "hostname": "web-01", "vhost": "shop.example.com"},
+			wantOk:   true,
+		},
+		{
+			name:     "numbered rotation",
+			template: "/logs/{environment}/{hostname}/nginx/*.log",
+			path:     "/logs/staging/web-02/nginx/access.log.2.gz",
+			want:     map[string]string{"environment": "staging", "hostname": "web-02"},
+			wantOk:   true,
+		},
+		{
+			name:     "date field",
+			template: "/archive/{date}/{hostname}/**/access.log",
+			path:     "/archive/2024-10-09/web-03/var/log/nginx/access.log",
+			want:     map[string]string{"hostname": "web-03", "file_date": "2024-10-09"},
+			wantOk:   true,
+		},
+		{
+			name:     "relative template matches the end of the path",
+			template: "{hostname}/nginx/access.log",
+			path:     "/mnt/logs/web-04/nginx/access.log",
+			want:     map[string]string{"hostname": "web-04"},
+			wantOk:   true,
+		},
+		{
+			name:     "no match",
+			template: "/logs/{env}/{hostname}/nginx/access-{vhost}.log",
+			path:     "/var/log/nginx/access.log",
+			wantOk:   false,
+		},
+		{
+			name:     "field does not span directories",
+			template: "/logs/{hostname}/access.log",
+			path:     "/logs/a/b/access.log",
+			wantOk:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := newPathTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, ok := template.match(tt.path)
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if ok && !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newPathTemplate_Invalid(t *testing.T) {
+	for _, template := range []string{
+		"/logs/{region}/access.log",
+		"/logs/{hostname}/{hostname}.log",
+		"/logs/{env}/{environment}/access.log",
+	} {
+		if _, err := newPathTemplate(template); err == nil {
+			t.Errorf("expected an error for template '%s'", template)
+		}
+	}
+	if template, err := newPathTemplate(""); template != nil || err != nil {
+		t.Errorf("got %v, %v, want nil, nil for an empty template", template, err)
+	}
+}
+
+func Test_pathTemplate_enrichPath(t *testing.T) {
+	template, err := newPathTemplate("/logs/{env}/{hostname}/nginx/access-{vhost}.log")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enrich := func(path string, source map[string]string) *types.DynamicRow {
+		row := &types.DynamicRow{}
+		if err := row.InitialiseFromMap(source); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		template.enrichPath(row, *schema.NewSourceEnrichment(map[string]string{constants.TpSourceLocation: path}))
+		return row
+	}
+
+	row := enrich("/logs/prod/web-01/nginx/access-shop.log-20241010.gz", map[string]string{"hostname": "-"})
+	want := map[string]any{
+		"environment":     "prod",
+		"vhost":           "shop",
+		"hostname":        "web-01",
+		constants.TpIndex: "web-01",
+		"file_date":       time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC),
+	}
+	for column, value := range want {
+		if got := row.OutputColumns[column]; got != value {
+			t.Errorf("%s: got %v, want %v", column, got, value)
+		}
+	}
+
+	// a logged hostname is kept, but the path is still used for the index
+	row = enrich("/logs/prod/web-01/nginx/access-shop.log", map[string]string{"hostname": "web-01.internal"})
+	if got, ok := row.OutputColumns["hostname"]; ok {
+		t.Errorf("expected the logged hostname to be kept, got %v", got)
+	}
+	if got := row.OutputColumns[constants.TpIndex]; got != "web-01" {
+		t.Errorf("tp_index: got %v, want web-01", got)
+	}
+
+	row = enrich("/var/log/nginx/access.log", nil)
+	if len(row.OutputColumns) != 0 {
+		t.Errorf("expected no columns for a path which does not match, got %v", row.OutputColumns)
+	}
+}
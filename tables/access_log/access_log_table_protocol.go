@@ -0,0 +1,53 @@
+package access_log
+
+import (
+	"strings"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// normalized values for the http_version column
+const (
+	HttpVersion10 = "1.0"
+	HttpVersion11 = "1.1"
+	HttpVersion2  = "2"
+	HttpVersion3  = "3"
+)
+
+// enrichProtocol derives the normalized http_version from $http3, $http2 and $server_protocol
+func enrichProtocol(row *types.DynamicRow) {
+	if version := httpVersion(row); version != "" {
+		row.OutputColumns["http_version"] = version
+	}
+}
+
+func httpVersion(row *types.DynamicRow) string {
+	// $http3 and $http2 are set for the negotiated protocol even if the protocol is not logged in $server_protocol
+	if value, ok := row.GetSourceValue("http3"); ok && value == "h3" {
+		return HttpVersion3
+	}
+	if value, ok := row.GetSourceValue("http2"); ok && (value == "h2" || value == "h2c") {
+		return HttpVersion2
+	}
+
+	protocol, ok := row.GetSourceValue("server_protocol")
+	if !ok {
+		return ""
+	}
+	version, found := strings.CutPrefix(strings.ToUpper(protocol), "HTTP/")
+	if !found {
+		return ""
+	}
+	switch version {
+	case "1.0":
+		return HttpVersion10
+	case "1.1":
+		return HttpVersion11
+	case "2", "2.0":
+		return HttpVersion2
+	case "3", "3.0":
+		return HttpVersion3
+	default:
+		return version
+	}
+}
@@ -0,0 +1,36 @@
+package access_log
+
+import (
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_enrichProtocol(t *testing.T) {
+	tests := []struct {
+		name   string
+		source map[string]string
+		want   any
+	}{
+		{name: "HTTP/1.0", source: map[string]string{"server_protocol": "HTTP/1.0"}, want: HttpVersion10},
+		{name: "HTTP/1.1", source: map[string]string{"server_protocol": "HTTP/1.1"}, want: HttpVersion11},
+		{name: "HTTP/2.0", source: map[string]string{"server_protocol": "HTTP/2.0"}, want: HttpVersion2},
+		{name: "HTTP/3.0", source: map[string]string{"server_protocol": "HTTP/3.0"}, want: HttpVersion3},
+		{name: "http2 variable", source: map[string]string{"server_protocol": "-", "http2": "h2"}, want: HttpVersion2},
+		{name: "http2 cleartext", source: map[string]string{"http2": "h2c"}, want: HttpVersion2},
+		{name: "http3 takes precedence", source: map[string]string{"server_protocol": "HTTP/1.1", "http2": "-", "http3": "h3"}, want: HttpVersion3},
+		{name: "http2 not negotiated", source: map[string]string{"server_protocol": "HTTP/1.1", "http2": "-"}, want: HttpVersion11},
+		{name: "Not HTTP", source: map[string]string{"server_protocol": "-"}, want: nil},
+		{name: "No protocol", source: map[string]string{}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &types.DynamicRow{}
+			_ = row.InitialiseFromMap(tt.source)
+			enrichProtocol(row)
+			if got := row.OutputColumns["http_version"]; got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
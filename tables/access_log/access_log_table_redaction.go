@@ -0,0 +1,334 @@
+package access_log
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+// redaction actions which may be configured for columns, query parameters and cookies
+const (
+	RedactActionDrop = "drop"
+	RedactActionMask = "mask"
+	RedactActionHash = "hash"
+)
+
+// RedactedValue is the value written in place of masked data
+const RedactedValue = "REDACTED"
+
+// queryParamColumns are the source fields which may contain a URI with a query string
+var queryParamColumns = []string{"request_uri", "http_referer"}
+
+// queryStringColumns are the source fields which contain just a query string
+var queryStringColumns = []string{"args", "query_string"}
+
+// cookieColumns are the source fields which contain cookies
+var cookieColumns = []string{"http_cookie"}
+
+// the prefixes of the source fields for a single query parameter or cookie, from the $arg_<name> and $cookie_<name>
+// variables
+const (
+	queryParamFieldPrefix = "arg_"
+	cookieFieldPrefix     = "cookie_"
+)
+
+func validRedactActions() []string {
+	return []string{RedactActionDrop, RedactActionMask, RedactActionHash}
+}
+
+// redactor applies the redaction rules configured on an AccessLogTableFormat to the source fields of a row
+type redactor struct {
+	columns     map[string]string
+	queryParams map[string]string
+	cookies     map[string]string
+	hashKey     []byte
+	// the source fields produced by the format - needed to rebuild the row
+	sourceFields []string
+}
+
+// newRedactor builds a redactor for the given format, returning nil if the format has no redaction rules
+func newRedactor(format *AccessLogTableFormat) (*redactor, error) {
+	if format == nil || !format.hasRedactions() {
+		return nil, nil
+	}
+
+	regex, err := format.GetRegex()
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling regex for format '%s': %w", format.Name, err)
+	}
+
+	var sourceFields []string
+	for _, name := range re.SubexpNames() {
+		if name != "" && !slices.Contains(sourceFields, name) {
+			sourceFields = append(sourceFields, name)
+		}
+	}
+
+	return &redactor{
+		columns:      format.RedactColumns,
+		queryParams:  lowerKeys(format.RedactQueryParams),
+		cookies:      format.RedactCookies,
+		hashKey:      []byte(format.RedactHashKey),
+		sourceFields: sourceFields,
+	}, nil
+}
+
+// redact returns a copy of the source values with the redaction rules applied
+func (r *redactor) redact(source map[string]string) map[string]string {
+	res := make(map[string]string, len(source))
+	for k, v := range source {
+		res[k] = v
+	}
+
+	// query parameters and cookies first, so a column rule for the same field takes precedence
+	if len(r.queryParams) > 0 {
+		for _, column := range queryParamColumns {
+			if v, ok := res[column]; ok && !isNullValue(v) {
+				res[column] = r.redactQueryString(v)
+			}
+		}
+		for _, column := range queryStringColumns {
+			if v, ok := res[column]; ok && !isNullValue(v) {
+				res[column] = r.redactParams(v)
+			}
+		}
+	}
+	if len(r.cookies) > 0 {
+		for _, column := range cookieColumns {
+			if v, ok := res[column]; ok && !isNullValue(v) {
+				res[column] = r.redactCookies(v)
+			}
+		}
+	}
+	// the value of a single query parameter or cookie, e.g. $arg_token or $cookie_sid, is redacted by the rule for
+	// that parameter or cookie
+	// nginx matches the names of these variables case-insensitively
+	for field := range source {
+		if name, ok := strings.CutPrefix(field, queryParamFieldPrefix); ok {
+			if action, ok := r.queryParams[strings.ToLower(name)]; ok {
+				r.redactField(res, field, action)
+			}
+		} else if name, ok := strings.CutPrefix(field, cookieFieldPrefix); ok {
+			if action, ok := r.cookieAction(name); ok {
+				r.redactField(res, field, action)
+			}
+		}
+	}
+
+	for column, action := range r.columns {
+		r.redactField(res, column, action)
+	}
+
+	return res
+}
+
+// redactField applies the action to the source field, if it has a value
+func (r *redactor) redactField(source map[string]string, field, action string) {
+	v, ok := source[field]
+	if !ok || isNullValue(v) {
+		return
+	}
+	if action == RedactActionDrop {
+		delete(source, field)
+		return
+	}
+	source[field] = r.apply(action, v)
+}
+
+// cookieAction returns the action of the cookie rule for the $cookie_<name> variable with the given name
+func (r *redactor) cookieAction(name string) (string, bool) {
+	if action, ok := r.cookies[name]; ok {
+		return action, true
+	}
+	for cookie, action := range r.cookies {
+		if strings.EqualFold(cookie, name) {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+// redactsColumn returns true if the redactor has a redact_columns rule for the source field
+func (r *redactor) redactsColumn(field string) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.columns[field]
+	return ok
+}
+
+// redactQueryString applies the query parameter rules to the query string part of a URI
+func (r *redactor) redactQueryString(uri string) string {
+	base, query, found := strings.Cut(uri, "?")
+	if !found || query == "" {
+		return uri
+	}
+	// preserve any fragment
+	query, fragment, hasFragment := strings.Cut(query, "#")
+
+	res := base
+	if query = r.redactParams(query); query != "" {
+		res += "?" + query
+	}
+	if hasFragment {
+		res += "#" + fragment
+	}
+	return res
+}
+
+// redactParams applies the query parameter rules to a query string
+func (r *redactor) redactParams(query string) string {
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		key, value, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		action, ok := r.queryParams[strings.ToLower(name)]
+		switch {
+		case !ok:
+			params = append(params, param)
+		case action == RedactActionDrop:
+			continue
+		case hasValue:
+			params = append(params, key+"="+r.apply(action, value))
+		default:
+			params = append(params, key)
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// redactCookies applies the cookie rules to a Cookie header value
+func (r *redactor) redactCookies(header string) string {
+	var cookies []string
+	for _, cookie := range strings.Split(header, ";") {
+		cookie = strings.TrimSpace(cookie)
+		if cookie == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(cookie, "=")
+		action, ok := r.cookies[name]
+		switch {
+		case !ok:
+			cookies = append(cookies, cookie)
+		case action == RedactActionDrop:
+			continue
+		case hasValue:
+			cookies = append(cookies, name+"="+r.apply(action, value))
+		default:
+			cookies = append(cookies, name)
+		}
+	}
+	return strings.Join(cookies, "; ")
+}
+
+func (r *redactor) apply(action, value string) string {
+	switch action {
+	case RedactActionMask:
+		return RedactedValue
+	case RedactActionHash:
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return value
+	}
+}
+
+// validateRedactRules checks all actions in the given rule map are valid
+func validateRedactRules(attribute string, rules map[string]string) error {
+	var invalid []string
+	for name, action := range rules {
+		if !slices.Contains(validRedactActions(), action) {
+			invalid = append(invalid, fmt.Sprintf("%s = %q", name, action))
+		}
+	}
+	if len(invalid) > 0 {
+		slices.Sort(invalid)
+		return fmt.Errorf("invalid %s action(s) %s, must be one of: %s", attribute, strings.Join(invalid, ", "), strings.Join(validRedactActions(), ", "))
+	}
+	return nil
+}
+
+// validateRedactColumns checks each redact_columns key is a field of the format layout, and that values are only
+// masked or hashed in fields mapped to varchar columns - any other field may only be dropped
+//
+// redaction is applied to the fields parsed from the layout, before any column is derived from them, so a column
+// which is not a field, e.g. tp_source_ip or remote_addr_type, is redacted by redacting the field it is derived from
+func validateRedactColumns(format *AccessLogTableFormat) error {
+	if len(format.RedactColumns) == 0 {
+		return nil
+	}
+
+	var sourceFields []string
+	if format.Layout != "" {
+		regex, err := format.GetRegex()
+		if err != nil {
+			return err
+		}
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			return fmt.Errorf("error compiling regex for format '%s': %w", format.Name, err)
+		}
+		for _, name := range re.SubexpNames() {
+			if name != "" && !slices.Contains(sourceFields, name) {
+				sourceFields = append(sourceFields, name)
+			}
+		}
+		slices.Sort(sourceFields)
+	}
+
+	tableSchema := (&AccessLogTable{}).GetTableDefinition()
+	keys := slices.Sorted(maps.Keys(format.RedactColumns))
+	for _, key := range keys {
+		if !slices.Contains(sourceFields, key) {
+			return fmt.Errorf("invalid redact_columns key '%s': not a field of the format layout, must be one of: %s", key, strings.Join(sourceFields, ", "))
+		}
+		column := key
+		if isTimingVariable(key) {
+			column += "_ms"
+		}
+		idx := slices.IndexFunc(tableSchema.Columns, func(c *schema.ColumnSchema) bool { return c.ColumnName == column })
+		if idx == -1 {
+			continue
+		}
+		action := format.RedactColumns[key]
+		if columnType := tableSchema.Columns[idx].Type; action != RedactActionDrop && columnType != "varchar" {
+			return fmt.Errorf("invalid redact_columns key '%s': the '%s' action can only be used for varchar columns, use '%s' for the %s column", key, action, RedactActionDrop, columnType)
+		}
+	}
+	return nil
+}
+
+func usesRedactAction(action string, rules ...map[string]string) bool {
+	for _, r := range rules {
+		for _, a := range r {
+			if a == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func lowerKeys(m map[string]string) map[string]string {
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[strings.ToLower(k)] = v
+	}
+	return res
+}
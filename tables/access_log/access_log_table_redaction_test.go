@@ -0,0 +1,268 @@
+package access_log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+)
+
+func Test_redactor_redact(t *testing.T) {
+	format := &AccessLogTableFormat{
+		Name:   "test",
+		Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_cookie"`,
+		RedactColumns: map[string]string{
+			"remote_user": RedactActionHash,
+			"remote_addr": RedactActionMask,
+		},
+		RedactQueryParams: map[string]string{
+			"token":   RedactActionDrop,
+			"email":   RedactActionMask,
+			"session": RedactActionHash,
+		},
+		RedactCookies: map[string]string{
+			"sid":   RedactActionHash,
+			"trace": RedactActionDrop,
+		},
+		RedactHashKey: "secret",
+	}
+	if err := format.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	r, err := newRedactor(format)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantFields := []string{"remote_addr", "remote_user", "time_local", "request_method", "request_uri", "server_protocol", "status", "body_bytes_sent", "http_referer", "http_cookie"}
+	if !reflect.DeepEqual(r.sourceFields, wantFields) {
+		t.Errorf("got source fields %v, want %v", r.sourceFields, wantFields)
+	}
+
+	got := r.redact(map[string]string{
+		"remote_addr":  "10.0.0.1",
+		"remote_user":  "alice",
+		"request_uri":  "/account?Token=abc&email=a%40example.com&page=2&session=xyz#top",
+		"http_referer": "https://example.com/?token=abc",
+		"http_cookie":  "sid=123; theme=dark; trace=t1",
+		"status":       "200",
+	})
+	want := map[string]string{
+		"remote_addr":  RedactedValue,
+		"remote_user":  "4360c67bc81025114044578d7c4e8e0f02fd0cae99f22d603390e8f9dc9888f8",
+		"request_uri":  "/account?email=REDACTED&page=2&session=8014dbb86282a6757ee72a0de9b9e2bb0f60a809dc929edee511703a64bf4955#top",
+		"http_referer": "https://example.com/",
+		"http_cookie":  "sid=77de38e4b50e618a0ebb95db61e2f42697391659d82c064a5f81b9f48d85ccd5; theme=dark",
+		"status":       "200",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func Test_redactor_drop_column(t *testing.T) {
+	r, err := newRedactor(&AccessLogTableFormat{
+		Layout:        `$remote_addr "$http_cookie"`,
+		RedactColumns: map[string]string{"http_cookie": RedactActionDrop},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := r.redact(map[string]string{"remote_addr": "10.0.0.1", "http_cookie": "sid=1"})
+	if _, ok := got["http_cookie"]; ok {
+		t.Errorf("expected http_cookie to be dropped, got %v", got)
+	}
+	if got["remote_addr"] != "10.0.0.1" {
+		t.Errorf("expected remote_addr to be unchanged, got %q", got["remote_addr"])
+	}
+}
+
+func Test_redactor_redact_queryParamFields(t *testing.T) {
+	r, err := newRedactor(&AccessLogTableFormat{
+		Layout:            `$remote_addr "$request" $arg_token $arg_email $arg_page`,
+		RedactQueryParams: map[string]string{"token": RedactActionDrop, "Email": RedactActionMask},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := r.redact(map[string]string{
+		"remote_addr": "10.0.0.1",
+		"request_uri": "/?token=abc&email=a%40example.com&page=2",
+		"arg_token":   "abc",
+		"arg_email":   "a%40example.com",
+		"arg_page":    "2",
+	})
+	want := map[string]string{
+		"remote_addr": "10.0.0.1",
+		"request_uri": "/?email=REDACTED&page=2",
+		"arg_email":   RedactedValue,
+		"arg_page":    "2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func Test_redactor_redact_cookieFields(t *testing.T) {
+	r, err := newRedactor(&AccessLogTableFormat{
+		Layout:        `$remote_addr "$http_cookie" $cookie_sid $cookie_trace $cookie_theme`,
+		RedactCookies: map[string]string{"sid": RedactActionHash, "trace": RedactActionDrop},
+		RedactHashKey: "secret",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := r.redact(map[string]string{
+		"remote_addr":  "10.0.0.1",
+		"http_cookie":  "sid=123; theme=dark; trace=t1",
+		"cookie_sid":   "123",
+		"cookie_trace": "t1",
+		"cookie_theme": "dark",
+	})
+	want := map[string]string{
+		"remote_addr":  "10.0.0.1",
+		"http_cookie":  "sid=77de38e4b50e618a0ebb95db61e2f42697391659d82c064a5f81b9f48d85ccd5; theme=dark",
+		"cookie_sid":   "77de38e4b50e618a0ebb95db61e2f42697391659d82c064a5f81b9f48d85ccd5",
+		"cookie_theme": "dark",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func Test_AccessLogTableFormat_Validate_Redaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  *AccessLogTableFormat
+		wantErr bool
+		// the offending key, which the error must name
+		wantErrKey string
+	}{
+		{
+			name:   "No redaction",
+			format: &AccessLogTableFormat{},
+		},
+		{
+			name:    "Invalid action",
+			format:  &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"remote_user": "scramble"}},
+			wantErr: true,
+		},
+		{
+			name:       "Unknown column",
+			format:     &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"remote_usr": RedactActionDrop}},
+			wantErr:    true,
+			wantErrKey: "remote_usr",
+		},
+		{
+			name:       "Derived column",
+			format:     &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"tp_source_ip": RedactActionDrop}},
+			wantErr:    true,
+			wantErrKey: "tp_source_ip",
+		},
+		{
+			name:       "Column which is not in the layout",
+			format:     &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"http_user_agent": RedactActionMask}},
+			wantErr:    true,
+			wantErrKey: "http_user_agent",
+		},
+		{
+			name:   "Layout field which is not a table column",
+			format: &AccessLogTableFormat{Layout: `$remote_addr "$http_x_api_key"`, RedactColumns: map[string]string{"http_x_api_key": RedactActionMask}},
+		},
+		{
+			name:       "Mask non-varchar column",
+			format:     &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"status": RedactActionMask}},
+			wantErr:    true,
+			wantErrKey: "status",
+		},
+		{
+			name:       "Hash non-varchar column",
+			format:     &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"body_bytes_sent": RedactActionHash}, RedactHashKey: "k"},
+			wantErr:    true,
+			wantErrKey: "body_bytes_sent",
+		},
+		{
+			name:       "Mask timing variable",
+			format:     &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"request_time": RedactActionMask}},
+			wantErr:    true,
+			wantErrKey: "request_time",
+		},
+		{
+			name:   "Drop non-varchar column",
+			format: &AccessLogTableFormat{Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent $request_time`, RedactColumns: map[string]string{"status": RedactActionDrop, "request_time": RedactActionDrop}},
+		},
+		{
+			name:    "Hash without key",
+			format:  &AccessLogTableFormat{RedactCookies: map[string]string{"sid": RedactActionHash}},
+			wantErr: true,
+		},
+		{
+			name:   "Hash with key",
+			format: &AccessLogTableFormat{RedactCookies: map[string]string{"sid": RedactActionHash}, RedactHashKey: "k"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.format.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && tt.wantErrKey != "" && !strings.Contains(err.Error(), "'"+tt.wantErrKey+"'") {
+				t.Errorf("Validate() error = %v, want it to name %q", err, tt.wantErrKey)
+			}
+		})
+	}
+}
+
+func Test_validateRedactColumns_ListsFields(t *testing.T) {
+	err := (&AccessLogTableFormat{Layout: `$remote_addr [$time_local] "$http_user_agent"`, RedactColumns: map[string]string{"remote_addr_type": RedactActionDrop}}).Validate()
+	if err == nil {
+		t.Fatal("expected an error for a derived column")
+	}
+	if !strings.Contains(err.Error(), "must be one of: http_user_agent, remote_addr, time_local") {
+		t.Errorf("got error %v, want it to list the fields of the layout", err)
+	}
+}
+
+func TestAccessLogTable_EnrichRow_Redaction(t *testing.T) {
+	format := &AccessLogTableFormat{
+		Name:          "test",
+		Layout:        `$remote_addr [$time_local] "$request" $status "$http_user_agent"`,
+		RedactColumns: map[string]string{"remote_addr": RedactActionDrop, "http_user_agent": RedactActionMask},
+	}
+	if err := format.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte(`8.8.8.8 [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 "Mozilla/5.0 (secret)"`+"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res := collectArtifact(t, format, path)
+	if len(res.rows) != 1 {
+		t.Fatalf("got %d rows and row errors for %q, want 1 row", len(res.rows), res.errors)
+	}
+	row := res.rows[0]
+
+	// the dropped address is not in any column derived from it
+	assertColumns(t, row, map[string]any{
+		constants.TpSourceIP:      nil,
+		constants.TpIps:           nil,
+		"remote_addr":             nil,
+		"remote_addr_type":        nil,
+		"remote_addr_is_internal": nil,
+		"http_user_agent":         RedactedValue,
+		"status":                  int64(200),
+	})
+	for column, value := range row {
+		if s := fmt.Sprint(value); strings.Contains(s, "8.8.8.8") || strings.Contains(s, "secret") {
+			t.Errorf("%s: got %v, want no redacted value", column, value)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package access_log
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// DefaultSessionTimeout is the inactivity timeout after which a visitor's next request starts a new session
+const DefaultSessionTimeout = 30 * time.Minute
+
+// sessionSweepRows is the number of rows between sweeps of the sessions which have timed out
+const sessionSweepRows = 10000
+
+// sessionizer assigns rows to visitor sessions
+//
+// a visitor is identified by the configured session cookie if present, otherwise by client IP and user agent,
+// and a session is a run of the visitor's requests in which each follows the previous within the session timeout
+// sessions are tracked separately for each artifact, so the sessions assigned to the rows of an artifact do not
+// depend on the order artifacts are collected in, and a session which spans two artifacts is split at the boundary
+type sessionizer struct {
+	timeout time.Duration
+	cookie  string
+
+	mu sync.Mutex
+	// the sessions of each artifact, keyed by tp_source_location
+	artifacts map[string]*sessionTracker
+	// the latest time of any request, across all artifacts
+	latest time.Time
+	// the number of rows between sweeps, and since the last sweep
+	sweepRows int
+	rows      int
+}
+
+func newSessionizer(format *AccessLogTableFormat) (*sessionizer, error) {
+	if format == nil || !format.Sessionize {
+		return nil, nil
+	}
+	timeout, err := format.sessionTimeout()
+	if err != nil {
+		return nil, err
+	}
+	return &sessionizer{
+		timeout:   timeout,
+		cookie:    format.SessionCookie,
+		artifacts: make(map[string]*sessionTracker),
+		sweepRows: sessionSweepRows,
+	}, nil
+}
+
+// enrichSession populates the session_id column
+//
+// rows are assigned to sessions in the order they are collected, which is the order nginx wrote them, i.e. the
+// order the requests completed in
+func (s *sessionizer) enrichSession(row *types.DynamicRow, location string) {
+	timestamp, ok := row.OutputColumns[constants.TpTimestamp].(time.Time)
+	if !ok {
+		return
+	}
+	key, ok := visitorKey(row.GetSourceValue, s.cookie)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tracker, ok := s.artifacts[location]
+	if !ok {
+		tracker = newSessionTracker(s.timeout)
+		s.artifacts[location] = tracker
+	}
+	row.OutputColumns["session_id"] = tracker.assign(key, timestamp).id
+	tracker.active = true
+	if timestamp.After(s.latest) {
+		s.latest = timestamp
+	}
+
+	s.rows++
+	if s.rows >= s.sweepRows {
+		s.rows = 0
+		s.sweep()
+	}
+}
+
+// sweep removes the sessions which have timed out, and the artifacts which have ended, so the state is bounded by
+// the visitors and artifacts within the timeout of the latest request rather than growing with every artifact
+//
+// there is no notification when an artifact has been collected, so an artifact is taken to have ended once it has
+// received no rows since the previous sweep and its latest request is more than the timeout before the latest
+// request of any artifact
+// the sessions of an artifact which is still receiving rows are timed out against its own latest request, so an
+// older artifact collected after a newer one keeps its sessions
+func (s *sessionizer) sweep() {
+	for location, tracker := range s.artifacts {
+		if !tracker.active && s.latest.Sub(tracker.latest) > s.timeout {
+			delete(s.artifacts, location)
+			continue
+		}
+		tracker.active = false
+		if tracker.sweep() == 0 {
+			delete(s.artifacts, location)
+		}
+	}
+}
+
+// visitorSession is the current session of a visitor
+type visitorSession struct {
+	id       string
+	start    time.Time
+	lastSeen time.Time
+}
+
+// sessionTracker tracks the current session of each visitor in a sequence of requests
+type sessionTracker struct {
+	timeout  time.Duration
+	visitors map[string]*visitorSession
+	// the latest time of any request
+	latest time.Time
+	// whether the tracker has been assigned a request since the last sweep
+	active bool
+}
+
+func newSessionTracker(timeout time.Duration) *sessionTracker {
+	return &sessionTracker{
+		timeout:  timeout,
+		visitors: make(map[string]*visitorSession),
+	}
+}
+
+// assign returns the session of a request made by the visitor at the given time, which is the visitor's current
+// session unless the visitor has made no request within the timeout, in which case a new session is started
+func (t *sessionTracker) assign(key string, timestamp time.Time) *visitorSession {
+	if timestamp.After(t.latest) {
+		t.latest = timestamp
+	}
+	session, ok := t.visitors[key]
+	if ok && timestamp.Sub(session.lastSeen) <= t.timeout && session.start.Sub(timestamp) <= t.timeout {
+		if timestamp.After(session.lastSeen) {
+			session.lastSeen = timestamp
+		}
+		return session
+	}
+	session = &visitorSession{
+		id:       sessionID(key, timestamp),
+		start:    timestamp,
+		lastSeen: timestamp,
+	}
+	t.visitors[key] = session
+	return session
+}
+
+// sweep removes the sessions which have timed out, returning the number of sessions left
+func (t *sessionTracker) sweep() int {
+	for key, session := range t.visitors {
+		if t.latest.Sub(session.lastSeen) > t.timeout {
+			delete(t.visitors, key)
+		}
+	}
+	return len(t.visitors)
+}
+
+// sessionID returns the ID of the session of the visitor starting at the given time
+// the ID depends only on the visitor and the time of its first request, so it is stable across collections
+func sessionID(key string, start time.Time) string {
+	hash := sha256.Sum256([]byte(key + "|" + strconv.FormatInt(start.UnixNano(), 10)))
+	return hex.EncodeToString(hash[:16])
+}
+
+// visitorKey returns the key identifying the visitor that made the request, from the source fields returned by
+// getSourceValue
+func visitorKey(getSourceValue func(string) (string, bool), cookie string) (string, bool) {
+	if cookie != "" {
+		if value, ok := sessionCookieValue(getSourceValue, cookie); ok {
+			return "cookie:" + value, true
+		}
+	}
+
+	remoteAddr, ok := getSourceValue("remote_addr")
+	if !ok || isNullValue(remoteAddr) {
+		return "", false
+	}
+	ip, ok := normalizeIP(remoteAddr)
+	if !ok {
+		return "", false
+	}
+	userAgent, _ := getSourceValue("http_user_agent")
+	return "client:" + ip + "|" + userAgent, true
+}
+
+// sessionCookieValue returns the value of the named cookie, from either $cookie_<name> or the Cookie header
+func sessionCookieValue(getSourceValue func(string) (string, bool), name string) (string, bool) {
+	if value, ok := getSourceValue("cookie_" + name); ok && !isNullValue(value) {
+		return value, true
+	}
+	header, ok := getSourceValue("http_cookie")
+	if !ok || isNullValue(header) {
+		return "", false
+	}
+	for _, cookie := range strings.Split(header, ";") {
+		if cookieName, value, ok := strings.Cut(strings.TrimSpace(cookie), "="); ok && cookieName == name && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
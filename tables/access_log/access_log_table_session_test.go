@@ -0,0 +1,207 @@
+package access_log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_sessionizer_enrichSession(t *testing.T) {
+	s, err := newSessionizer(&AccessLogTableFormat{Sessionize: true, SessionTimeout: "10m", SessionCookie: "sid"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	sessionID := func(location string, offset time.Duration, source map[string]string) any {
+		row := &types.DynamicRow{}
+		if err := row.InitialiseFromMap(source); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		row.OutputColumns[constants.TpTimestamp] = start.Add(offset)
+		s.enrichSession(row, location)
+		return row.OutputColumns["session_id"]
+	}
+	firefox := map[string]string{"remote_addr": "203.0.113.5", "http_user_agent": "Firefox"}
+	chrome := map[string]string{"remote_addr": "203.0.113.5", "http_user_agent": "Chrome"}
+
+	first := sessionID("access.log", 0, firefox)
+	if first == nil {
+		t.Fatal("expected a session_id")
+	}
+	// each request is within the timeout of the previous one, so the session continues past 10 minutes
+	for _, offset := range []time.Duration{9 * time.Minute, 18 * time.Minute, 27 * time.Minute} {
+		if got := sessionID("access.log", offset, firefox); got != first {
+			t.Errorf("request after %v: got %v, want %v", offset, got, first)
+		}
+	}
+	if got := sessionID("access.log", 20*time.Minute, chrome); got == first {
+		t.Error("expected a different user agent to start a different session")
+	}
+	// a request after more than the timeout of inactivity starts a new session
+	second := sessionID("access.log", 38*time.Minute, firefox)
+	if second == first {
+		t.Error("expected a request after the timeout to start a new session")
+	}
+	if got := sessionID("access.log", 40*time.Minute, firefox); got != second {
+		t.Errorf("request in the new session: got %v, want %v", got, second)
+	}
+	// sessions are tracked separately for each artifact
+	if got := sessionID("access.log.1", 41*time.Minute, firefox); got == second {
+		t.Error("expected a request in another artifact to start a new session")
+	}
+
+	// the session cookie identifies the visitor across client addresses
+	cookie := sessionID("access.log", 0, map[string]string{"remote_addr": "203.0.113.5", "http_cookie": "theme=dark; sid=abc123"})
+	if got := sessionID("access.log", time.Minute, map[string]string{"remote_addr": "198.51.100.7", "cookie_sid": "abc123"}); got != cookie {
+		t.Errorf("request with the same session cookie: got %v, want %v", got, cookie)
+	}
+
+	if got := sessionID("access.log", 0, map[string]string{"http_user_agent": "Firefox"}); got != nil {
+		t.Errorf("request without a client address: got %v, want nil", got)
+	}
+}
+
+func Test_sessionTracker_sweep(t *testing.T) {
+	tracker := newSessionTracker(10 * time.Minute)
+	start := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	first := tracker.assign("a", start)
+	tracker.assign("b", start.Add(5*time.Minute))
+	tracker.assign("c", start.Add(12*time.Minute))
+	if got := tracker.sweep(); got != 2 {
+		t.Errorf("got %d sessions after the sweep, want 2", got)
+	}
+	// a visitor whose session was swept starts a new session, as it would have after the timeout
+	if got := tracker.assign("a", start.Add(13*time.Minute)); got == first {
+		t.Error("expected a new session for a visitor whose session timed out")
+	}
+}
+
+// Test_sessionizer_sweepArtifacts collects many artifacts in turn and checks the artifacts which have ended are
+// removed, so the state does not grow with the number of artifacts
+func Test_sessionizer_sweepArtifacts(t *testing.T) {
+	s, err := newSessionizer(&AccessLogTableFormat{Sessionize: true, SessionTimeout: "10m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.sweepRows = 10
+
+	start := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	enrich := func(location string, timestamp time.Time) {
+		row := &types.DynamicRow{}
+		if err := row.InitialiseFromMap(map[string]string{"remote_addr": "203.0.113.5", "http_user_agent": "Firefox"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		row.OutputColumns[constants.TpTimestamp] = timestamp
+		s.enrichSession(row, location)
+	}
+
+	// each artifact is an hour of requests from a visitor which is active until the end of the artifact, so its
+	// session never times out against the artifact's own latest request
+	for i := range 50 {
+		location := fmt.Sprintf("access.log.%d", i)
+		for minute := range 60 {
+			enrich(location, start.Add(time.Duration(i)*time.Hour+time.Duration(minute)*time.Minute))
+		}
+		if len(s.artifacts) > 3 {
+			t.Fatalf("got %d artifacts tracked after collecting %d, want at most 3", len(s.artifacts), i+1)
+		}
+	}
+
+	// an older artifact collected after newer ones keeps its sessions while it is receiving rows
+	s.sweepRows = 1
+	enrich("access.log.old", start.Add(-time.Hour))
+	enrich("access.log.old", start.Add(-time.Hour+time.Minute))
+	if tracker, ok := s.artifacts["access.log.old"]; !ok || len(tracker.visitors) != 1 {
+		t.Error("expected the sessions of an artifact which is receiving rows to be kept")
+	}
+}
+
+func Test_sessionID_Stable(t *testing.T) {
+	timestamp := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	if sessionID("client:10.0.0.1|curl", timestamp) != sessionID("client:10.0.0.1|curl", timestamp.In(time.FixedZone("", 5*60*60+30*60))) {
+		t.Error("expected the same session ID for the same start time in another time zone")
+	}
+	s, _ := newSessionizer(&AccessLogTableFormat{Sessionize: true})
+	if s.timeout != DefaultSessionTimeout {
+		t.Errorf("got timeout %v, want %v", s.timeout, DefaultSessionTimeout)
+	}
+}
+
+// TestAccessLogTable_EnrichRow_SessionOrder collects the same requests split across two artifacts, in both orders,
+// and checks each request is assigned the same session
+func TestAccessLogTable_EnrichRow_SessionOrder(t *testing.T) {
+	lines := []string{
+		`203.0.113.5 - - [16/Oct/2024:12:01:00 +0000] "GET / HTTP/1.1" 200 512 "-" "Firefox"`,
+		`198.51.100.7 - - [16/Oct/2024:12:02:00 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`,
+		`203.0.113.5 - - [16/Oct/2024:12:25:00 +0000] "GET /about HTTP/1.1" 200 512 "-" "Firefox"`,
+		`203.0.113.5 - - [16/Oct/2024:12:50:00 +0000] "GET /contact HTTP/1.1" 200 512 "-" "Firefox"`,
+		`203.0.113.5 - - [16/Oct/2024:13:30:00 +0000] "GET / HTTP/1.1" 200 512 "-" "Firefox"`,
+		`203.0.113.5 - - [16/Oct/2024:13:31:00 +0000] "GET /pricing HTTP/1.1" 200 512 "-" "Firefox"`,
+	}
+	format := &AccessLogTableFormat{Name: "test", Layout: defaultAccessLogTableFormat.Layout, Sessionize: true}
+
+	dir := t.TempDir()
+	write := func(name string, lines []string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return path
+	}
+	first := write("access.log.1", lines[:5])
+	second := write("access.log", lines[5:])
+
+	// collect each artifact in turn, as separate collections would
+	sessions := func(paths ...string) map[string]any {
+		res := make(map[string]any)
+		for _, path := range paths {
+			for _, row := range collectArtifact(t, format, path).rows {
+				res[row["time_local"].(string)+" "+row["remote_addr"].(string)] = row["session_id"]
+			}
+		}
+		return res
+	}
+	forward := sessions(first, second)
+	reverse := sessions(second, first)
+	if len(forward) != len(lines) {
+		t.Fatalf("got %d rows, want %d", len(forward), len(lines))
+	}
+	for request, id := range forward {
+		if id == nil || reverse[request] != id {
+			t.Errorf("%s: got session %v collected in order and %v collected in reverse order", request, id, reverse[request])
+		}
+	}
+
+	// the requests within the timeout of each other share a session, across the 12:30 boundary of a fixed window,
+	// and the request after an hour of inactivity starts a new one
+	visitor := func(time string) any { return forward["16/Oct/2024:"+time+" +0000 203.0.113.5"] }
+	if visitor("12:01:00") != visitor("12:25:00") || visitor("12:01:00") != visitor("12:50:00") {
+		t.Error("expected the requests within the timeout of each other to share a session")
+	}
+	if visitor("13:30:00") == visitor("12:50:00") {
+		t.Error("expected the request after the timeout to start a new session")
+	}
+	// sessions are tracked for each artifact, so a session is split where the log file was rotated
+	if visitor("13:31:00") == visitor("13:30:00") {
+		t.Error("expected the request in the next artifact to start a new session")
+	}
+}
+
+func Test_newSessionizer(t *testing.T) {
+	if s, err := newSessionizer(&AccessLogTableFormat{}); s != nil || err != nil {
+		t.Errorf("expected no sessionizer when sessionize is not set, got %v, %v", s, err)
+	}
+	if _, err := newSessionizer(&AccessLogTableFormat{Sessionize: true, SessionTimeout: "soon"}); err == nil {
+		t.Error("expected an error for an invalid session_timeout")
+	}
+	if err := (&AccessLogTableFormat{SessionTimeout: "-5m"}).Validate(); err == nil {
+		t.Error("expected a validation error for a negative session_timeout")
+	}
+}
@@ -0,0 +1,103 @@
+package access_log
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// clientCertFields are the source fields which may contain the client certificate, in order of preference
+var clientCertFields = []string{"ssl_client_cert", "ssl_client_raw_cert", "ssl_client_escaped_cert"}
+
+// enrichClientCert decodes the client certificate, if present, and populates the certificate metadata columns
+//
+// a certificate field redacted by redact_columns is not decoded, so no metadata is stored for it, and the
+// metadata columns are left null if the certificate cannot be parsed, e.g. because the line was truncated
+func enrichClientCert(row *types.DynamicRow, r *redactor) {
+	for _, field := range clientCertFields {
+		value, ok := row.GetSourceValue(field)
+		if !ok || isNullValue(value) || r.redactsColumn(field) {
+			continue
+		}
+
+		cert, err := parseClientCert(value)
+		if err != nil {
+			continue
+		}
+
+		fingerprint := sha256.Sum256(cert.Raw)
+		row.OutputColumns["ssl_client_cert_subject"] = cert.Subject.String()
+		row.OutputColumns["ssl_client_cert_issuer"] = cert.Issuer.String()
+		row.OutputColumns["ssl_client_cert_serial"] = strings.ToUpper(cert.SerialNumber.Text(16))
+		row.OutputColumns["ssl_client_cert_not_before"] = cert.NotBefore.UTC()
+		row.OutputColumns["ssl_client_cert_not_after"] = cert.NotAfter.UTC()
+		row.OutputColumns["ssl_client_cert_sha256_fingerprint"] = hex.EncodeToString(fingerprint[:])
+		if san := certSubjectAltNames(cert); len(san) > 0 {
+			row.OutputColumns["ssl_client_cert_san"] = san
+		}
+		return
+	}
+}
+
+// parseClientCert parses a PEM certificate as written to the access log
+// this may be url encoded ($ssl_client_escaped_cert), and may contain nginx log escapes (\x0A)
+// and the tab continuation characters which nginx adds to $ssl_client_cert
+func parseClientCert(value string) (*x509.Certificate, error) {
+	if strings.Contains(value, "%") {
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+	}
+	value = unescapeLogValue(value)
+	value = strings.ReplaceAll(value, "\t", "")
+
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing client certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// unescapeLogValue reverses the \xXX escaping nginx applies to non-printable characters in access log values
+func unescapeLogValue(value string) string {
+	if !strings.Contains(value, `\x`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if c, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// certSubjectAltNames returns all subject alternative names in the certificate
+func certSubjectAltNames(cert *x509.Certificate) []string {
+	var res []string
+	res = append(res, cert.DNSNames...)
+	res = append(res, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		res = append(res, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		res = append(res, uri.String())
+	}
+	return res
+}
@@ -0,0 +1,183 @@
+package access_log
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// newTestClientCert creates a self signed client certificate, returning the DER bytes and the PEM encoding
+func newTestClientCert(t *testing.T) ([]byte, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(0x1a2b3c),
+		Subject:        pkix.Name{CommonName: "client one", Organization: []string{"Example Ltd"}},
+		Issuer:         pkix.Name{CommonName: "client one", Organization: []string{"Example Ltd"}},
+		NotBefore:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:       []string{"client.example.com"},
+		EmailAddresses: []string{"client@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	return der, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// nginxLoggedCert returns the PEM as nginx writes $ssl_client_cert to the access log:
+// each line after the first is prefixed with a tab, and control characters are written as \xXX
+func nginxLoggedCert(pemCert string) string {
+	lines := strings.Split(strings.TrimSuffix(pemCert, "\n"), "\n")
+	return strings.Join(lines, `\x0A\x09`) + `\x0A`
+}
+
+func Test_parseClientCert(t *testing.T) {
+	der, pemCert := newTestClientCert(t)
+
+	tests := map[string]string{
+		"PEM":              pemCert,
+		"Nginx logged PEM": nginxLoggedCert(pemCert),
+		"URL encoded PEM":  url.QueryEscape(pemCert),
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			cert, err := parseClientCert(value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(cert.Raw, der) {
+				t.Errorf("parsed certificate does not match")
+			}
+		})
+	}
+
+	if _, err := parseClientCert("not a certificate"); err == nil {
+		t.Errorf("expected error for invalid certificate")
+	}
+}
+
+func Test_enrichClientCert(t *testing.T) {
+	der, pemCert := newTestClientCert(t)
+	logged := nginxLoggedCert(pemCert)
+
+	// verify the logged certificate is matched by the layout regex
+	format := &AccessLogTableFormat{Layout: `$remote_addr "$ssl_client_cert" $status`}
+	regex, err := format.GetRegex()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	re := regexp.MustCompile(regex)
+	match := re.FindStringSubmatch(`10.0.0.1 "` + logged + `" 200`)
+	if match == nil {
+		t.Fatalf("regex %s does not match logged certificate", regex)
+	}
+	if got := match[re.SubexpIndex("ssl_client_cert")]; got != logged {
+		t.Fatalf("got ssl_client_cert %q, want %q", got, logged)
+	}
+
+	row := &types.DynamicRow{}
+	_ = row.InitialiseFromMap(map[string]string{"ssl_client_cert": logged})
+	enrichClientCert(row, nil)
+
+	fingerprint := sha256.Sum256(der)
+	want := map[string]any{
+		"ssl_client_cert_subject":            "CN=client one,O=Example Ltd",
+		"ssl_client_cert_issuer":             "CN=client one,O=Example Ltd",
+		"ssl_client_cert_serial":             "1A2B3C",
+		"ssl_client_cert_not_before":         time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"ssl_client_cert_not_after":          time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		"ssl_client_cert_sha256_fingerprint": hex.EncodeToString(fingerprint[:]),
+		"ssl_client_cert_san":                []string{"client.example.com", "client@example.com", "10.0.0.1"},
+	}
+	for k, v := range want {
+		if got := row.OutputColumns[k]; !reflect.DeepEqual(got, v) {
+			t.Errorf("%s: got %v, want %v", k, got, v)
+		}
+	}
+}
+
+func TestAccessLogTable_EnrichRow_RedactedClientCert(t *testing.T) {
+	_, pemCert := newTestClientCert(t)
+	path := filepath.Join(t.TempDir(), "access.log")
+	line := `10.0.0.1 [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 "` + nginxLoggedCert(pemCert) + `"`
+	if err := os.WriteFile(path, []byte(line+"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(nginxLoggedCert(pemCert)))
+
+	for action, wantCert := range map[string]any{
+		RedactActionMask: RedactedValue,
+		RedactActionHash: hex.EncodeToString(mac.Sum(nil)),
+		RedactActionDrop: nil,
+	} {
+		t.Run(action, func(t *testing.T) {
+			res := collectArtifact(t, &AccessLogTableFormat{
+				Name:          "test",
+				Layout:        `$remote_addr [$time_local] "$request" $status "$ssl_client_cert"`,
+				RedactColumns: map[string]string{"ssl_client_cert": action},
+				RedactHashKey: "secret",
+			}, path)
+			if len(res.rows) != 1 {
+				t.Fatalf("got %d rows and row errors for %q, want 1 row", len(res.rows), res.errors)
+			}
+			// no metadata is extracted from a redacted certificate, as it would store what was redacted
+			assertColumns(t, res.rows[0], map[string]any{
+				"ssl_client_cert":                    wantCert,
+				"ssl_client_cert_subject":            nil,
+				"ssl_client_cert_serial":             nil,
+				"ssl_client_cert_san":                nil,
+				"ssl_client_cert_sha256_fingerprint": nil,
+			})
+		})
+	}
+}
+
+func TestAccessLogTable_EnrichRow_InvalidClientCert(t *testing.T) {
+	_, pemCert := newTestClientCert(t)
+	logged := nginxLoggedCert(pemCert)
+	layout := `$remote_addr [$time_local] "$request" $status "$ssl_client_cert"`
+
+	// a certificate with part of its body missing, and one whose body is not base64
+	end := strings.Index(logged, "-----END CERTIFICATE-----")
+	for name, cert := range map[string]string{
+		"truncated":  logged[:end/2] + `\x0A` + logged[end:],
+		"not base64": `-----BEGIN CERTIFICATE-----\x0A\x09not a certificate\x0A-----END CERTIFICATE-----\x0A`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			row := enrichLine(t, layout, `10.0.0.1 [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 "`+cert+`"`)
+			assertColumns(t, row, map[string]any{
+				"status":                             int64(200),
+				"ssl_client_cert":                    cert,
+				"ssl_client_cert_subject":            nil,
+				"ssl_client_cert_not_before":         nil,
+				"ssl_client_cert_sha256_fingerprint": nil,
+			})
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package access_log
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// nginx specific status codes
+const (
+	StatusRequestHeaderTooLarge = 494
+	StatusSSLCertificateError   = 495
+	StatusSSLCertificateMissing = 496
+	StatusHTTPToHTTPS           = 497
+	StatusConnectionClosed      = 444
+	StatusClientClosedRequest   = 499
+)
+
+// values for the error_origin column
+const (
+	ErrorOriginNginx    = "nginx"
+	ErrorOriginUpstream = "upstream"
+)
+
+// parseStatus parses a status code, returning false for nil or invalid values
+func parseStatus(value string) (int, bool) {
+	if isNullValue(value) {
+		return 0, false
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 100 || code > 999 {
+		return 0, false
+	}
+	return code, true
+}
+
+// statusClass returns the class of a status code, e.g. '4xx', or false if the code is outside the classes
+// defined by HTTP (100-599)
+func statusClass(code int) (string, bool) {
+	if code < 100 || code > 599 {
+		return "", false
+	}
+	return fmt.Sprintf("%dxx", code/100), true
+}
+
+func isErrorStatus(code int) bool {
+	return code >= 400
+}
+
+// enrichStatus populates the columns derived from status and upstream_status
+func enrichStatus(row *types.DynamicRow) {
+	var edgeError, upstreamError bool
+
+	if value, ok := row.GetSourceValue("status"); ok {
+		if code, valid := parseStatus(value); valid {
+			edgeError = isErrorStatus(code)
+			if class, ok := statusClass(code); ok {
+				row.OutputColumns["status_class"] = class
+			}
+			row.OutputColumns["is_error"] = edgeError
+			row.OutputColumns["is_connection_closed"] = code == StatusConnectionClosed
+			row.OutputColumns["is_client_closed_request"] = code == StatusClientClosedRequest
+			row.OutputColumns["is_request_header_too_large"] = code == StatusRequestHeaderTooLarge
+			row.OutputColumns["is_ssl_error"] = code == StatusSSLCertificateError || code == StatusSSLCertificateMissing || code == StatusHTTPToHTTPS
+		}
+	}
+
+	if value, ok := row.GetSourceValue("upstream_status"); ok {
+		// with multiple upstream attempts the last status is the one returned to nginx
+		if values := splitUpstreamValues(value); len(values) > 0 {
+			if code, valid := parseStatus(values[len(values)-1]); valid {
+				upstreamError = isErrorStatus(code)
+				if class, ok := statusClass(code); ok {
+					row.OutputColumns["upstream_status_class"] = class
+				}
+				row.OutputColumns["upstream_is_error"] = upstreamError
+			}
+		}
+	}
+
+	// the origin is only set for an error response - an upstream error may be replaced by a successful response,
+	// e.g. by error_page
+	switch {
+	case edgeError && upstreamError:
+		row.OutputColumns["error_origin"] = ErrorOriginUpstream
+	case edgeError:
+		row.OutputColumns["error_origin"] = ErrorOriginNginx
+	}
+}
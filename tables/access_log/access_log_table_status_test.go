@@ -0,0 +1,137 @@
+package access_log
+
+import (
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_enrichStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		source map[string]string
+		want   map[string]any
+	}{
+		{
+			name:   "Success",
+			source: map[string]string{"status": "200"},
+			want: map[string]any{
+				"status_class":             "2xx",
+				"is_error":                 false,
+				"is_client_closed_request": false,
+				"is_ssl_error":             false,
+			},
+		},
+		{
+			name:   "Client closed request",
+			source: map[string]string{"status": "499", "upstream_status": "-"},
+			want: map[string]any{
+				"status_class":             "4xx",
+				"is_error":                 true,
+				"is_client_closed_request": true,
+				"error_origin":             ErrorOriginNginx,
+			},
+		},
+		{
+			name:   "Connection closed",
+			source: map[string]string{"status": "444"},
+			want: map[string]any{
+				"is_connection_closed": true,
+				"error_origin":         ErrorOriginNginx,
+			},
+		},
+		{
+			name:   "SSL certificate error",
+			source: map[string]string{"status": "495"},
+			want: map[string]any{
+				"is_ssl_error":                true,
+				"is_request_header_too_large": false,
+				"error_origin":                ErrorOriginNginx,
+			},
+		},
+		{
+			name:   "Upstream failure",
+			source: map[string]string{"status": "502", "upstream_status": "502"},
+			want: map[string]any{
+				"status_class":          "5xx",
+				"upstream_status_class": "5xx",
+				"upstream_is_error":     true,
+				"error_origin":          ErrorOriginUpstream,
+			},
+		},
+		{
+			name:   "Upstream error replaced by error_page",
+			source: map[string]string{"status": "200", "upstream_status": "500"},
+			want: map[string]any{
+				"status_class":          "2xx",
+				"is_error":              false,
+				"upstream_status_class": "5xx",
+				"upstream_is_error":     true,
+			},
+		},
+		{
+			name:   "Upstream retry succeeded",
+			source: map[string]string{"status": "200", "upstream_status": "504, 200"},
+			want: map[string]any{
+				"upstream_status_class": "2xx",
+				"upstream_is_error":     false,
+			},
+		},
+		{
+			name:   "Status outside the HTTP classes",
+			source: map[string]string{"status": "999", "upstream_status": "999"},
+			want: map[string]any{
+				"status_class":          nil,
+				"upstream_status_class": nil,
+				"is_error":              true,
+				"error_origin":          ErrorOriginUpstream,
+			},
+		},
+		{
+			name:   "Invalid status",
+			source: map[string]string{"status": "0", "upstream_status": "1000"},
+			want: map[string]any{
+				"status_class":          nil,
+				"upstream_status_class": nil,
+				"is_error":              nil,
+			},
+		},
+		{
+			name:   "Nil status",
+			source: map[string]string{"status": "-"},
+			want: map[string]any{
+				"status_class": nil,
+				"is_error":     nil,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &types.DynamicRow{}
+			if err := row.InitialiseFromMap(tt.source); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			enrichStatus(row)
+			for k, want := range tt.want {
+				if got := row.OutputColumns[k]; got != want {
+					t.Errorf("%s: got %v, want %v", k, got, want)
+				}
+			}
+			if _, ok := tt.want["error_origin"]; !ok {
+				if got, ok := row.OutputColumns["error_origin"]; ok {
+					t.Errorf("error_origin: got %v, want unset", got)
+				}
+			}
+		})
+	}
+}
+
+func Test_statusClass(t *testing.T) {
+	for code, want := range map[int]string{0: "", 99: "", 100: "1xx", 200: "2xx", 404: "4xx", 499: "4xx", 599: "5xx", 600: "", 999: "", 1000: ""} {
+		got, ok := statusClass(code)
+		if got != want || ok != (want != "") {
+			t.Errorf("statusClass(%d): got %q, %v, want %q", code, got, ok, want)
+		}
+	}
+}
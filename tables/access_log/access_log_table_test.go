@@ -0,0 +1,366 @@
+package access_log
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_loader"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// the layout of testdata/artifacts/extended.log
+const extendedTestLayout = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $host $server_addr $upstream_addr $upstream_status $upstream_response_time $request_time $msec $https $pipe $connection_requests`
+
+// collectResult is the result of collecting an artifact through the table
+type collectResult struct {
+	// the enriched rows, with each column converted to its schema type
+	rows []map[string]any
+	// the lines which failed to map or enrich
+	errors []string
+}
+
+// collectArtifact collects an artifact as the SDK does for an artifact source: it is loaded a line at a time by the
+// loader for its extension, each line is mapped by the table's mapper and enriched by EnrichRow, and the rows are
+// serialised to JSON as they are when written to the JSONL files
+//
+// each column is then converted to its schema type, failing the test if a value cannot be converted
+func collectArtifact(t *testing.T, format *AccessLogTableFormat, path string) collectResult {
+	t.Helper()
+	ctx := context.Background()
+
+	tbl := &AccessLogTable{}
+	if err := tbl.Initialize(format, tbl.GetTableDefinition()); err != nil {
+		t.Fatalf("unexpected error initializing the table: %v", err)
+	}
+	sourceMetadata, err := tbl.GetSourceMetadata()
+	if err != nil {
+		t.Fatalf("unexpected error getting the source metadata: %v", err)
+	}
+	mapper := sourceMetadata[0].Mapper
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enrichment := schema.NewSourceEnrichment(map[string]string{
+		constants.TpSourceType:     constants.ArtifactSourceIdentifier,
+		constants.TpSourceLocation: path,
+	})
+	info, err := types.NewArtifactInfo(path, enrichment, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var loader artifact_loader.Loader = artifact_loader.NewFileRowLoader()
+	if strings.HasSuffix(path, ".gz") {
+		loader = artifact_loader.NewGzipRowLoader()
+	}
+	rowChan := make(chan *types.RowData)
+	if err := loader.Load(ctx, types.NewDownloadedArtifactInfo(info, path, stat.Size()), rowChan); err != nil {
+		t.Fatalf("unexpected error loading %s: %v", path, err)
+	}
+
+	var res collectResult
+	for rowData := range rowChan {
+		line := rowData.Data.(string)
+		sourceEnrichment := *enrichment
+		sourceEnrichment.CommonFields.TpTable = AccessLogTableIdentifier
+		sourceEnrichment.CommonFields.TpPartition = "test"
+
+		row, err := mapper.Map(ctx, line)
+		if err == nil {
+			row, err = tbl.EnrichRow(row, sourceEnrichment)
+		}
+		if err != nil {
+			res.errors = append(res.errors, line)
+			continue
+		}
+
+		data, err := json.Marshal(row)
+		if err != nil {
+			t.Fatalf("unexpected error marshalling row for line %q: %v", line, err)
+		}
+		var columns map[string]any
+		if err := json.Unmarshal(data, &columns); err != nil {
+			t.Fatalf("unexpected error unmarshalling row for line %q: %v", line, err)
+		}
+		res.rows = append(res.rows, typedRow(t, tbl.GetSchema(), columns))
+	}
+	return res
+}
+
+// typedRow converts each column in the schema to its schema type, dropping columns which are not in the schema
+func typedRow(t *testing.T, tableSchema *schema.TableSchema, columns map[string]any) map[string]any {
+	t.Helper()
+	res := make(map[string]any)
+	for _, column := range tableSchema.Columns {
+		value, ok := columns[column.ColumnName]
+		if !ok {
+			continue
+		}
+		typed, err := typedValue(column.Type, value)
+		if err != nil {
+			t.Errorf("column %s: %v", column.ColumnName, err)
+			continue
+		}
+		res[column.ColumnName] = typed
+	}
+	return res
+}
+
+// typedValue converts a JSON value to a column type, as it would be converted when loaded into the database
+func typedValue(columnType string, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if elementType, ok := strings.CutSuffix(columnType, "[]"); ok {
+		values, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an array for type %s, got %T %v", columnType, value, value)
+		}
+		res := make([]any, len(values))
+		for i, v := range values {
+			typed, err := typedValue(elementType, v)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = typed
+		}
+		return res, nil
+	}
+
+	switch columnType {
+	case "varchar":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case "integer", "bigint":
+		switch v := value.(type) {
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	case "float", "double":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case "timestamp", "date":
+		if s, ok := value.(string); ok {
+			for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+				if ts, err := time.Parse(layout, s); err == nil {
+					return ts.UTC(), nil
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported column type %s", columnType)
+	}
+	return nil, fmt.Errorf("cannot convert %T %v to %s", value, value, columnType)
+}
+
+// gzipArtifact writes a gzip compressed copy of an artifact to a temp dir, returning its path
+func gzipArtifact(t *testing.T, path string) string {
+	t.Helper()
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer src.Close()
+
+	gzPath := filepath.Join(t.TempDir(), filepath.Base(path)+".gz")
+	dst, err := os.Create(gzPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer dst.Close()
+	w := gzip.NewWriter(dst)
+	if _, err := io.Copy(w, src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return gzPath
+}
+
+// assertColumns checks the typed values of the given columns - a nil value checks that the column is null or absent
+func assertColumns(t *testing.T, row map[string]any, want map[string]any) {
+	t.Helper()
+	for column, value := range want {
+		got := row[column]
+		switch value := value.(type) {
+		case time.Time:
+			if gotTime, ok := got.(time.Time); !ok || !gotTime.Equal(value) {
+				t.Errorf("%s: got %v, want %v", column, got, value)
+			}
+		case []any:
+			if gotSlice, ok := got.([]any); !ok || !slices.Equal(gotSlice, value) {
+				t.Errorf("%s: got %v, want %v", column, got, value)
+			}
+		default:
+			if got != value {
+				t.Errorf("%s: got %v (%T), want %v (%T)", column, got, got, value, value)
+			}
+		}
+	}
+}
+
+func TestAccessLogTable_EnrichRow_Combined(t *testing.T) {
+	path := filepath.Join("testdata", "artifacts", "combined.log")
+	for name, path := range map[string]string{"plain": path, "gzip": gzipArtifact(t, path)} {
+		t.Run(name, func(t *testing.T) {
+			res := collectArtifact(t, defaultAccessLogTableFormat, path)
+			if len(res.rows) != 3 {
+				t.Fatalf("got %d rows, want 3", len(res.rows))
+			}
+			if !slices.Equal(res.errors, []string{"this is not an access log line"}) {
+				t.Errorf("got row errors for %q, want the line which is not an access log line", res.errors)
+			}
+
+			// '-' user and referer are null, and the time is normalized to UTC
+			assertColumns(t, res.rows[0], map[string]any{
+				constants.TpTimestamp:      time.Date(2024, 10, 10, 20, 55, 36, 0, time.UTC),
+				constants.TpSourceIP:       "203.0.113.10",
+				constants.TpIps:            []any{"203.0.113.10"},
+				constants.TpUsernames:      nil,
+				constants.TpDomains:        nil,
+				constants.TpTable:          AccessLogTableIdentifier,
+				constants.TpPartition:      "test",
+				constants.TpSourceType:     constants.ArtifactSourceIdentifier,
+				constants.TpSourceLocation: path,
+				"time_zone":                "-07:00",
+				"remote_addr_type":         "reserved",
+				"remote_addr_is_internal":  false,
+				"remote_user":              nil,
+				"http_referer":             nil,
+				"request_method":           "GET",
+				"request_uri":              "/index.html",
+				"http_version":             "1.1",
+				"status":                   int64(200),
+				"status_class":             "2xx",
+				"is_error":                 false,
+				"body_bytes_sent":          int64(2326),
+			})
+			if id, _ := res.rows[0][constants.TpID].(string); id == "" {
+				t.Error("expected tp_id to be set")
+			}
+
+			// an authenticated user over HTTP/2 from an IPv6 client
+			assertColumns(t, res.rows[1], map[string]any{
+				constants.TpTimestamp: time.Date(2024, 10, 10, 20, 55, 37, 0, time.UTC),
+				constants.TpSourceIP:  "2001:db8::1",
+				constants.TpIps:       []any{"2001:db8::1"},
+				constants.TpUsernames: []any{"alice"},
+				"remote_user":         "alice",
+				"http_referer":        "https://shop.example.com/cart",
+				"http_version":        "2",
+				"status":              int64(201),
+			})
+
+			// a TLS handshake sent to a plain HTTP port is logged as the escaped handshake bytes, with no uri or protocol
+			assertColumns(t, res.rows[2], map[string]any{
+				"request_method":  `\x16\x03\x01\x00\xF1`,
+				"request_uri":     nil,
+				"server_protocol": nil,
+				"http_version":    nil,
+				"http_user_agent": nil,
+				"status":          int64(400),
+				"status_class":    "4xx",
+				"is_error":        true,
+			})
+		})
+	}
+}
+
+func TestAccessLogTable_EnrichRow_Extended(t *testing.T) {
+	format := &AccessLogTableFormat{Name: "extended", Layout: extendedTestLayout}
+	res := collectArtifact(t, format, filepath.Join("testdata", "artifacts", "extended.log"))
+	if len(res.errors) > 0 {
+		t.Fatalf("unexpected row errors for %q", res.errors)
+	}
+	if len(res.rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(res.rows))
+	}
+
+	// msec takes precedence over time_local, and upstream addresses are included in tp_ips
+	assertColumns(t, res.rows[0], map[string]any{
+		constants.TpTimestamp:       time.Date(2024, 10, 10, 20, 55, 36, 104e6, time.UTC),
+		constants.TpSourceIP:        "10.0.0.7",
+		constants.TpDestinationIP:   "10.0.0.5",
+		constants.TpIps:             []any{"10.0.0.7", "10.0.0.5", "10.0.1.10", "10.0.1.11"},
+		constants.TpDomains:         []any{"shop.example.com"},
+		constants.TpAkas:            []any{"shop.example.com"},
+		constants.TpUsernames:       []any{"bob"},
+		"time_zone":                 "+00:00",
+		"remote_addr_type":          "private",
+		"remote_addr_is_internal":   true,
+		"upstream_addr":             "10.0.1.11",
+		"upstream_addr_values":      []any{"10.0.1.10", "10.0.1.11"},
+		"upstream_port":             int64(8080),
+		"upstream_port_values":      []any{int64(8080), int64(8080)},
+		"upstream_status":           int64(502),
+		"upstream_status_values":    []any{int64(502), int64(502)},
+		"upstream_attempts":         int64(2),
+		"upstream_is_error":         true,
+		"error_origin":              "upstream",
+		"request_time_ms":           int64(104),
+		"upstream_response_time_ms": int64(2),
+		"msec":                      1728593736.104,
+		"https":                     true,
+		"pipelined":                 true,
+		"connection_requests":       int64(3),
+		"is_keepalive_reuse":        true,
+	})
+
+	// '-' values are null, or false for flags where an empty value means the flag is not set
+	assertColumns(t, res.rows[1], map[string]any{
+		constants.TpTimestamp:       time.Date(2024, 10, 10, 20, 55, 37, 0, time.UTC),
+		constants.TpSourceIP:        "192.0.2.44",
+		constants.TpDestinationIP:   nil,
+		constants.TpIps:             []any{"192.0.2.44"},
+		constants.TpDomains:         nil,
+		constants.TpUsernames:       nil,
+		"host":                      nil,
+		"server_addr":               nil,
+		"upstream_addr":             nil,
+		"upstream_status":           nil,
+		"upstream_response_time_ms": nil,
+		"upstream_addr_values":      nil,
+		"upstream_port":             nil,
+		"request_time_ms":           int64(0),
+		"https":                     false,
+		"pipelined":                 false,
+		"is_keepalive_reuse":        false,
+		"error_origin":              nil,
+	})
+}
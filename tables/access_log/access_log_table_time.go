@@ -0,0 +1,90 @@
+package access_log
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// time layouts written by nginx
+const (
+	// $time_local, the Common Log Format time
+	timeLocalLayout = "02/Jan/2006:15:04:05 -0700"
+	// $time_iso8601 - nginx writes the local time with its offset, which time.RFC3339 also accepts
+	timeISO8601Layout = time.RFC3339
+)
+
+// the layouts accepted for times written without an offset, e.g. by a log_format with a custom time format,
+// which are interpreted in the format's default_time_zone
+const (
+	timeLocalLayoutNoOffset   = "02/Jan/2006:15:04:05"
+	timeISO8601LayoutNoOffset = "2006-01-02T15:04:05"
+)
+
+// the layouts accepted for times written without a date, which are completed with the date of the log file
+const (
+	timeOfDayLayout         = "15:04:05 -0700"
+	timeOfDayLayoutNoOffset = "15:04:05"
+)
+
+// parseTimeLocal parses $time_local, e.g. '10/Oct/2024:13:55:36 -0700'
+// a time without an offset is interpreted in loc
+func parseTimeLocal(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(timeLocalLayout, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(timeLocalLayoutNoOffset, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time_local '%s': expected a time such as '10/Oct/2024:13:55:36 -0700'", value)
+	}
+	return t, nil
+}
+
+// parseTimeISO8601 parses $time_iso8601, e.g. '2024-10-10T13:55:36-07:00'
+// fractional seconds are accepted, and a time without an offset is interpreted in loc
+func parseTimeISO8601(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(timeISO8601Layout, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(timeISO8601LayoutNoOffset, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time_iso8601 '%s': expected a time such as '2024-10-10T13:55:36-07:00'", value)
+	}
+	return t, nil
+}
+
+// parseTimeOfDay parses a time written without a date, e.g. '13:55:36 -0700', as a time on the given date
+// a time without an offset is interpreted in loc
+func parseTimeOfDay(value string, date time.Time, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(timeOfDayLayout, value)
+	if err == nil {
+		loc = t.Location()
+	} else if t, err = time.Parse(timeOfDayLayoutNoOffset, value); err != nil {
+		return time.Time{}, fmt.Errorf("invalid time of day '%s': expected a time such as '13:55:36 -0700'", value)
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+}
+
+// isTimeZoneMismatch returns true if a time was logged with a UTC offset other than that of loc at the time,
+// e.g. because the server's time zone is not the one expected
+// a time logged without an offset is in loc, so never mismatches
+func isTimeZoneMismatch(t time.Time, loc *time.Location) bool {
+	_, offset := t.Zone()
+	_, want := t.In(loc).Zone()
+	return offset != want
+}
+
+// timeZoneOffset returns the UTC offset of a parsed time, e.g. '-07:00'
+func timeZoneOffset(t time.Time) string {
+	return t.Format("-07:00")
+}
+
+// parseMsec parses $msec, the time in seconds with milliseconds resolution since the epoch
+func parseMsec(value string) (time.Time, error) {
+	secs, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(int64(math.Round(secs * 1000))).UTC(), nil
+}
@@ -0,0 +1,341 @@
+package access_log
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_parseTimeLocal(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		value      string
+		loc        *time.Location
+		wantUTC    time.Time
+		wantOffset string
+		wantErr    bool
+	}{
+		{
+			name:       "negative offset",
+			value:      "10/Oct/2024:13:55:36 -0700",
+			loc:        time.UTC,
+			wantUTC:    time.Date(2024, 10, 10, 20, 55, 36, 0, time.UTC),
+			wantOffset: "-07:00",
+		},
+		{
+			name:       "positive offset crossing midnight",
+			value:      "11/Oct/2024:01:30:00 +0530",
+			loc:        time.UTC,
+			wantUTC:    time.Date(2024, 10, 10, 20, 0, 0, 0, time.UTC),
+			wantOffset: "+05:30",
+		},
+		{
+			name:       "logged offset takes precedence over the default zone",
+			value:      "10/Oct/2024:13:55:36 +0000",
+			loc:        berlin,
+			wantUTC:    time.Date(2024, 10, 10, 13, 55, 36, 0, time.UTC),
+			wantOffset: "+00:00",
+		},
+		{
+			name:       "no offset uses the default zone",
+			value:      "10/Oct/2024:13:55:36",
+			loc:        berlin,
+			wantUTC:    time.Date(2024, 10, 10, 11, 55, 36, 0, time.UTC),
+			wantOffset: "+02:00",
+		},
+		{
+			name:       "no offset in winter uses the default zone's standard time",
+			value:      "10/Jan/2024:13:55:36",
+			loc:        berlin,
+			wantUTC:    time.Date(2024, 1, 10, 12, 55, 36, 0, time.UTC),
+			wantOffset: "+01:00",
+		},
+		{
+			name:    "iso 8601 is not accepted",
+			value:   "2024-10-10T13:55:36-07:00",
+			loc:     time.UTC,
+			wantErr: true,
+		},
+		{
+			name:    "invalid month",
+			value:   "10/Foo/2024:13:55:36 -0700",
+			loc:     time.UTC,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeLocal(tt.value, tt.loc)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.UTC().Equal(tt.wantUTC) {
+				t.Errorf("got %v, want %v", got.UTC(), tt.wantUTC)
+			}
+			if offset := timeZoneOffset(got); offset != tt.wantOffset {
+				t.Errorf("got offset %s, want %s", offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func Test_parseTimeISO8601(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		loc        *time.Location
+		wantUTC    time.Time
+		wantOffset string
+		wantErr    bool
+	}{
+		{
+			name:       "offset",
+			value:      "2024-10-10T13:55:36-07:00",
+			loc:        time.UTC,
+			wantUTC:    time.Date(2024, 10, 10, 20, 55, 36, 0, time.UTC),
+			wantOffset: "-07:00",
+		},
+		{
+			name:       "utc",
+			value:      "2024-10-10T13:55:36Z",
+			loc:        time.FixedZone("+02:00", 2*60*60),
+			wantUTC:    time.Date(2024, 10, 10, 13, 55, 36, 0, time.UTC),
+			wantOffset: "+00:00",
+		},
+		{
+			name:       "fractional seconds",
+			value:      "2024-10-10T13:55:36.123+01:00",
+			loc:        time.UTC,
+			wantUTC:    time.Date(2024, 10, 10, 12, 55, 36, 123000000, time.UTC),
+			wantOffset: "+01:00",
+		},
+		{
+			name:       "no offset uses the default zone",
+			value:      "2024-10-10T13:55:36",
+			loc:        time.FixedZone("+02:00", 2*60*60),
+			wantUTC:    time.Date(2024, 10, 10, 11, 55, 36, 0, time.UTC),
+			wantOffset: "+02:00",
+		},
+		{
+			name:    "common log format is not accepted",
+			value:   "10/Oct/2024:13:55:36 -0700",
+			loc:     time.UTC,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeISO8601(tt.value, tt.loc)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.UTC().Equal(tt.wantUTC) {
+				t.Errorf("got %v, want %v", got.UTC(), tt.wantUTC)
+			}
+			if offset := timeZoneOffset(got); offset != tt.wantOffset {
+				t.Errorf("got offset %s, want %s", offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func Test_parseTimeOfDay(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	date := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+
+	got, err := parseTimeOfDay("13:55:36 -0700", date, berlin)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2024, 10, 10, 20, 55, 36, 0, time.UTC); !got.Equal(want) || timeZoneOffset(got) != "-07:00" {
+		t.Errorf("got %v, want %v with offset -07:00", got, want)
+	}
+
+	// a time without an offset uses the default zone's offset on the date, allowing for daylight saving time
+	got, err = parseTimeOfDay("13:55:36", date, berlin)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2024, 10, 10, 11, 55, 36, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	got, err = parseTimeOfDay("13:55:36", date.AddDate(0, 3, 0), berlin)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2025, 1, 10, 12, 55, 36, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"10/Oct/2024:13:55:36 -0700", "25:00:00", "13:55"} {
+		if _, err := parseTimeOfDay(value, date, time.UTC); err == nil {
+			t.Errorf("expected an error for '%s'", value)
+		}
+	}
+}
+
+func Test_isTimeZoneMismatch(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "10/Oct/2024:13:55:36 +0200", want: false},
+		{value: "10/Jan/2024:13:55:36 +0100", want: false},
+		// the summer offset in winter, e.g. a server which does not apply daylight saving time
+		{value: "10/Jan/2024:13:55:36 +0200", want: true},
+		{value: "10/Oct/2024:13:55:36 +0000", want: true},
+		{value: "10/Oct/2024:13:55:36", want: false},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeLocal(tt.value, berlin)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mismatch := isTimeZoneMismatch(got, berlin); mismatch != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.value, mismatch, tt.want)
+		}
+	}
+}
+
+func TestAccessLogTable_EnrichRow_FileDate(t *testing.T) {
+	layout := `$remote_addr [$time_local] "$request" $status`
+	lines := []string{
+		`10.0.0.1 [13:55:36 +0200] "GET / HTTP/1.1" 200`,
+		`10.0.0.1 [13:55:37] "GET / HTTP/1.1" 200`,
+		`10.0.0.1 [13:55:38 +0000] "GET / HTTP/1.1" 200`,
+		`10.0.0.1 [11/Oct/2024:00:00:01 +0200] "GET / HTTP/1.1" 200`,
+	}
+	dir := filepath.Join(t.TempDir(), "2024-10-10")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// times without a date are on the date of the file, and offsets other than the default time zone's are flagged
+	res := collectArtifact(t, &AccessLogTableFormat{Name: "test", Layout: layout, PathTemplate: "{date}/access.log", DefaultTimeZone: "Europe/Berlin"}, path)
+	if len(res.rows) != len(lines) {
+		t.Fatalf("got %d rows and row errors for %q, want %d rows", len(res.rows), res.errors, len(lines))
+	}
+	for i, want := range []map[string]any{
+		{constants.TpTimestamp: time.Date(2024, 10, 10, 11, 55, 36, 0, time.UTC), "time_zone": "+02:00", "time_zone_mismatch": false},
+		{constants.TpTimestamp: time.Date(2024, 10, 10, 11, 55, 37, 0, time.UTC), "time_zone": "+02:00", "time_zone_mismatch": false},
+		{constants.TpTimestamp: time.Date(2024, 10, 10, 13, 55, 38, 0, time.UTC), "time_zone": "+00:00", "time_zone_mismatch": true},
+		// a time with a date does not use the file date
+		{constants.TpTimestamp: time.Date(2024, 10, 10, 22, 0, 1, 0, time.UTC), "time_zone": "+02:00", "time_zone_mismatch": false},
+	} {
+		assertColumns(t, res.rows[i], want)
+	}
+
+	// without a dated path, or a default time zone, a time without a date is invalid and nothing is flagged
+	res = collectArtifact(t, &AccessLogTableFormat{Name: "test", Layout: layout}, path)
+	if len(res.rows) != 1 || !slices.Equal(res.errors, lines[:3]) {
+		t.Fatalf("got %d rows and row errors for %q, want 1 row and errors for the lines without a date", len(res.rows), res.errors)
+	}
+	assertColumns(t, res.rows[0], map[string]any{"time_zone_mismatch": nil})
+}
+
+func TestAccessLogTable_EnrichRow_SourceTimeZone(t *testing.T) {
+	layout := `$remote_addr [$time_local] "$request" $status`
+	accessLine := `203.0.113.5 [16/Oct/2024:00:30:00] "GET /admin HTTP/1.1" 403`
+	metadata := map[string]string{log_file.DefaultTimeZoneMetadataKey: "-07:00"}
+	want := time.Date(2024, 10, 16, 7, 30, 0, 0, time.UTC)
+
+	enrich := func(format *AccessLogTableFormat) *types.DynamicRow {
+		t.Helper()
+		tbl := &AccessLogTable{}
+		if err := tbl.Initialize(format, tbl.GetTableDefinition()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		mapper, err := format.GetMapper()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		row, err := mapper.Map(context.Background(), accessLine)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		row, err = tbl.EnrichRow(row, *schema.NewSourceEnrichment(metadata))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return row
+	}
+
+	// without a format time zone, the source's default_time_zone is used
+	row := enrich(&AccessLogTableFormat{Name: "test", Layout: layout})
+	if got := row.OutputColumns[constants.TpTimestamp]; got != want {
+		t.Errorf("tp_timestamp: got %v, want %v", got, want)
+	}
+	if got := row.OutputColumns["time_zone_mismatch"]; got != false {
+		t.Errorf("time_zone_mismatch: got %v, want false", got)
+	}
+
+	// the format's default_time_zone takes precedence over the source's
+	row = enrich(&AccessLogTableFormat{Name: "test", Layout: layout, DefaultTimeZone: "+02:00"})
+	if got, want := row.OutputColumns[constants.TpTimestamp], time.Date(2024, 10, 15, 22, 30, 0, 0, time.UTC); got != want {
+		t.Errorf("tp_timestamp: got %v, want %v", got, want)
+	}
+
+	// the source's time zone is passed to the extractors of the derived tables
+	mapper, err := (&AccessLogTableFormat{Layout: layout}).GetMapper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := log_file.WithTimeZone(context.Background(), time.FixedZone("-07:00", -7*60*60))
+	rows, err := newAccessLogRollupExtractor(mapper, time.Minute, nil, nil).Extract(ctx, []byte(accessLine))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rollup rows, want 1", len(rows))
+	}
+	if got := rows[0].(*types.DynamicRow).OutputColumns[constants.TpTimestamp]; got != want {
+		t.Errorf("rollup tp_timestamp: got %v, want %v", got, want)
+	}
+	rows, err = newAccessLogSessionExtractor(mapper, DefaultSessionTimeout, "", nil, nil).Extract(ctx, []byte(accessLine))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d session rows, want 1", len(rows))
+	}
+	if got := rows[0].(*types.DynamicRow).OutputColumns["session_start"]; got != want {
+		t.Errorf("session_start: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package access_log
+
+import (
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// timingVariables are the variables holding a time in seconds with millisecond resolution, other than the upstream
+// times, which are output with the other upstream variables
+// each is output in milliseconds, as an integer column named with a '_ms' suffix
+var timingVariables = []string{
+	"request_time",
+	"connection_time",
+}
+
+// isTimingVariable returns true for the variables which are output in milliseconds, to a column named with a
+// '_ms' suffix
+func isTimingVariable(variable string) bool {
+	return slices.Contains(timingVariables, variable) || upstreamMultiValueVariables[variable] == upstreamValueMilliseconds
+}
+
+// parseMilliseconds parses a time written by nginx in seconds with millisecond resolution (e.g. '0.045'),
+// returning the time in milliseconds, or false for nil or invalid values
+func parseMilliseconds(value string) (int64, bool) {
+	if isNullValue(value) {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0, false
+	}
+	return int64(math.Round(seconds * 1000)), true
+}
+
+// enrichTimings populates the millisecond column for each timing variable present in the row
+func enrichTimings(row *types.DynamicRow) {
+	for _, variable := range timingVariables {
+		value, ok := row.GetSourceValue(variable)
+		if !ok {
+			continue
+		}
+		if ms, valid := parseMilliseconds(value); valid {
+			row.OutputColumns[variable+"_ms"] = ms
+		} else {
+			row.OutputColumns[variable+"_ms"] = nil
+		}
+	}
+}
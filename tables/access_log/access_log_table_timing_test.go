@@ -0,0 +1,99 @@
+package access_log
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_parseMilliseconds(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   int64
+		wantOk bool
+	}{
+		{value: "0.045", want: 45, wantOk: true},
+		{value: "0.000", want: 0, wantOk: true},
+		{value: "60.001", want: 60001, wantOk: true},
+		// float rounding must not lose a millisecond
+		{value: "0.029", want: 29, wantOk: true},
+		{value: "1", want: 1000, wantOk: true},
+		{value: "-", wantOk: false},
+		{value: "", wantOk: false},
+		{value: "-1.000", wantOk: false},
+		{value: "NaN", wantOk: false},
+		{value: "fast", wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseMilliseconds(tt.value)
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("parseMilliseconds(%q): got %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func Test_enrichTimings(t *testing.T) {
+	tests := []struct {
+		name   string
+		source map[string]string
+		want   map[string]any
+	}{
+		{
+			name: "Request and connection times",
+			source: map[string]string{
+				"request_time":    "0.104",
+				"connection_time": "12.500",
+			},
+			want: map[string]any{
+				"request_time_ms":    int64(104),
+				"connection_time_ms": int64(12500),
+			},
+		},
+		{
+			name: "No values",
+			source: map[string]string{
+				"request_time":    "-",
+				"connection_time": "",
+			},
+			want: map[string]any{
+				"request_time_ms":    nil,
+				"connection_time_ms": nil,
+			},
+		},
+		{
+			name: "No timing variables",
+			// upstream times are output with the other upstream variables
+			source: map[string]string{"status": "200", "upstream_response_time": "0.010"},
+			want:   map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &types.DynamicRow{}
+			if err := row.InitialiseFromMap(tt.source); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			enrichTimings(row)
+			if !reflect.DeepEqual(row.OutputColumns, tt.want) {
+				t.Errorf("got %v, want %v", row.OutputColumns, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isTimingVariable(t *testing.T) {
+	for variable, want := range map[string]bool{
+		"request_time":           true,
+		"connection_time":        true,
+		"upstream_response_time": true,
+		"upstream_queue_time":    true,
+		"upstream_status":        false,
+		"msec":                   false,
+		"request_time_ms":        false,
+	} {
+		if got := isTimingVariable(variable); got != want {
+			t.Errorf("isTimingVariable(%q): got %v, want %v", variable, got, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package access_log
+
+import (
+	"strconv"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+// upstream value types
+const (
+	upstreamValueAddress      = "address"
+	upstreamValueInt          = "integer"
+	upstreamValueMilliseconds = "milliseconds"
+)
+
+// upstreamMultiValueVariables are the upstream variables which contain a value per upstream server contacted,
+// keyed by variable name, with the type of each value
+var upstreamMultiValueVariables = map[string]string{
+	"upstream_addr":            upstreamValueAddress,
+	"upstream_status":          upstreamValueInt,
+	"upstream_connect_time":    upstreamValueMilliseconds,
+	"upstream_header_time":     upstreamValueMilliseconds,
+	"upstream_response_time":   upstreamValueMilliseconds,
+	"upstream_queue_time":      upstreamValueMilliseconds,
+	"upstream_bytes_received":  upstreamValueInt,
+	"upstream_bytes_sent":      upstreamValueInt,
+	"upstream_response_length": upstreamValueInt,
+}
+
+// upstream cache statuses for which the response was served from the cache
+var upstreamCacheHitStatuses = map[string]bool{
+	"HIT":         true,
+	"STALE":       true,
+	"UPDATING":    true,
+	"REVALIDATED": true,
+	"MISS":        false,
+	"BYPASS":      false,
+	"EXPIRED":     false,
+}
+
+// enrichUpstream parses the multi-value upstream variables and derives the cache columns
+//
+// for each multi-value variable, the column holds the value for the last upstream server contacted
+// (i.e. the one whose response was used) and the '_values' column holds the values for all servers
+// times are output in milliseconds, to columns named with a '_ms' suffix, and addresses are split into the
+// upstream_addr and upstream_port columns
+func enrichUpstream(row *types.DynamicRow) {
+	var attempts int
+	for variable, valueType := range upstreamMultiValueVariables {
+		column := variable
+		if valueType == upstreamValueMilliseconds {
+			column += "_ms"
+		}
+		value, ok := row.GetSourceValue(variable)
+		if !ok {
+			continue
+		}
+		// a variable with no value may be empty rather than '-', which the column's null_if does not match
+		if isNullValue(value) {
+			row.OutputColumns[column] = nil
+			continue
+		}
+		values := splitUpstreamValues(value)
+		if len(values) == 0 {
+			continue
+		}
+
+		parsed := make([]any, len(values))
+		for i, v := range values {
+			parsed[i] = parseUpstreamValue(v, valueType)
+		}
+		row.OutputColumns[column] = parsed[len(parsed)-1]
+		row.OutputColumns[column+"_values"] = parsed
+		attempts = max(attempts, len(values))
+
+		if valueType == upstreamValueAddress {
+			ports := make([]any, len(values))
+			for i, v := range values {
+				_, ports[i] = splitAddress(v)
+			}
+			row.OutputColumns["upstream_port"] = ports[len(ports)-1]
+			row.OutputColumns["upstream_port_values"] = ports
+		}
+	}
+	if attempts > 0 {
+		row.OutputColumns["upstream_attempts"] = attempts
+	}
+
+	if value, ok := row.GetSourceValue("upstream_cache_status"); ok && !isNullValue(value) {
+		if hit, known := upstreamCacheHitStatuses[value]; known {
+			row.OutputColumns["cache_hit"] = hit
+		}
+	}
+}
+
+// parseUpstreamValue converts a single upstream value to the given type, returning nil for nil or invalid values
+func parseUpstreamValue(value, valueType string) any {
+	if isNullValue(value) {
+		return nil
+	}
+	switch valueType {
+	case upstreamValueInt:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return i
+	case upstreamValueMilliseconds:
+		ms, valid := parseMilliseconds(value)
+		if !valid {
+			return nil
+		}
+		return ms
+	case upstreamValueAddress:
+		addr, _ := splitAddress(value)
+		return addr
+	default:
+		return value
+	}
+}
@@ -0,0 +1,106 @@
+package access_log
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-sdk/types"
+)
+
+func Test_enrichUpstream(t *testing.T) {
+	tests := []struct {
+		name   string
+		source map[string]string
+		want   map[string]any
+	}{
+		{
+			name: "Single upstream",
+			source: map[string]string{
+				"upstream_addr":           "10.0.0.1:80",
+				"upstream_status":         "200",
+				"upstream_response_time":  "0.123",
+				"upstream_bytes_received": "5120",
+				"upstream_cache_status":   "HIT",
+			},
+			want: map[string]any{
+				"upstream_addr":                    "10.0.0.1",
+				"upstream_addr_values":             []any{"10.0.0.1"},
+				"upstream_port":                    int64(80),
+				"upstream_port_values":             []any{int64(80)},
+				"upstream_status":                  int64(200),
+				"upstream_status_values":           []any{int64(200)},
+				"upstream_response_time_ms":        int64(123),
+				"upstream_response_time_ms_values": []any{int64(123)},
+				"upstream_bytes_received":          int64(5120),
+				"upstream_bytes_received_values":   []any{int64(5120)},
+				"upstream_attempts":                1,
+				"cache_hit":                        true,
+			},
+		},
+		{
+			name: "Retried upstreams",
+			source: map[string]string{
+				"upstream_addr":          "10.0.0.1:80, 10.0.0.2:80 : 10.0.1.1:80",
+				"upstream_status":        "502, - : 200",
+				"upstream_response_time": "0.001, - : 0.123",
+				"upstream_connect_time":  "1.000, 0.002",
+				"upstream_header_time":   "-, 0.040",
+				"upstream_cache_status":  "MISS",
+			},
+			want: map[string]any{
+				"upstream_addr":                    "10.0.1.1",
+				"upstream_addr_values":             []any{"10.0.0.1", "10.0.0.2", "10.0.1.1"},
+				"upstream_port":                    int64(80),
+				"upstream_port_values":             []any{int64(80), int64(80), int64(80)},
+				"upstream_status":                  int64(200),
+				"upstream_status_values":           []any{int64(502), nil, int64(200)},
+				"upstream_response_time_ms":        int64(123),
+				"upstream_response_time_ms_values": []any{int64(1), nil, int64(123)},
+				"upstream_connect_time_ms":         int64(2),
+				"upstream_connect_time_ms_values":  []any{int64(1000), int64(2)},
+				"upstream_header_time_ms":          int64(40),
+				"upstream_header_time_ms_values":   []any{nil, int64(40)},
+				"upstream_attempts":                3,
+				"cache_hit":                        false,
+			},
+		},
+		{
+			name: "IPv6 and unix socket upstreams",
+			source: map[string]string{
+				"upstream_addr": "[2001:db8::10]:8080 : unix:/run/php/php8.3-fpm.sock",
+			},
+			want: map[string]any{
+				"upstream_addr":        "unix:/run/php/php8.3-fpm.sock",
+				"upstream_addr_values": []any{"2001:db8::10", "unix:/run/php/php8.3-fpm.sock"},
+				"upstream_port":        nil,
+				"upstream_port_values": []any{int64(8080), nil},
+				"upstream_attempts":    2,
+			},
+		},
+		{
+			name: "No upstream",
+			source: map[string]string{
+				"upstream_addr":         "-",
+				"upstream_status":       "-",
+				"upstream_cache_status": "-",
+			},
+			want: map[string]any{"upstream_addr": nil, "upstream_status": nil},
+		},
+		{
+			name:   "No upstream with escape=json",
+			source: map[string]string{"upstream_addr": "", "upstream_status": "", "upstream_response_time": ""},
+			want:   map[string]any{"upstream_addr": nil, "upstream_status": nil, "upstream_response_time_ms": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := &types.DynamicRow{}
+			_ = row.InitialiseFromMap(tt.source)
+			enrichUpstream(row)
+			if !reflect.DeepEqual(row.OutputColumns, tt.want) {
+				t.Errorf("got %v, want %v", row.OutputColumns, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package error_log
+
+import (
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+// ErrorLog is the row struct for a single nginx error log entry
+type ErrorLog struct {
+	schema.CommonFields
+
+	Timestamp  *time.Time `json:"timestamp,omitempty"`
+	Level      *string    `json:"level,omitempty"`
+	Pid        *int64     `json:"pid,omitempty"`
+	Tid        *int64     `json:"tid,omitempty"`
+	Connection *int64     `json:"connection,omitempty"`
+	Message    *string    `json:"message,omitempty"`
+
+	// context appended to the message when the error relates to a request
+	Client         *string `json:"client,omitempty"`
+	Server         *string `json:"server,omitempty"`
+	Request        *string `json:"request,omitempty"`
+	RequestMethod  *string `json:"request_method,omitempty"`
+	RequestURI     *string `json:"request_uri,omitempty"`
+	ServerProtocol *string `json:"server_protocol,omitempty"`
+	Subrequest     *string `json:"subrequest,omitempty"`
+	Upstream       *string `json:"upstream,omitempty"`
+	Host           *string `json:"host,omitempty"`
+	Referrer       *string `json:"referrer,omitempty"`
+
+	RequestKey *string `json:"request_key,omitempty"`
+
+	// the time as logged, in the local time of the server - the timestamp is parsed in the source's time zone
+	// and stored in UTC when the row is enriched
+	loggedTime string
+}
+
+func (l *ErrorLog) GetColumnDescriptions() map[string]string {
+	return map[string]string{
+		"timestamp":       "The time the entry was logged, in UTC, converted from the local time of the server using the default_time_zone of the nginx_log_file source",
+		"level":           "The severity of the entry, e.g. 'error', 'warn' or 'crit'",
+		"pid":             "The process ID of the nginx worker that logged the entry",
+		"tid":             "The thread ID of the nginx worker that logged the entry",
+		"connection":      "The connection serial number, matching the connection column of nginx_access_log",
+		"message":         "The error message, without the request context",
+		"client":          "The client IP address of the request that caused the error",
+		"server":          "The server name handling the request",
+		"request":         "The request line of the request that caused the error",
+		"request_method":  "The HTTP method of the request",
+		"request_uri":     "The URI of the request",
+		"server_protocol": "The protocol of the request",
+		"subrequest":      "The URI of the subrequest that caused the error",
+		"upstream":        "The upstream server URL being contacted when the error occurred",
+		"host":            "The Host request header",
+		"referrer":        "The Referer request header",
+		"request_key":     "Key identifying the request by server name, worker PID, connection, date and request line, matching the request_key of nginx_access_log",
+
+		// Override table specific tp_* column descriptions
+		"tp_source_ip": "The client IP address",
+		"tp_ips":       "IP addresses related to the entry",
+		"tp_domains":   "The host requested",
+	}
+}
@@ -0,0 +1,110 @@
+package error_log
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/mappers"
+)
+
+// errorLogTimeLayout is the layout of the error log time, which is in the local time of the server
+const errorLogTimeLayout = "2006/01/02 15:04:05"
+
+var (
+	// e.g. 2024/10/16 12:00:00 [error] 1234#1234: *5678 upstream timed out (110: Connection timed out) while reading response header from upstream, client: 203.0.113.5, ...
+	errorLogRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] (\d+)#(\d+): (?:\*(\d+) )?(.*)$`)
+	// the request context appended to the message, e.g. ', client: 203.0.113.5, server: example.com, request: "GET / HTTP/1.1"'
+	errorLogContextRegex = regexp.MustCompile(`, (client|server|request|subrequest|upstream|host|referrer): ("(?:[^"\\]|\\.)*"|[^,]*)`)
+)
+
+// ErrorLogMapper maps a single error log line to a row
+type ErrorLogMapper struct {
+}
+
+func (c *ErrorLogMapper) Identifier() string {
+	return "nginx_error_log_mapper"
+}
+
+func (c *ErrorLogMapper) Map(_ context.Context, a any, _ ...mappers.MapOption[*ErrorLog]) (*ErrorLog, error) {
+	line, ok := a.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got %T", a)
+	}
+
+	match := errorLogRegex.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if match == nil {
+		return nil, fmt.Errorf("invalid error log line")
+	}
+
+	row := &ErrorLog{
+		Level:      &match[2],
+		Pid:        parseInt(match[3]),
+		Tid:        parseInt(match[4]),
+		Connection: parseInt(match[5]),
+	}
+	// the time is parsed as UTC here, and again in the source's time zone when the row is enriched
+	t, err := time.ParseInLocation(errorLogTimeLayout, match[1], time.UTC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid error log time '%s': %w", match[1], err)
+	}
+	row.Timestamp = &t
+	row.loggedTime = match[1]
+
+	message := match[6]
+	// the request context starts with the client, which is always logged for request errors
+	if i := strings.Index(message, ", client: "); i >= 0 {
+		row.parseContext(message[i:])
+		message = message[:i]
+	}
+	row.Message = &message
+
+	return row, nil
+}
+
+// parseContext parses the request context appended to the message
+func (l *ErrorLog) parseContext(context string) {
+	for _, m := range errorLogContextRegex.FindAllStringSubmatch(context, -1) {
+		// values are quoted as logged, without unescaping, so they match the access log values
+		value := strings.TrimSuffix(strings.TrimPrefix(m[2], `"`), `"`)
+		if value == "" {
+			continue
+		}
+		switch m[1] {
+		case "client":
+			l.Client = &value
+		case "server":
+			l.Server = &value
+		case "request":
+			l.Request = &value
+			if parts := strings.Fields(value); len(parts) > 0 {
+				l.RequestMethod = &parts[0]
+				if len(parts) > 1 {
+					l.RequestURI = &parts[1]
+				}
+				if len(parts) > 2 {
+					l.ServerProtocol = &parts[2]
+				}
+			}
+		case "subrequest":
+			l.Subrequest = &value
+		case "upstream":
+			l.Upstream = &value
+		case "host":
+			l.Host = &value
+		case "referrer":
+			l.Referrer = &value
+		}
+	}
+}
+
+func parseInt(value string) *int64 {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &i
+}
@@ -0,0 +1,85 @@
+package error_log
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_ErrorLogMapper_Map(t *testing.T) {
+	line := `2024/10/16 12:00:00 [error] 1234#1234: *5678 upstream timed out (110: Connection timed out) while reading response header from upstream, client: 203.0.113.5, server: example.com, request: "GET /api/users?id=1 HTTP/1.1", upstream: "http://10.0.0.1:8080/api/users?id=1", host: "example.com", referrer: "https://example.com/"`
+
+	row, err := (&ErrorLogMapper{}).Map(context.Background(), line)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC); row.Timestamp == nil || !row.Timestamp.Equal(want) {
+		t.Errorf("timestamp: got %v, want %v", row.Timestamp, want)
+	}
+	assertString(t, "level", row.Level, "error")
+	assertInt(t, "pid", row.Pid, 1234)
+	assertInt(t, "tid", row.Tid, 1234)
+	assertInt(t, "connection", row.Connection, 5678)
+	assertString(t, "message", row.Message, "upstream timed out (110: Connection timed out) while reading response header from upstream")
+	assertString(t, "client", row.Client, "203.0.113.5")
+	assertString(t, "server", row.Server, "example.com")
+	assertString(t, "request", row.Request, "GET /api/users?id=1 HTTP/1.1")
+	assertString(t, "request_method", row.RequestMethod, "GET")
+	assertString(t, "request_uri", row.RequestURI, "/api/users?id=1")
+	assertString(t, "server_protocol", row.ServerProtocol, "HTTP/1.1")
+	assertString(t, "upstream", row.Upstream, "http://10.0.0.1:8080/api/users?id=1")
+	assertString(t, "host", row.Host, "example.com")
+	assertString(t, "referrer", row.Referrer, "https://example.com/")
+}
+
+func Test_ErrorLogMapper_Map_NoConnection(t *testing.T) {
+	line := `2024/10/16 12:00:00 [notice] 1#1: signal process started`
+
+	row, err := (&ErrorLogMapper{}).Map(context.Background(), line)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertString(t, "level", row.Level, "notice")
+	assertString(t, "message", row.Message, "signal process started")
+	if row.Connection != nil || row.Request != nil || row.Client != nil {
+		t.Errorf("expected no connection context, got connection %v, request %v, client %v", row.Connection, row.Request, row.Client)
+	}
+}
+
+func Test_ErrorLogMapper_Map_EmptyServer(t *testing.T) {
+	line := `2024/10/16 12:00:00 [info] 29#29: *1 client sent invalid method while reading client request line, client: 192.0.2.1, server: , request: "\x16\x03\x01 /"`
+
+	row, err := (&ErrorLogMapper{}).Map(context.Background(), line)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row.Server != nil {
+		t.Errorf("server: got %q, want nil", *row.Server)
+	}
+	assertString(t, "client", row.Client, "192.0.2.1")
+	assertInt(t, "connection", row.Connection, 1)
+	assertString(t, "request", row.Request, `\x16\x03\x01 /`)
+}
+
+func Test_ErrorLogMapper_Map_Invalid(t *testing.T) {
+	for _, input := range []any{"", "not an error log line", `192.0.2.1 - - [16/Oct/2024:12:00:00 +0000] "GET / HTTP/1.1" 200 0`, 42} {
+		if _, err := (&ErrorLogMapper{}).Map(context.Background(), input); err == nil {
+			t.Errorf("expected error for %v", input)
+		}
+	}
+}
+
+func assertString(t *testing.T, name string, got *string, want string) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %q", name, got, want)
+	}
+}
+
+func assertInt(t *testing.T, name string, got *int64, want int64) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %d", name, got, want)
+	}
+}
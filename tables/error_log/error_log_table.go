@@ -0,0 +1,102 @@
+package error_log
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/access_log"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/error_types"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/table"
+)
+
+const ErrorLogTableIdentifier = "nginx_error_log"
+
+// ErrorLogTable - table for nginx error logs
+type ErrorLogTable struct {
+}
+
+func (c *ErrorLogTable) Identifier() string {
+	return ErrorLogTableIdentifier
+}
+
+func (c *ErrorLogTable) GetDescription() string {
+	return "Nginx error logs record problems encountered by the Nginx web server, including the connection and request context needed to correlate errors with access log entries."
+}
+
+func (c *ErrorLogTable) GetSourceMetadata() ([]*table.SourceMetadata[*ErrorLog], error) {
+	return []*table.SourceMetadata[*ErrorLog]{
+		{
+			// any artifact source
+			SourceName: constants.ArtifactSourceIdentifier,
+			Mapper:     &ErrorLogMapper{},
+			Options: []row_source.RowSourceOption{
+				artifact_source.WithRowPerLine(),
+			},
+		},
+		{
+			// the nginx log file source, which handles rotated and compressed files
+			SourceName: log_file.LogFileSourceIdentifier,
+			Mapper:     &ErrorLogMapper{},
+		},
+	}, nil
+}
+
+func (c *ErrorLogTable) EnrichRow(row *ErrorLog, sourceEnrichmentFields schema.SourceEnrichment) (*ErrorLog, error) {
+	row.CommonFields = sourceEnrichmentFields.CommonFields
+
+	row.TpID = xid.New().String()
+	row.TpIngestTimestamp = time.Now()
+
+	// the error log time is in the local time of the server, which is set by the source's default_time_zone
+	// the error log has no format, so unlike the access log it cannot set a time zone of its own
+	if row.loggedTime != "" {
+		timeZone, err := log_parse.ParseTimeZone(sourceEnrichmentFields.Metadata[log_file.DefaultTimeZoneMetadataKey])
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.ParseInLocation(errorLogTimeLayout, row.loggedTime, timeZone)
+		if err != nil {
+			return nil, error_types.NewRowErrorWithFields(nil, []string{"timestamp"})
+		}
+		t = t.UTC()
+		row.Timestamp = &t
+	}
+	if row.Timestamp == nil {
+		return nil, error_types.NewRowErrorWithFields([]string{"timestamp"}, nil)
+	}
+	row.TpTimestamp = *row.Timestamp
+	row.TpDate = row.Timestamp.Truncate(24 * time.Hour)
+
+	// the key of the request the error relates to, which matches the request_key of the access log
+	// the error log does not record the hostname or server address, so the server is identified by the source's
+	// hostname if set, as it is in the access log, otherwise by the server name
+	if row.Connection != nil && row.Request != nil {
+		var serverName, pid string
+		if row.Server != nil {
+			serverName = *row.Server
+		}
+		if row.Pid != nil {
+			pid = strconv.FormatInt(*row.Pid, 10)
+		}
+		server := access_log.ServerIdentity(sourceEnrichmentFields.Metadata[log_file.HostnameMetadataKey], "", serverName)
+		key := access_log.RequestKey(server, pid, strconv.FormatInt(*row.Connection, 10), *row.Timestamp, *row.Request)
+		row.RequestKey = &key
+	}
+
+	if row.Client != nil {
+		row.TpSourceIP = row.Client
+		row.TpIps = append(row.TpIps, *row.Client)
+	}
+	if row.Host != nil {
+		row.TpDomains = append(row.TpDomains, *row.Host)
+	}
+
+	return row, nil
+}
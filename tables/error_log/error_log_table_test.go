@@ -0,0 +1,214 @@
+package error_log
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/access_log"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+func TestErrorLogTable_EnrichRow_TimeZone(t *testing.T) {
+	line := `2024/10/16 00:30:00 [error] 1234#1234: *5678 access forbidden by rule, client: 203.0.113.5, server: example.com, request: "GET /admin HTTP/1.1"`
+
+	tests := []struct {
+		name     string
+		timeZone string
+		want     time.Time
+	}{
+		{
+			name: "Default",
+			want: time.Date(2024, 10, 16, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "Time zone name",
+			timeZone: "Europe/London",
+			want:     time.Date(2024, 10, 15, 23, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "Offset",
+			timeZone: "-07:00",
+			want:     time.Date(2024, 10, 16, 7, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := (&ErrorLogMapper{}).Map(context.Background(), line)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			metadata := map[string]string{}
+			if tt.timeZone != "" {
+				metadata[log_file.DefaultTimeZoneMetadataKey] = tt.timeZone
+			}
+			row, err = (&ErrorLogTable{}).EnrichRow(row, *schema.NewSourceEnrichment(metadata))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if row.Timestamp == nil || !row.Timestamp.Equal(tt.want) || row.Timestamp.Location() != time.UTC {
+				t.Errorf("timestamp: got %v, want %v", row.Timestamp, tt.want)
+			}
+			if !row.TpTimestamp.Equal(tt.want) {
+				t.Errorf("tp_timestamp: got %v, want %v", row.TpTimestamp, tt.want)
+			}
+			if want := tt.want.Truncate(24 * time.Hour); !row.TpDate.Equal(want) {
+				t.Errorf("tp_date: got %v, want %v", row.TpDate, want)
+			}
+		})
+	}
+}
+
+func TestErrorLogTable_EnrichRow_RequestKey(t *testing.T) {
+	line := `2024/10/16 23:30:00 [error] 1234#1234: *5678 upstream timed out (110: Connection timed out) while reading response header from upstream, client: 203.0.113.5, server: example.com, request: "GET /api/users?id=1 HTTP/1.1"`
+
+	row, err := (&ErrorLogMapper{}).Map(context.Background(), line)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	row, err = (&ErrorLogTable{}).EnrichRow(row, *schema.NewSourceEnrichment(map[string]string{log_file.DefaultTimeZoneMetadataKey: "-07:00"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the date is the UTC date, as in the access log
+	assertString(t, "request_key", row.RequestKey, "example.com/1234/5678/2024-10-17:GET /api/users?id=1 HTTP/1.1")
+
+	// entries which do not relate to a request have no key
+	row, err = (&ErrorLogMapper{}).Map(context.Background(), `2024/10/16 12:00:00 [notice] 1#1: signal process started`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row, err = (&ErrorLogTable{}).EnrichRow(row, *schema.NewSourceEnrichment(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row.RequestKey != nil {
+		t.Errorf("request_key: got %q, want nil", *row.RequestKey)
+	}
+}
+
+func TestErrorLogTable_EnrichRow_AccessLogTimeZone(t *testing.T) {
+	// the same request, logged to the error log and to an access log without a UTC offset
+	errorLine := `2024/10/16 00:30:00 [error] 1234#1234: *5678 access forbidden by rule, client: 203.0.113.5, server: example.com, request: "GET /admin HTTP/1.1"`
+	accessLine := `203.0.113.5 [16/Oct/2024:00:30:00] "GET /admin HTTP/1.1" 403`
+	enrichment := *schema.NewSourceEnrichment(map[string]string{log_file.DefaultTimeZoneMetadataKey: "-07:00"})
+
+	errorRow, err := (&ErrorLogMapper{}).Map(context.Background(), errorLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if errorRow, err = (&ErrorLogTable{}).EnrichRow(errorRow, enrichment); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	format := &access_log.AccessLogTableFormat{Name: "test", Layout: `$remote_addr [$time_local] "$request" $status`}
+	accessTable := &access_log.AccessLogTable{}
+	if err := accessTable.Initialize(format, accessTable.GetTableDefinition()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mapper, err := format.GetMapper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	accessRow, err := mapper.Map(context.Background(), accessLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accessRow, err = accessTable.EnrichRow(accessRow, enrichment); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// both tables use the nginx_log_file source's default_time_zone, so their times agree
+	if got := accessRow.OutputColumns[constants.TpTimestamp]; got != errorRow.TpTimestamp {
+		t.Errorf("access log tp_timestamp: got %v, want the error log's %v", got, errorRow.TpTimestamp)
+	}
+}
+
+func TestErrorLogTable_EnrichRow_AccessLogRequestKey(t *testing.T) {
+	// the same request, logged to the error log and to the access log
+	errorLine := `2024/10/16 23:30:00 [error] 1234#1234: *5678 upstream timed out (110: Connection timed out) while reading response header from upstream, client: 203.0.113.5, server: example.com, request: "GET /api/users?id=1 HTTP/1.1"`
+	accessFields := map[string]string{
+		"hostname":    "web-1",
+		"server_addr": "10.0.0.1",
+		"server_name": "example.com",
+	}
+
+	tests := []struct {
+		name string
+		// the server variables logged by the access log
+		variables []string
+		// the hostname of the nginx_log_file sources
+		hostname string
+	}{
+		{
+			name:      "Server name",
+			variables: []string{"server_name"},
+		},
+		{
+			name:      "Hostname",
+			variables: []string{"hostname", "server_name"},
+			hostname:  "web-1",
+		},
+		{
+			name:      "Server address",
+			variables: []string{"server_addr", "server_name"},
+			hostname:  "web-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := map[string]string{}
+			if tt.hostname != "" {
+				metadata[log_file.HostnameMetadataKey] = tt.hostname
+			}
+			enrichment := *schema.NewSourceEnrichment(metadata)
+
+			errorRow, err := (&ErrorLogMapper{}).Map(context.Background(), errorLine)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if errorRow, err = (&ErrorLogTable{}).EnrichRow(errorRow, enrichment); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			layout := `$remote_addr [$time_local] "$request" $status $pid $connection`
+			accessLine := `203.0.113.5 [16/Oct/2024:23:30:00 +0000] "GET /api/users?id=1 HTTP/1.1" 504 1234 5678`
+			for _, variable := range tt.variables {
+				layout += " $" + variable
+				accessLine += " " + accessFields[variable]
+			}
+			format := &access_log.AccessLogTableFormat{Name: "test", Layout: layout}
+			accessTable := &access_log.AccessLogTable{}
+			if err := accessTable.Initialize(format, accessTable.GetTableDefinition()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			mapper, err := format.GetMapper()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			accessRow, err := mapper.Map(context.Background(), accessLine)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if accessRow, err = accessTable.EnrichRow(accessRow, enrichment); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the request keys join, and identify the server as the connection key does
+			if errorRow.RequestKey == nil {
+				t.Fatalf("request_key: got nil, want %v", accessRow.OutputColumns["request_key"])
+			}
+			if got := accessRow.OutputColumns["request_key"]; got != *errorRow.RequestKey {
+				t.Errorf("access log request_key: got %v, want the error log's %q", got, *errorRow.RequestKey)
+			}
+			connectionKey, _ := accessRow.OutputColumns["connection_key"].(string)
+			if !strings.HasPrefix(*errorRow.RequestKey, connectionKey+":") {
+				t.Errorf("request_key %q is not keyed within connection_key %q", *errorRow.RequestKey, connectionKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package modsecurity_audit_log
+
+import (
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+// ModSecurityAuditLog is the row struct for a single ModSecurity audit log transaction
+type ModSecurityAuditLog struct {
+	schema.CommonFields
+
+	// the audit log format the transaction was parsed from, 'json' or 'native'
+	AuditLogFormat *string    `json:"audit_log_format,omitempty"`
+	TransactionID  *string    `json:"transaction_id,omitempty"`
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+
+	ClientIP   *string `json:"client_ip,omitempty"`
+	ClientPort *int    `json:"client_port,omitempty"`
+	ServerIP   *string `json:"server_ip,omitempty"`
+	ServerPort *int    `json:"server_port,omitempty"`
+	ServerID   *string `json:"server_id,omitempty"`
+
+	RequestMethod    *string           `json:"request_method,omitempty"`
+	RequestURI       *string           `json:"request_uri,omitempty"`
+	RequestProtocol  *string           `json:"request_protocol,omitempty"`
+	RequestHost      *string           `json:"request_host,omitempty"`
+	RequestUserAgent *string           `json:"request_user_agent,omitempty"`
+	RequestHeaders   map[string]string `json:"request_headers,omitempty"`
+
+	ResponseProtocol *string           `json:"response_protocol,omitempty"`
+	ResponseStatus   *int              `json:"response_status,omitempty"`
+	ResponseHeaders  map[string]string `json:"response_headers,omitempty"`
+
+	Producer   *string  `json:"producer,omitempty"`
+	Connector  *string  `json:"connector,omitempty"`
+	RuleEngine *string  `json:"rule_engine,omitempty"`
+	Components []string `json:"components,omitempty"`
+
+	Intercepted        *bool `json:"intercepted,omitempty"`
+	InterventionStatus *int  `json:"intervention_status,omitempty"`
+	InterventionPhase  *int  `json:"intervention_phase,omitempty"`
+
+	Messages        []*ModSecurityAuditLogMessage `json:"messages,omitempty"`
+	RuleIDs         []string                      `json:"rule_ids,omitempty"`
+	RuleMessages    []string                      `json:"rule_messages,omitempty"`
+	RuleTags        []string                      `json:"rule_tags,omitempty"`
+	HighestSeverity *int                          `json:"highest_severity,omitempty"`
+
+	// the time as logged, if it was logged without a UTC offset, in the local time of the server - the timestamp is
+	// parsed in the source's time zone and stored in UTC when the row is enriched
+	loggedTime string
+}
+
+// ModSecurityAuditLogMessage is a single rule match recorded for a transaction
+type ModSecurityAuditLogMessage struct {
+	RuleID    *string  `json:"rule_id,omitempty"`
+	Message   *string  `json:"message,omitempty"`
+	Match     *string  `json:"match,omitempty"`
+	Data      *string  `json:"data,omitempty"`
+	Severity  *int     `json:"severity,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	File      *string  `json:"file,omitempty"`
+	Line      *int     `json:"line,omitempty"`
+	Version   *string  `json:"version,omitempty"`
+	Reference *string  `json:"reference,omitempty"`
+}
+
+// flattenMessages populates the flattened rule columns from the messages
+func (l *ModSecurityAuditLog) flattenMessages() {
+	seenIDs := map[string]struct{}{}
+	seenTags := map[string]struct{}{}
+
+	for _, m := range l.Messages {
+		if m.RuleID != nil {
+			if _, ok := seenIDs[*m.RuleID]; !ok {
+				seenIDs[*m.RuleID] = struct{}{}
+				l.RuleIDs = append(l.RuleIDs, *m.RuleID)
+			}
+		}
+		if m.Message != nil {
+			l.RuleMessages = append(l.RuleMessages, *m.Message)
+		}
+		for _, tag := range m.Tags {
+			if _, ok := seenTags[tag]; !ok {
+				seenTags[tag] = struct{}{}
+				l.RuleTags = append(l.RuleTags, tag)
+			}
+		}
+		// lower severity values are more severe
+		if m.Severity != nil && (l.HighestSeverity == nil || *m.Severity < *l.HighestSeverity) {
+			severity := *m.Severity
+			l.HighestSeverity = &severity
+		}
+	}
+}
+
+func (l *ModSecurityAuditLog) GetColumnDescriptions() map[string]string {
+	return map[string]string{
+		"audit_log_format":    "The ModSecurity audit log format the transaction was read from, either 'json' or 'native'",
+		"transaction_id":      "The unique ID ModSecurity assigned to the transaction",
+		"timestamp":           "The time the transaction was processed, in UTC, converted from the local time of the server using the default_time_zone of the nginx_log_file source if it was logged without a UTC offset",
+		"client_ip":           "The IP address of the client",
+		"client_port":         "The source port of the client connection",
+		"server_ip":           "The IP address of the server that received the request",
+		"server_port":         "The port of the server that received the request",
+		"server_id":           "The server ID configured for the ModSecurity instance",
+		"request_method":      "The HTTP method of the request",
+		"request_uri":         "The URI of the request, including any query string",
+		"request_protocol":    "The protocol of the request, e.g. 'HTTP/1.1'",
+		"request_host":        "The value of the Host request header",
+		"request_user_agent":  "The value of the User-Agent request header",
+		"request_headers":     "The request headers, keyed by header name",
+		"response_protocol":   "The protocol of the response",
+		"response_status":     "The HTTP status code of the response",
+		"response_headers":    "The response headers, keyed by header name",
+		"producer":            "The ModSecurity version that produced the entry",
+		"connector":           "The web server connector that produced the entry, e.g. 'ModSecurity-nginx v1.0.3'",
+		"rule_engine":         "The state of the rule engine, e.g. 'Enabled' or 'DetectionOnly'",
+		"components":          "The rule sets loaded by ModSecurity, e.g. 'OWASP_CRS/4.0.0'",
+		"intercepted":         "Whether ModSecurity intervened and blocked the transaction",
+		"intervention_status": "The HTTP status code returned by the intervention, if the transaction was intercepted",
+		"intervention_phase":  "The processing phase in which the intervention occurred, if logged",
+		"messages":            "The rule matches recorded for the transaction",
+		"rule_ids":            "The distinct IDs of the rules that matched",
+		"rule_messages":       "The messages of the rules that matched",
+		"rule_tags":           "The distinct tags of the rules that matched",
+		"highest_severity":    "The most severe rule severity that matched, from 0 (emergency) to 7 (debug)",
+
+		// Override table specific tp_* column descriptions
+		"tp_ips":            "IP addresses related to the transaction",
+		"tp_source_ip":      "The client IP address",
+		"tp_destination_ip": "The server IP address",
+		"tp_domains":        "The host requested",
+	}
+}
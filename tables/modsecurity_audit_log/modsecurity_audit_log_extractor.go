@@ -0,0 +1,112 @@
+package modsecurity_audit_log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const ModSecurityAuditLogExtractorIdentifier = "nginx_modsecurity_audit_log_extractor"
+
+// native (serial) audit log section boundaries, e.g. '---5XjTqPBN---A--' (v3) or '--5XjTqPBN-A--' (v2)
+var sectionBoundaryRegex = regexp.MustCompile(`^-{2,3}([A-Za-z0-9]+)-{1,3}([A-Z])--$`)
+
+// sections which start and end a native audit log entry
+const (
+	sectionAuditLogHeader  = "A"
+	sectionAuditLogTrailer = "Z"
+)
+
+// ModSecurityAuditLogExtractor splits an audit log file into one string per transaction
+//
+// JSON audit logs contain a transaction per line, whereas native audit logs contain a transaction per
+// set of sections, starting with the 'A' section and ending with the 'Z' section
+type ModSecurityAuditLogExtractor struct {
+}
+
+func NewModSecurityAuditLogExtractor() *ModSecurityAuditLogExtractor {
+	return &ModSecurityAuditLogExtractor{}
+}
+
+func (c *ModSecurityAuditLogExtractor) Identifier() string {
+	return ModSecurityAuditLogExtractorIdentifier
+}
+
+// RecordEnd implements log_file.RecordExtractor, so the nginx_log_file source does not split a native entry between
+// chunks, or collect an entry before ModSecurity has finished writing it
+// a native entry ends with its 'Z' section boundary, and outside a native entry each line is a JSON transaction
+func (c *ModSecurityAuditLogExtractor) RecordEnd() func(line string) bool {
+	inEntry := false
+	return func(line string) bool {
+		if match := sectionBoundaryRegex.FindStringSubmatch(strings.TrimRight(line, "\r")); match != nil {
+			switch match[2] {
+			case sectionAuditLogHeader:
+				inEntry = true
+			case sectionAuditLogTrailer:
+				inEntry = false
+				return true
+			}
+		}
+		return !inEntry
+	}
+}
+
+// Extract implements artifact_source.Extractor
+func (c *ModSecurityAuditLogExtractor) Extract(_ context.Context, a any) ([]any, error) {
+	var data []byte
+	switch v := a.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("expected []byte or string, got %T", a)
+	}
+
+	var res []any
+	var entry strings.Builder
+	inEntry := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// request and response bodies may be logged, so allow for long lines
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if match := sectionBoundaryRegex.FindStringSubmatch(line); match != nil {
+			switch match[2] {
+			case sectionAuditLogHeader:
+				// a new entry - discard any incomplete entry
+				entry.Reset()
+				inEntry = true
+			case sectionAuditLogTrailer:
+				if inEntry {
+					entry.WriteString(line)
+					res = append(res, entry.String())
+				}
+				entry.Reset()
+				inEntry = false
+				continue
+			}
+		}
+
+		if inEntry {
+			entry.WriteString(line)
+			entry.WriteString("\n")
+			continue
+		}
+
+		// outside a native entry, each non-empty JSON line is a transaction
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "{") {
+			res = append(res, trimmed)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	return res, nil
+}
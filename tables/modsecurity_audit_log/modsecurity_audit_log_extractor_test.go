@@ -0,0 +1,69 @@
+package modsecurity_audit_log
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ModSecurityAuditLogExtractor_Extract(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     any
+		wantCount int
+		wantFirst string
+	}{
+		{
+			name:      "JSON lines",
+			input:     []byte(testJSONEntry + "\n\n" + testJSONEntry + "\n"),
+			wantCount: 2,
+			wantFirst: testJSONEntry,
+		},
+		{
+			name:      "Native entries",
+			input:     []byte(testNativeEntry + "\n\n" + testNativeV2Entry + "\n"),
+			wantCount: 2,
+			wantFirst: testNativeEntry,
+		},
+		{
+			name:      "Incomplete native entry is discarded",
+			input:     "---aBcD1234---A--\n[16/Oct/2024:12:00:00 +0000] 1 203.0.113.5 51234 10.0.0.1 443\n" + testNativeEntry,
+			wantCount: 1,
+			wantFirst: testNativeEntry,
+		},
+		{
+			name:      "Empty",
+			input:     []byte{},
+			wantCount: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewModSecurityAuditLogExtractor().Extract(context.Background(), tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != tt.wantCount {
+				t.Fatalf("got %d entries, want %d", len(got), tt.wantCount)
+			}
+			if tt.wantCount > 0 && strings.TrimSpace(got[0].(string)) != tt.wantFirst {
+				t.Errorf("got first entry %q, want %q", got[0], tt.wantFirst)
+			}
+		})
+	}
+}
+
+func Test_ModSecurityAuditLogExtractor_RecordEnd(t *testing.T) {
+	recordEnd := NewModSecurityAuditLogExtractor().RecordEnd()
+	var got []string
+	for _, line := range strings.Split(testJSONEntry+"\n"+testNativeV2Entry+"\n"+testJSONEntry, "\n") {
+		if recordEnd(line) {
+			got = append(got, line)
+		}
+	}
+	// each JSON line ends a record, and a native entry ends with its 'Z' section boundary
+	if want := []string{testJSONEntry, "--5f2a7c1b-Z--", testJSONEntry}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got record ends %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,451 @@
+package modsecurity_audit_log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/mappers"
+)
+
+// values for the audit_log_format column
+const (
+	AuditLogFormatJSON   = "json"
+	AuditLogFormatNative = "native"
+)
+
+const ruleEngineEnabled = "Enabled"
+
+// rule severities, keyed by the names used by ModSecurity v2
+var severityNames = map[string]int{
+	"EMERGENCY": 0,
+	"ALERT":     1,
+	"CRITICAL":  2,
+	"ERROR":     3,
+	"WARNING":   4,
+	"NOTICE":    5,
+	"INFO":      6,
+	"DEBUG":     7,
+}
+
+// timestamp layouts used by the audit log formats, which include a UTC offset
+var timestampLayouts = []string{
+	"02/Jan/2006:15:04:05.000000 -0700",
+	"02/Jan/2006:15:04:05 -0700",
+}
+
+// timestamp layouts used by the audit log formats without a UTC offset, e.g. by the ModSecurity v3 JSON format,
+// which are in the local time of the server
+var localTimestampLayouts = []string{
+	"Mon Jan 02 15:04:05 2006",
+	time.ANSIC,
+}
+
+var (
+	// '[name "value"]' message metadata, where the value may contain escaped quotes
+	messageMetadataRegex = regexp.MustCompile(`\[(\w+) "((?:[^"\\]|\\.)*)"\]`)
+	// 'Action: Intercepted (phase 2)'
+	interceptedActionRegex = regexp.MustCompile(`^Intercepted \(phase (\d)\)`)
+	// 'Access denied with code 403 (phase 2)'
+	accessDeniedRegex = regexp.MustCompile(`Access denied with code (\d{3}) \(phase (\d)\)`)
+)
+
+// ModSecurityAuditLogMapper maps a single audit log transaction, in either JSON or native format, to a row
+type ModSecurityAuditLogMapper struct {
+}
+
+func (c *ModSecurityAuditLogMapper) Identifier() string {
+	return "nginx_modsecurity_audit_log_mapper"
+}
+
+func (c *ModSecurityAuditLogMapper) Map(_ context.Context, a any, _ ...mappers.MapOption[*ModSecurityAuditLog]) (*ModSecurityAuditLog, error) {
+	var input string
+	switch v := a.(type) {
+	case string:
+		input = v
+	case []byte:
+		input = string(v)
+	default:
+		return nil, fmt.Errorf("expected string or []byte, got %T", a)
+	}
+
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("empty audit log entry")
+	}
+
+	var row *ModSecurityAuditLog
+	var err error
+	if strings.HasPrefix(input, "{") {
+		row, err = mapJSONEntry(input)
+	} else {
+		row, err = mapNativeEntry(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	row.flattenMessages()
+	return row, nil
+}
+
+// jsonAuditLog is the structure of a ModSecurity v3 JSON audit log entry
+type jsonAuditLog struct {
+	Transaction struct {
+		ClientIP   string      `json:"client_ip"`
+		TimeStamp  string      `json:"time_stamp"`
+		ServerID   string      `json:"server_id"`
+		ClientPort json.Number `json:"client_port"`
+		HostIP     string      `json:"host_ip"`
+		HostPort   json.Number `json:"host_port"`
+		UniqueID   string      `json:"unique_id"`
+		Request    struct {
+			Method      string            `json:"method"`
+			HttpVersion json.Number       `json:"http_version"`
+			URI         string            `json:"uri"`
+			Headers     map[string]string `json:"headers"`
+		} `json:"request"`
+		Response struct {
+			HttpCode json.Number       `json:"http_code"`
+			Headers  map[string]string `json:"headers"`
+		} `json:"response"`
+		Producer struct {
+			ModSecurity    string   `json:"modsecurity"`
+			Connector      string   `json:"connector"`
+			SecRulesEngine string   `json:"secrules_engine"`
+			Components     []string `json:"components"`
+		} `json:"producer"`
+		Messages []struct {
+			Message string `json:"message"`
+			Details struct {
+				Match      string   `json:"match"`
+				Reference  string   `json:"reference"`
+				RuleID     string   `json:"ruleId"`
+				File       string   `json:"file"`
+				LineNumber string   `json:"lineNumber"`
+				Data       string   `json:"data"`
+				Severity   string   `json:"severity"`
+				Ver        string   `json:"ver"`
+				Tags       []string `json:"tags"`
+			} `json:"details"`
+		} `json:"messages"`
+	} `json:"transaction"`
+}
+
+func mapJSONEntry(input string) (*ModSecurityAuditLog, error) {
+	var entry jsonAuditLog
+	if err := json.Unmarshal([]byte(input), &entry); err != nil {
+		return nil, fmt.Errorf("error parsing JSON audit log entry: %w", err)
+	}
+	tx := entry.Transaction
+
+	row := &ModSecurityAuditLog{
+		AuditLogFormat:   stringPtr(AuditLogFormatJSON),
+		TransactionID:    stringPtr(tx.UniqueID),
+		ClientIP:         stringPtr(tx.ClientIP),
+		ClientPort:       intPtr(tx.ClientPort.String()),
+		ServerIP:         stringPtr(tx.HostIP),
+		ServerPort:       intPtr(tx.HostPort.String()),
+		ServerID:         stringPtr(tx.ServerID),
+		RequestMethod:    stringPtr(tx.Request.Method),
+		RequestURI:       stringPtr(tx.Request.URI),
+		RequestHeaders:   tx.Request.Headers,
+		ResponseStatus:   intPtr(tx.Response.HttpCode.String()),
+		ResponseHeaders:  tx.Response.Headers,
+		Producer:         stringPtr(tx.Producer.ModSecurity),
+		Connector:        stringPtr(tx.Producer.Connector),
+		RuleEngine:       stringPtr(tx.Producer.SecRulesEngine),
+		Components:       tx.Producer.Components,
+		RequestHost:      headerValue(tx.Request.Headers, "Host"),
+		RequestUserAgent: headerValue(tx.Request.Headers, "User-Agent"),
+	}
+	row.setTimestamp(tx.TimeStamp)
+	if v := tx.Request.HttpVersion.String(); v != "" {
+		row.RequestProtocol = stringPtr(httpProtocol(v))
+	}
+
+	for _, m := range tx.Messages {
+		row.Messages = append(row.Messages, &ModSecurityAuditLogMessage{
+			RuleID:    stringPtr(m.Details.RuleID),
+			Message:   stringPtr(m.Message),
+			Match:     stringPtr(m.Details.Match),
+			Data:      stringPtr(m.Details.Data),
+			Severity:  parseSeverity(m.Details.Severity),
+			Tags:      m.Details.Tags,
+			File:      stringPtr(m.Details.File),
+			Line:      intPtr(m.Details.LineNumber),
+			Version:   stringPtr(m.Details.Ver),
+			Reference: stringPtr(m.Details.Reference),
+		})
+	}
+
+	// the JSON format does not record the intervention, so infer it: when the rule engine is enabled
+	// and rules matched, an error response is the result of the intervention
+	if tx.Producer.SecRulesEngine != "" {
+		intercepted := tx.Producer.SecRulesEngine == ruleEngineEnabled && len(row.Messages) > 0 &&
+			row.ResponseStatus != nil && *row.ResponseStatus >= 400
+		row.Intercepted = &intercepted
+		if intercepted {
+			row.InterventionStatus = row.ResponseStatus
+		}
+	}
+
+	return row, nil
+}
+
+func mapNativeEntry(input string) (*ModSecurityAuditLog, error) {
+	sections := map[string][]string{}
+	var current string
+	for _, line := range strings.Split(input, "\n") {
+		if match := sectionBoundaryRegex.FindStringSubmatch(line); match != nil {
+			current = match[2]
+			continue
+		}
+		if current != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	if _, ok := sections[sectionAuditLogHeader]; !ok {
+		return nil, fmt.Errorf("native audit log entry has no '%s' section", sectionAuditLogHeader)
+	}
+
+	row := &ModSecurityAuditLog{
+		AuditLogFormat: stringPtr(AuditLogFormatNative),
+	}
+	if err := row.parseAuditLogHeader(sections[sectionAuditLogHeader]); err != nil {
+		return nil, err
+	}
+	row.parseRequestHeaders(sections["B"])
+	row.parseResponseHeaders(sections["F"])
+	row.parseAuditLogTrailer(sections["H"])
+
+	return row, nil
+}
+
+// parseAuditLogHeader parses the 'A' section, e.g.
+// [16/Oct/2024:12:00:00 +0000] 1729080000.123456 203.0.113.5 51234 10.0.0.1 443
+func (l *ModSecurityAuditLog) parseAuditLogHeader(lines []string) error {
+	line := strings.TrimSpace(strings.Join(lines, " "))
+	if !strings.HasPrefix(line, "[") {
+		return fmt.Errorf("invalid audit log header: %q", line)
+	}
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return fmt.Errorf("invalid audit log header: %q", line)
+	}
+	l.setTimestamp(line[1:end])
+
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 5 {
+		return fmt.Errorf("invalid audit log header: %q", line)
+	}
+	l.TransactionID = stringPtr(fields[0])
+	l.ClientIP = stringPtr(fields[1])
+	l.ClientPort = intPtr(fields[2])
+	l.ServerIP = stringPtr(fields[3])
+	l.ServerPort = intPtr(fields[4])
+	return nil
+}
+
+// parseRequestHeaders parses the 'B' section - the request line followed by the request headers
+func (l *ModSecurityAuditLog) parseRequestHeaders(lines []string) {
+	firstLine, headers := parseHeaderBlock(lines)
+	if parts := strings.Fields(firstLine); len(parts) == 3 {
+		l.RequestMethod = stringPtr(parts[0])
+		l.RequestURI = stringPtr(parts[1])
+		l.RequestProtocol = stringPtr(parts[2])
+	}
+	if len(headers) > 0 {
+		l.RequestHeaders = headers
+		l.RequestHost = headerValue(headers, "Host")
+		l.RequestUserAgent = headerValue(headers, "User-Agent")
+	}
+}
+
+// parseResponseHeaders parses the 'F' section - the status line followed by the response headers
+func (l *ModSecurityAuditLog) parseResponseHeaders(lines []string) {
+	firstLine, headers := parseHeaderBlock(lines)
+	if parts := strings.Fields(firstLine); len(parts) >= 2 {
+		l.ResponseProtocol = stringPtr(parts[0])
+		l.ResponseStatus = intPtr(parts[1])
+	}
+	if len(headers) > 0 {
+		l.ResponseHeaders = headers
+	}
+}
+
+// parseAuditLogTrailer parses the 'H' section, which contains the rule messages and, for v2, the
+// intervention action and producer
+func (l *ModSecurityAuditLog) parseAuditLogTrailer(lines []string) {
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		switch name {
+		// v3 logs rule matches as 'ModSecurity: ...', v2 as 'Message: ...'
+		case "ModSecurity", "Message":
+			l.Messages = append(l.Messages, parseNativeMessage(value))
+			if match := accessDeniedRegex.FindStringSubmatch(value); match != nil {
+				l.setIntervention(match[1], match[2])
+			}
+		case "Action":
+			if match := interceptedActionRegex.FindStringSubmatch(value); match != nil {
+				l.setIntervention("", match[1])
+			}
+		case "Producer":
+			// e.g. 'ModSecurity for nginx (STABLE)/2.9.7 (http://www.modsecurity.org/); OWASP_CRS/3.3.5.'
+			producer, components, _ := strings.Cut(value, "; ")
+			l.Producer = stringPtr(producer)
+			for _, component := range strings.Split(components, "; ") {
+				if component = strings.TrimSuffix(strings.TrimSpace(component), "."); component != "" {
+					l.Components = append(l.Components, component)
+				}
+			}
+		case "Engine-Mode":
+			l.RuleEngine = stringPtr(strings.Trim(value, `"`))
+		}
+	}
+
+	if l.Intercepted == nil && len(l.Messages) > 0 {
+		intercepted := false
+		l.Intercepted = &intercepted
+	}
+}
+
+func (l *ModSecurityAuditLog) setIntervention(status, phase string) {
+	intercepted := true
+	l.Intercepted = &intercepted
+	if status != "" {
+		l.InterventionStatus = intPtr(status)
+	} else if l.InterventionStatus == nil {
+		l.InterventionStatus = l.ResponseStatus
+	}
+	l.InterventionPhase = intPtr(phase)
+}
+
+// parseNativeMessage parses a native format rule message, e.g.
+// Warning. Matched "Operator `Rx' ..." [file "/etc/nginx/rules/REQUEST-941.conf"] [line "55"] [id "941100"] [msg "XSS Attack"] [tag "attack-xss"]
+func parseNativeMessage(value string) *ModSecurityAuditLogMessage {
+	message := &ModSecurityAuditLogMessage{}
+
+	match := value
+	if i := strings.Index(value, " ["); i >= 0 {
+		match = value[:i]
+	}
+	message.Match = stringPtr(strings.TrimSpace(match))
+
+	for _, m := range messageMetadataRegex.FindAllStringSubmatch(value, -1) {
+		v := strings.ReplaceAll(m[2], `\"`, `"`)
+		switch m[1] {
+		case "id":
+			message.RuleID = stringPtr(v)
+		case "msg":
+			message.Message = stringPtr(v)
+		case "data":
+			message.Data = stringPtr(v)
+		case "severity":
+			message.Severity = parseSeverity(v)
+		case "tag":
+			message.Tags = append(message.Tags, v)
+		case "file":
+			message.File = stringPtr(v)
+		case "line":
+			message.Line = intPtr(v)
+		case "ver":
+			message.Version = stringPtr(v)
+		case "ref":
+			message.Reference = stringPtr(v)
+		}
+	}
+	return message
+}
+
+// parseHeaderBlock splits a block of header lines into the first line and a map of headers
+func parseHeaderBlock(lines []string) (string, map[string]string) {
+	var firstLine string
+	headers := map[string]string{}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if firstLine == "" {
+			firstLine = line
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			headers[name] = strings.TrimSpace(value)
+		}
+	}
+	return firstLine, headers
+}
+
+// headerValue returns the value of a header, matching the name case insensitively
+func headerValue(headers map[string]string, name string) *string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return stringPtr(v)
+		}
+	}
+	return nil
+}
+
+// parseSeverity parses a severity given either as a number or a name
+func parseSeverity(value string) *int {
+	if s, ok := severityNames[strings.ToUpper(value)]; ok {
+		return &s
+	}
+	return intPtr(value)
+}
+
+// setTimestamp sets the timestamp from a time logged with a UTC offset, otherwise keeps the time as logged, to be
+// parsed in the source's time zone when the row is enriched
+func (l *ModSecurityAuditLog) setTimestamp(value string) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			l.Timestamp = &t
+			return
+		}
+	}
+	l.loggedTime = value
+}
+
+// parseLocalTimestamp parses a time logged without a UTC offset in the given time zone
+func parseLocalTimestamp(value string, timeZone *time.Location) (time.Time, error) {
+	var err error
+	for _, layout := range localTimestampLayouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, value, timeZone); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// httpProtocol converts the JSON http_version, e.g. 1.1, to a protocol, e.g. 'HTTP/1.1'
+func httpProtocol(version string) string {
+	if f, err := strconv.ParseFloat(version, 64); err == nil && f == float64(int(f)) {
+		version = strconv.Itoa(int(f))
+	}
+	return "HTTP/" + version
+}
+
+func stringPtr(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func intPtr(value string) *int {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &i
+}
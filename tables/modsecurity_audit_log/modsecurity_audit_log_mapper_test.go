@@ -0,0 +1,235 @@
+package modsecurity_audit_log
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+const testJSONEntry = `{"transaction":{"client_ip":"203.0.113.5","time_stamp":"Wed Oct 16 12:00:00 2024","server_id":"c3f2a1","client_port":51234,"host_ip":"10.0.0.1","host_port":443,"unique_id":"172908000012.345678","request":{"method":"GET","http_version":1.1,"uri":"/search?q=<script>alert(1)</script>","headers":{"Host":"example.com","User-Agent":"curl/8.5.0"}},"response":{"http_code":403,"headers":{"Server":"nginx","Content-Type":"text/html"}},"producer":{"modsecurity":"ModSecurity v3.0.12 (Linux)","connector":"ModSecurity-nginx v1.0.3","secrules_engine":"Enabled","components":["OWASP_CRS/4.0.0\""]},"messages":[{"message":"XSS Attack Detected via libinjection","details":{"match":"detected XSS using libinjection.","reference":"v16,25t:utf8toUnicode","ruleId":"941100","file":"/etc/nginx/crs/REQUEST-941-APPLICATION-ATTACK-XSS.conf","lineNumber":"55","data":"Matched Data: XSS data found within ARGS:q: <script>alert(1)</script>","severity":"2","ver":"OWASP_CRS/4.0.0","rev":"","tags":["application-multi","attack-xss"],"maturity":"0","accuracy":"0"}},{"message":"Inbound Anomaly Score Exceeded (Total Score: 5)","details":{"match":"Matched \"Operator ` + "`Ge'" + ` with parameter ` + "`5'" + ` against variable ` + "`TX:BLOCKING_INBOUND_ANOMALY_SCORE'" + ` (Value: ` + "`5'" + ` )","reference":"","ruleId":"949110","file":"/etc/nginx/crs/REQUEST-949-BLOCKING-EVALUATION.conf","lineNumber":"81","data":"","severity":"0","ver":"OWASP_CRS/4.0.0","rev":"","tags":["anomaly-evaluation"],"maturity":"0","accuracy":"0"}}]}}`
+
+const testNativeEntry = `---aBcD1234---A--
+[16/Oct/2024:12:00:00 +0000] 172908000012.345678 203.0.113.5 51234 10.0.0.1 443
+---aBcD1234---B--
+GET /search?q=%3Cscript%3E HTTP/1.1
+Host: example.com
+User-Agent: curl/8.5.0
+
+---aBcD1234---F--
+HTTP/1.1 403
+Server: nginx
+Content-Type: text/html
+
+---aBcD1234---H--
+ModSecurity: Warning. detected XSS using libinjection. [file "/etc/nginx/crs/REQUEST-941-APPLICATION-ATTACK-XSS.conf"] [line "55"] [id "941100"] [rev ""] [msg "XSS Attack Detected via libinjection"] [data "Matched Data: XSS data found within ARGS:q: <script>"] [severity "2"] [ver "OWASP_CRS/4.0.0"] [maturity "0"] [accuracy "0"] [tag "application-multi"] [tag "attack-xss"] [hostname "10.0.0.1"] [uri "/search"] [unique_id "172908000012.345678"] [ref "v16,25t:utf8toUnicode"]
+ModSecurity: Access denied with code 403 (phase 2). Matched "Operator ` + "`Ge'" + ` with parameter ` + "`5'" + `" [file "/etc/nginx/crs/REQUEST-949-BLOCKING-EVALUATION.conf"] [line "81"] [id "949110"] [msg "Inbound Anomaly Score Exceeded (Total Score: 5)"] [severity "0"] [ver "OWASP_CRS/4.0.0"] [tag "anomaly-evaluation"] [tag "attack-xss"]
+
+---aBcD1234---Z--`
+
+const testNativeV2Entry = `--5f2a7c1b-A--
+[16/Oct/2024:12:00:00.123456 +0200] ZxY1AAoAAAEAAAAB 198.51.100.7 40112 10.0.0.2 80
+--5f2a7c1b-B--
+POST /login HTTP/1.1
+Host: shop.example.com
+
+--5f2a7c1b-F--
+HTTP/1.1 406 Not Acceptable
+
+--5f2a7c1b-H--
+Message: Warning. Pattern match "(?i)union.*select" at ARGS:user. [file "/etc/modsecurity/rules/sqli.conf"] [line "12"] [id "942100"] [msg "SQL Injection Attack"] [severity "CRITICAL"] [tag "attack-sqli"]
+Action: Intercepted (phase 2)
+Producer: ModSecurity for nginx (STABLE)/2.9.7 (http://www.modsecurity.org/); OWASP_CRS/3.3.5.
+Engine-Mode: "ENABLED"
+
+--5f2a7c1b-Z--`
+
+func Test_ModSecurityAuditLogMapper_Map_JSON(t *testing.T) {
+	row, err := (&ModSecurityAuditLogMapper{}).Map(context.Background(), testJSONEntry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertString(t, "audit_log_format", row.AuditLogFormat, AuditLogFormatJSON)
+	assertString(t, "transaction_id", row.TransactionID, "172908000012.345678")
+	// the JSON time has no UTC offset, so is parsed in the source's time zone when the row is enriched
+	if row.Timestamp != nil || row.loggedTime != "Wed Oct 16 12:00:00 2024" {
+		t.Errorf("got timestamp %v and logged time %q, want the time as logged", deref(row.Timestamp), row.loggedTime)
+	}
+	assertString(t, "client_ip", row.ClientIP, "203.0.113.5")
+	assertInt(t, "client_port", row.ClientPort, 51234)
+	assertString(t, "server_ip", row.ServerIP, "10.0.0.1")
+	assertInt(t, "server_port", row.ServerPort, 443)
+	assertString(t, "request_method", row.RequestMethod, "GET")
+	assertString(t, "request_protocol", row.RequestProtocol, "HTTP/1.1")
+	assertString(t, "request_host", row.RequestHost, "example.com")
+	assertString(t, "request_user_agent", row.RequestUserAgent, "curl/8.5.0")
+	assertInt(t, "response_status", row.ResponseStatus, 403)
+	assertString(t, "connector", row.Connector, "ModSecurity-nginx v1.0.3")
+	assertString(t, "rule_engine", row.RuleEngine, "Enabled")
+	assertBool(t, "intercepted", row.Intercepted, true)
+	assertInt(t, "intervention_status", row.InterventionStatus, 403)
+	assertInt(t, "highest_severity", row.HighestSeverity, 0)
+
+	if want := []string{"941100", "949110"}; !reflect.DeepEqual(row.RuleIDs, want) {
+		t.Errorf("rule_ids: got %v, want %v", row.RuleIDs, want)
+	}
+	if want := []string{"application-multi", "attack-xss", "anomaly-evaluation"}; !reflect.DeepEqual(row.RuleTags, want) {
+		t.Errorf("rule_tags: got %v, want %v", row.RuleTags, want)
+	}
+	if len(row.Messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(row.Messages))
+	}
+	assertInt(t, "messages[0].line", row.Messages[0].Line, 55)
+	assertString(t, "messages[0].match", row.Messages[0].Match, "detected XSS using libinjection.")
+}
+
+func Test_ModSecurityAuditLogTable_EnrichRow_TimeZone(t *testing.T) {
+	for name, test := range map[string]struct {
+		entry    string
+		metadata map[string]string
+		want     time.Time
+	}{
+		// a time without a UTC offset is in the local time of the server, set by the source's default_time_zone
+		"JSON, UTC server": {
+			entry: testJSONEntry,
+			want:  time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC),
+		},
+		"JSON, non-UTC server": {
+			entry:    testJSONEntry,
+			metadata: map[string]string{log_file.DefaultTimeZoneMetadataKey: "America/New_York"},
+			want:     time.Date(2024, 10, 16, 16, 0, 0, 0, time.UTC),
+		},
+		// a time logged with a UTC offset does not use the default_time_zone
+		"native, non-UTC server": {
+			entry:    testNativeV2Entry,
+			metadata: map[string]string{log_file.DefaultTimeZoneMetadataKey: "America/New_York"},
+			want:     time.Date(2024, 10, 16, 10, 0, 0, 123456000, time.UTC),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			row, err := (&ModSecurityAuditLogMapper{}).Map(context.Background(), test.entry)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			row, err = (&ModSecurityAuditLogTable{}).EnrichRow(row, *schema.NewSourceEnrichment(test.metadata))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertTime(t, row.Timestamp, test.want)
+			if !row.TpTimestamp.Equal(test.want) {
+				t.Errorf("tp_timestamp: got %v, want %v", row.TpTimestamp, test.want)
+			}
+		})
+	}
+}
+
+func Test_ModSecurityAuditLogMapper_Map_Native(t *testing.T) {
+	row, err := (&ModSecurityAuditLogMapper{}).Map(context.Background(), testNativeEntry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertString(t, "audit_log_format", row.AuditLogFormat, AuditLogFormatNative)
+	assertString(t, "transaction_id", row.TransactionID, "172908000012.345678")
+	assertTime(t, row.Timestamp, time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC))
+	assertString(t, "client_ip", row.ClientIP, "203.0.113.5")
+	assertInt(t, "server_port", row.ServerPort, 443)
+	assertString(t, "request_method", row.RequestMethod, "GET")
+	assertString(t, "request_uri", row.RequestURI, "/search?q=%3Cscript%3E")
+	assertString(t, "request_protocol", row.RequestProtocol, "HTTP/1.1")
+	assertString(t, "request_host", row.RequestHost, "example.com")
+	assertInt(t, "response_status", row.ResponseStatus, 403)
+	assertString(t, "response_headers.Server", stringPtr(row.ResponseHeaders["Server"]), "nginx")
+	assertBool(t, "intercepted", row.Intercepted, true)
+	assertInt(t, "intervention_status", row.InterventionStatus, 403)
+	assertInt(t, "intervention_phase", row.InterventionPhase, 2)
+
+	if want := []string{"941100", "949110"}; !reflect.DeepEqual(row.RuleIDs, want) {
+		t.Errorf("rule_ids: got %v, want %v", row.RuleIDs, want)
+	}
+	if want := []string{"XSS Attack Detected via libinjection", "Inbound Anomaly Score Exceeded (Total Score: 5)"}; !reflect.DeepEqual(row.RuleMessages, want) {
+		t.Errorf("rule_messages: got %v, want %v", row.RuleMessages, want)
+	}
+	if want := []string{"application-multi", "attack-xss", "anomaly-evaluation"}; !reflect.DeepEqual(row.RuleTags, want) {
+		t.Errorf("rule_tags: got %v, want %v", row.RuleTags, want)
+	}
+	assertString(t, "messages[0].data", row.Messages[0].Data, "Matched Data: XSS data found within ARGS:q: <script>")
+	assertString(t, "messages[0].match", row.Messages[0].Match, "Warning. detected XSS using libinjection.")
+}
+
+func Test_ModSecurityAuditLogMapper_Map_NativeV2(t *testing.T) {
+	row, err := (&ModSecurityAuditLogMapper{}).Map(context.Background(), testNativeV2Entry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertTime(t, row.Timestamp, time.Date(2024, 10, 16, 10, 0, 0, 123456000, time.UTC))
+	assertString(t, "transaction_id", row.TransactionID, "ZxY1AAoAAAEAAAAB")
+	assertInt(t, "response_status", row.ResponseStatus, 406)
+	assertString(t, "response_protocol", row.ResponseProtocol, "HTTP/1.1")
+	assertBool(t, "intercepted", row.Intercepted, true)
+	assertInt(t, "intervention_status", row.InterventionStatus, 406)
+	assertInt(t, "intervention_phase", row.InterventionPhase, 2)
+	assertInt(t, "highest_severity", row.HighestSeverity, 2)
+	assertString(t, "producer", row.Producer, "ModSecurity for nginx (STABLE)/2.9.7 (http://www.modsecurity.org/)")
+	assertString(t, "rule_engine", row.RuleEngine, "ENABLED")
+	if want := []string{"OWASP_CRS/3.3.5"}; !reflect.DeepEqual(row.Components, want) {
+		t.Errorf("components: got %v, want %v", row.Components, want)
+	}
+}
+
+func Test_ModSecurityAuditLogMapper_Map_Invalid(t *testing.T) {
+	tests := map[string]any{
+		"empty":          "",
+		"invalid JSON":   `{"transaction":`,
+		"missing header": "---aBcD1234---B--\nGET / HTTP/1.1\n---aBcD1234---Z--",
+		"invalid header": "---aBcD1234---A--\nnot a header\n---aBcD1234---Z--",
+		"wrong type":     42,
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := (&ModSecurityAuditLogMapper{}).Map(context.Background(), input); err == nil {
+				t.Errorf("expected error for %v", input)
+			}
+		})
+	}
+}
+
+func assertString(t *testing.T, name string, got *string, want string) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %q", name, deref(got), want)
+	}
+}
+
+func assertInt(t *testing.T, name string, got *int, want int) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %d", name, deref(got), want)
+	}
+}
+
+func assertBool(t *testing.T, name string, got *bool, want bool) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %v", name, deref(got), want)
+	}
+}
+
+func assertTime(t *testing.T, got *time.Time, want time.Time) {
+	t.Helper()
+	if got == nil || !got.Equal(want) {
+		t.Errorf("timestamp: got %v, want %v", deref(got), want)
+	}
+}
+
+func deref[T any](v *T) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
@@ -0,0 +1,93 @@
+package modsecurity_audit_log
+
+import (
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/turbot/tailpipe-plugin-nginx/internal/log_parse"
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/error_types"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/table"
+)
+
+const ModSecurityAuditLogTableIdentifier = "nginx_modsecurity_audit_log"
+
+// ModSecurityAuditLogTable - table for ModSecurity audit logs written by the ModSecurity-nginx connector
+type ModSecurityAuditLogTable struct {
+}
+
+func (c *ModSecurityAuditLogTable) Identifier() string {
+	return ModSecurityAuditLogTableIdentifier
+}
+
+func (c *ModSecurityAuditLogTable) GetDescription() string {
+	return "ModSecurity audit logs capture the transactions inspected by the ModSecurity web application firewall in nginx, including the rules matched and any intervention."
+}
+
+func (c *ModSecurityAuditLogTable) GetSourceMetadata() ([]*table.SourceMetadata[*ModSecurityAuditLog], error) {
+	return []*table.SourceMetadata[*ModSecurityAuditLog]{
+		{
+			// any artifact source
+			// native audit log entries span multiple lines, so load the whole artifact and extract the entries
+			SourceName: constants.ArtifactSourceIdentifier,
+			Mapper:     &ModSecurityAuditLogMapper{},
+			Options: []row_source.RowSourceOption{
+				artifact_source.WithArtifactExtractor(NewModSecurityAuditLogExtractor()),
+			},
+		},
+		{
+			// the nginx log file source, which handles rotated and compressed files
+			// the extractor ends each chunk of lines at the end of an entry, so native entries are not split
+			SourceName: log_file.LogFileSourceIdentifier,
+			Mapper:     &ModSecurityAuditLogMapper{},
+			Options: []row_source.RowSourceOption{
+				log_file.WithExtractor(NewModSecurityAuditLogExtractor()),
+			},
+		},
+	}, nil
+}
+
+func (c *ModSecurityAuditLogTable) EnrichRow(row *ModSecurityAuditLog, sourceEnrichmentFields schema.SourceEnrichment) (*ModSecurityAuditLog, error) {
+	row.CommonFields = sourceEnrichmentFields.CommonFields
+
+	row.TpID = xid.New().String()
+	row.TpIngestTimestamp = time.Now()
+
+	// a time logged without a UTC offset is in the local time of the server, which is set by the source's
+	// default_time_zone
+	if row.loggedTime != "" {
+		timeZone, err := log_parse.ParseTimeZone(sourceEnrichmentFields.Metadata[log_file.DefaultTimeZoneMetadataKey])
+		if err != nil {
+			return nil, err
+		}
+		t, err := parseLocalTimestamp(row.loggedTime, timeZone)
+		if err != nil {
+			return nil, error_types.NewRowErrorWithFields(nil, []string{"timestamp"})
+		}
+		row.Timestamp = &t
+	}
+	if row.Timestamp == nil {
+		return nil, error_types.NewRowErrorWithFields([]string{"timestamp"}, nil)
+	}
+	row.TpTimestamp = *row.Timestamp
+	row.TpDate = row.Timestamp.Truncate(24 * time.Hour)
+
+	if row.ClientIP != nil {
+		row.TpSourceIP = row.ClientIP
+		row.TpIps = append(row.TpIps, *row.ClientIP)
+	}
+	if row.ServerIP != nil {
+		row.TpDestinationIP = row.ServerIP
+		row.TpIps = append(row.TpIps, *row.ServerIP)
+	}
+	if row.RequestHost != nil {
+		row.TpDomains = append(row.TpDomains, *row.RequestHost)
+	}
+	row.TpTags = append(row.TpTags, row.RuleTags...)
+
+	return row, nil
+}
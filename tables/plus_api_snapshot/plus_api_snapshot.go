@@ -0,0 +1,105 @@
+package plus_api_snapshot
+
+import (
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+// values for the zone_type column
+const (
+	ZoneTypeServerZone   = "server_zone"
+	ZoneTypeLocationZone = "location_zone"
+	ZoneTypeUpstreamPeer = "upstream_peer"
+)
+
+// PeerStateUp is the state of a peer which is available to handle requests
+const PeerStateUp = "up"
+
+// PlusApiSnapshot is the row struct for a single zone or upstream peer in a snapshot of the NGINX Plus API
+type PlusApiSnapshot struct {
+	schema.CommonFields
+
+	ZoneType *string `json:"zone_type,omitempty"`
+	Zone     *string `json:"zone,omitempty"`
+
+	// counters common to zones and peers
+	Requests       *int64 `json:"requests,omitempty"`
+	Responses1xx   *int64 `json:"responses_1xx,omitempty"`
+	Responses2xx   *int64 `json:"responses_2xx,omitempty"`
+	Responses3xx   *int64 `json:"responses_3xx,omitempty"`
+	Responses4xx   *int64 `json:"responses_4xx,omitempty"`
+	Responses5xx   *int64 `json:"responses_5xx,omitempty"`
+	ResponsesTotal *int64 `json:"responses_total,omitempty"`
+	Received       *int64 `json:"received,omitempty"`
+	Sent           *int64 `json:"sent,omitempty"`
+
+	// server and location zone counters
+	Processing *int64 `json:"processing,omitempty"`
+	Discarded  *int64 `json:"discarded,omitempty"`
+
+	// upstream peer fields
+	PeerID                *int64     `json:"peer_id,omitempty"`
+	PeerServer            *string    `json:"peer_server,omitempty"`
+	PeerName              *string    `json:"peer_name,omitempty"`
+	PeerBackup            *bool      `json:"peer_backup,omitempty"`
+	PeerWeight            *int64     `json:"peer_weight,omitempty"`
+	PeerState             *string    `json:"peer_state,omitempty"`
+	PeerHealthy           *bool      `json:"peer_healthy,omitempty"`
+	ActiveConnections     *int64     `json:"active_connections,omitempty"`
+	MaxConnections        *int64     `json:"max_connections,omitempty"`
+	Fails                 *int64     `json:"fails,omitempty"`
+	Unavail               *int64     `json:"unavail,omitempty"`
+	HealthChecks          *int64     `json:"health_checks,omitempty"`
+	HealthCheckFails      *int64     `json:"health_check_fails,omitempty"`
+	HealthCheckUnhealthy  *int64     `json:"health_check_unhealthy,omitempty"`
+	HealthCheckLastPassed *bool      `json:"health_check_last_passed,omitempty"`
+	Downtime              *int64     `json:"downtime,omitempty"`
+	HeaderTime            *int64     `json:"header_time,omitempty"`
+	ResponseTime          *int64     `json:"response_time,omitempty"`
+	Selected              *time.Time `json:"selected,omitempty"`
+	UpstreamKeepalive     *int64     `json:"upstream_keepalive,omitempty"`
+	UpstreamZombies       *int64     `json:"upstream_zombies,omitempty"`
+}
+
+func (s *PlusApiSnapshot) GetColumnDescriptions() map[string]string {
+	return map[string]string{
+		"zone_type":                "The type of the row, one of 'server_zone', 'location_zone' or 'upstream_peer'",
+		"zone":                     "The name of the server zone, location zone or upstream",
+		"requests":                 "The total number of client requests received by the zone, or sent to the peer",
+		"responses_1xx":            "The total number of responses with a 1xx status code",
+		"responses_2xx":            "The total number of responses with a 2xx status code",
+		"responses_3xx":            "The total number of responses with a 3xx status code",
+		"responses_4xx":            "The total number of responses with a 4xx status code",
+		"responses_5xx":            "The total number of responses with a 5xx status code",
+		"responses_total":          "The total number of responses",
+		"received":                 "The total number of bytes received",
+		"sent":                     "The total number of bytes sent",
+		"processing":               "The number of client requests currently being processed by the server zone",
+		"discarded":                "The total number of requests completed without sending a response",
+		"peer_id":                  "The ID of the upstream peer",
+		"peer_server":              "The address of the upstream peer",
+		"peer_name":                "The name of the upstream peer as specified in the server directive",
+		"peer_backup":              "Whether the upstream peer is a backup server",
+		"peer_weight":              "The weight of the upstream peer",
+		"peer_state":               "The state of the upstream peer, e.g. 'up', 'down', 'unavail', 'checking', 'unhealthy' or 'draining'",
+		"peer_healthy":             "Whether the upstream peer is up",
+		"active_connections":       "The current number of active connections to the upstream peer",
+		"max_connections":          "The max_conns limit for the upstream peer",
+		"fails":                    "The total number of unsuccessful attempts to communicate with the upstream peer",
+		"unavail":                  "The number of times the upstream peer became unavailable because of failed attempts",
+		"health_checks":            "The total number of health check requests made to the upstream peer",
+		"health_check_fails":       "The number of failed health checks",
+		"health_check_unhealthy":   "The number of times the upstream peer became unhealthy",
+		"health_check_last_passed": "Whether the last health check request was successful",
+		"downtime":                 "The total time in milliseconds the upstream peer has been unavailable",
+		"header_time":              "The average time in milliseconds to get the response header from the upstream peer",
+		"response_time":            "The average time in milliseconds to get the full response from the upstream peer",
+		"selected":                 "The time the upstream peer was last selected to process a request",
+		"upstream_keepalive":       "The current number of idle keepalive connections for the upstream",
+		"upstream_zombies":         "The current number of upstream peers removed from the group but still processing requests",
+
+		// Override table specific tp_* column descriptions
+		"tp_timestamp": "The time the snapshot was taken",
+	}
+}
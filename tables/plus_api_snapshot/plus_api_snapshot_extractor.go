@@ -0,0 +1,210 @@
+package plus_api_snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const PlusApiSnapshotExtractorIdentifier = "nginx_plus_api_snapshot_extractor"
+
+// PlusApiSnapshotExtractor extracts a row per zone or upstream peer from a snapshot of the NGINX Plus API
+//
+// Supported snapshots are the output of:
+//   - /api/N/http/server_zones
+//   - /api/N/http/location_zones
+//   - /api/N/http/upstreams
+//   - /api/N/http/upstreams/{name}
+type PlusApiSnapshotExtractor struct {
+}
+
+func NewPlusApiSnapshotExtractor() *PlusApiSnapshotExtractor {
+	return &PlusApiSnapshotExtractor{}
+}
+
+func (c *PlusApiSnapshotExtractor) Identifier() string {
+	return PlusApiSnapshotExtractorIdentifier
+}
+
+type apiResponses struct {
+	Responses1xx *int64 `json:"1xx"`
+	Responses2xx *int64 `json:"2xx"`
+	Responses3xx *int64 `json:"3xx"`
+	Responses4xx *int64 `json:"4xx"`
+	Responses5xx *int64 `json:"5xx"`
+	Total        *int64 `json:"total"`
+}
+
+type apiZone struct {
+	Processing *int64        `json:"processing"`
+	Requests   *int64        `json:"requests"`
+	Responses  *apiResponses `json:"responses"`
+	Discarded  *int64        `json:"discarded"`
+	Received   *int64        `json:"received"`
+	Sent       *int64        `json:"sent"`
+
+	// only present for upstreams
+	Peers     []*apiPeer `json:"peers"`
+	Keepalive *int64     `json:"keepalive"`
+	Zombies   *int64     `json:"zombies"`
+	Zone      *string    `json:"zone"`
+}
+
+type apiPeer struct {
+	ID           *int64        `json:"id"`
+	Server       *string       `json:"server"`
+	Name         *string       `json:"name"`
+	Backup       *bool         `json:"backup"`
+	Weight       *int64        `json:"weight"`
+	State        *string       `json:"state"`
+	Active       *int64        `json:"active"`
+	MaxConns     *int64        `json:"max_conns"`
+	Requests     *int64        `json:"requests"`
+	HeaderTime   *int64        `json:"header_time"`
+	ResponseTime *int64        `json:"response_time"`
+	Responses    *apiResponses `json:"responses"`
+	Sent         *int64        `json:"sent"`
+	Received     *int64        `json:"received"`
+	Fails        *int64        `json:"fails"`
+	Unavail      *int64        `json:"unavail"`
+	HealthChecks *struct {
+		Checks     *int64 `json:"checks"`
+		Fails      *int64 `json:"fails"`
+		Unhealthy  *int64 `json:"unhealthy"`
+		LastPassed *bool  `json:"last_passed"`
+	} `json:"health_checks"`
+	Downtime *int64     `json:"downtime"`
+	Selected *time.Time `json:"selected"`
+}
+
+// Extract implements artifact_source.Extractor
+func (c *PlusApiSnapshotExtractor) Extract(_ context.Context, a any) ([]any, error) {
+	var data []byte
+	switch v := a.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("expected []byte or string, got %T", a)
+	}
+
+	var res []any
+
+	// a single upstream, i.e. /api/N/http/upstreams/{name}
+	var upstream apiZone
+	if err := json.Unmarshal(data, &upstream); err != nil {
+		return nil, fmt.Errorf("error parsing NGINX Plus API snapshot: %w", err)
+	}
+	if upstream.Peers != nil {
+		if upstream.Zone == nil {
+			return nil, fmt.Errorf("upstream snapshot has no zone")
+		}
+		return upstreamRows(*upstream.Zone, &upstream), nil
+	}
+
+	// a collection of zones or upstreams, keyed by name
+	var zones map[string]*apiZone
+	if err := json.Unmarshal(data, &zones); err != nil {
+		return nil, fmt.Errorf("error parsing NGINX Plus API snapshot: %w", err)
+	}
+	// sort the names so rows are extracted in a consistent order
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		zone := zones[name]
+		if zone == nil {
+			continue
+		}
+		if zone.Peers != nil {
+			res = append(res, upstreamRows(name, zone)...)
+			continue
+		}
+		res = append(res, zoneRow(name, zone))
+	}
+	return res, nil
+}
+
+func zoneRow(name string, zone *apiZone) *PlusApiSnapshot {
+	// only server zones report the number of requests being processed
+	zoneType := ZoneTypeLocationZone
+	if zone.Processing != nil {
+		zoneType = ZoneTypeServerZone
+	}
+
+	row := &PlusApiSnapshot{
+		ZoneType:   &zoneType,
+		Zone:       &name,
+		Requests:   zone.Requests,
+		Received:   zone.Received,
+		Sent:       zone.Sent,
+		Processing: zone.Processing,
+		Discarded:  zone.Discarded,
+	}
+	row.setResponses(zone.Responses)
+	return row
+}
+
+func upstreamRows(name string, upstream *apiZone) []any {
+	res := make([]any, 0, len(upstream.Peers))
+	for _, peer := range upstream.Peers {
+		if peer == nil {
+			continue
+		}
+		zoneType := ZoneTypeUpstreamPeer
+		row := &PlusApiSnapshot{
+			ZoneType:          &zoneType,
+			Zone:              &name,
+			Requests:          peer.Requests,
+			Received:          peer.Received,
+			Sent:              peer.Sent,
+			PeerID:            peer.ID,
+			PeerServer:        peer.Server,
+			PeerName:          peer.Name,
+			PeerBackup:        peer.Backup,
+			PeerWeight:        peer.Weight,
+			PeerState:         peer.State,
+			ActiveConnections: peer.Active,
+			MaxConnections:    peer.MaxConns,
+			Fails:             peer.Fails,
+			Unavail:           peer.Unavail,
+			Downtime:          peer.Downtime,
+			HeaderTime:        peer.HeaderTime,
+			ResponseTime:      peer.ResponseTime,
+			Selected:          peer.Selected,
+			UpstreamKeepalive: upstream.Keepalive,
+			UpstreamZombies:   upstream.Zombies,
+		}
+		if peer.State != nil {
+			healthy := *peer.State == PeerStateUp
+			row.PeerHealthy = &healthy
+		}
+		if hc := peer.HealthChecks; hc != nil {
+			row.HealthChecks = hc.Checks
+			row.HealthCheckFails = hc.Fails
+			row.HealthCheckUnhealthy = hc.Unhealthy
+			row.HealthCheckLastPassed = hc.LastPassed
+		}
+		row.setResponses(peer.Responses)
+		res = append(res, row)
+	}
+	return res
+}
+
+func (s *PlusApiSnapshot) setResponses(responses *apiResponses) {
+	if responses == nil {
+		return
+	}
+	s.Responses1xx = responses.Responses1xx
+	s.Responses2xx = responses.Responses2xx
+	s.Responses3xx = responses.Responses3xx
+	s.Responses4xx = responses.Responses4xx
+	s.Responses5xx = responses.Responses5xx
+	s.ResponsesTotal = responses.Total
+}
@@ -0,0 +1,139 @@
+package plus_api_snapshot
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testUpstreams = `{
+  "backend": {
+    "peers": [
+      {"id": 0, "server": "10.0.0.1:8080", "name": "10.0.0.1:8080", "backup": false, "weight": 1, "state": "up", "active": 3, "requests": 1200,
+       "header_time": 12, "response_time": 20, "responses": {"1xx": 0, "2xx": 1150, "3xx": 10, "4xx": 35, "5xx": 5, "codes": {"200": 1150}, "total": 1200},
+       "sent": 500000, "received": 9000000, "fails": 2, "unavail": 0,
+       "health_checks": {"checks": 100, "fails": 1, "unhealthy": 0, "last_passed": true}, "downtime": 0, "selected": "2024-10-16T11:59:58Z"},
+      {"id": 1, "server": "10.0.0.2:8080", "name": "10.0.0.2:8080", "backup": true, "weight": 1, "state": "unhealthy", "active": 0, "requests": 0,
+       "responses": {"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0, "total": 0}, "sent": 0, "received": 0, "fails": 0, "unavail": 1,
+       "health_checks": {"checks": 100, "fails": 100, "unhealthy": 1, "last_passed": false}, "downtime": 3600000}
+    ],
+    "keepalive": 4,
+    "zombies": 0,
+    "zone": "backend"
+  }
+}`
+
+const testServerZones = `{
+  "www": {"processing": 2, "requests": 5000, "responses": {"1xx": 0, "2xx": 4800, "3xx": 100, "4xx": 90, "5xx": 10, "total": 5000}, "discarded": 3, "received": 1000000, "sent": 20000000},
+  "api": {"processing": 0, "requests": 10, "responses": {"1xx": 0, "2xx": 10, "3xx": 0, "4xx": 0, "5xx": 0, "total": 10}, "discarded": 0, "received": 1000, "sent": 2000}
+}`
+
+const testLocationZones = `{
+  "static": {"requests": 50, "responses": {"1xx": 0, "2xx": 50, "3xx": 0, "4xx": 0, "5xx": 0, "total": 50}, "discarded": 0, "received": 100, "sent": 2000}
+}`
+
+func Test_PlusApiSnapshotExtractor_Extract_Upstreams(t *testing.T) {
+	rows := extract(t, testUpstreams, 2)
+
+	up := rows[0]
+	assertString(t, "zone_type", up.ZoneType, ZoneTypeUpstreamPeer)
+	assertString(t, "zone", up.Zone, "backend")
+	assertString(t, "peer_server", up.PeerServer, "10.0.0.1:8080")
+	assertInt(t, "requests", up.Requests, 1200)
+	assertInt(t, "responses_5xx", up.Responses5xx, 5)
+	assertInt(t, "active_connections", up.ActiveConnections, 3)
+	assertInt(t, "health_checks", up.HealthChecks, 100)
+	assertInt(t, "upstream_keepalive", up.UpstreamKeepalive, 4)
+	assertBool(t, "peer_healthy", up.PeerHealthy, true)
+	if want := time.Date(2024, 10, 16, 11, 59, 58, 0, time.UTC); up.Selected == nil || !up.Selected.Equal(want) {
+		t.Errorf("selected: got %v, want %v", up.Selected, want)
+	}
+
+	down := rows[1]
+	assertString(t, "peer_state", down.PeerState, "unhealthy")
+	assertBool(t, "peer_healthy", down.PeerHealthy, false)
+	assertBool(t, "peer_backup", down.PeerBackup, true)
+	assertBool(t, "health_check_last_passed", down.HealthCheckLastPassed, false)
+	assertInt(t, "downtime", down.Downtime, 3600000)
+	if down.Selected != nil {
+		t.Errorf("selected: got %v, want nil", down.Selected)
+	}
+}
+
+func Test_PlusApiSnapshotExtractor_Extract_SingleUpstream(t *testing.T) {
+	// strip the enclosing upstream name to give the output of /api/N/http/upstreams/backend
+	single := testUpstreams[len(`{
+  "backend": `) : len(testUpstreams)-len("\n}")]
+
+	rows := extract(t, single, 2)
+	assertString(t, "zone", rows[0].Zone, "backend")
+}
+
+func Test_PlusApiSnapshotExtractor_Extract_ServerZones(t *testing.T) {
+	rows := extract(t, testServerZones, 2)
+
+	// rows are ordered by zone name
+	assertString(t, "zone", rows[0].Zone, "api")
+	www := rows[1]
+	assertString(t, "zone_type", www.ZoneType, ZoneTypeServerZone)
+	assertString(t, "zone", www.Zone, "www")
+	assertInt(t, "processing", www.Processing, 2)
+	assertInt(t, "discarded", www.Discarded, 3)
+	assertInt(t, "responses_2xx", www.Responses2xx, 4800)
+	assertInt(t, "responses_total", www.ResponsesTotal, 5000)
+	assertInt(t, "sent", www.Sent, 20000000)
+	if www.PeerHealthy != nil {
+		t.Errorf("peer_healthy: got %v, want nil", *www.PeerHealthy)
+	}
+}
+
+func Test_PlusApiSnapshotExtractor_Extract_LocationZones(t *testing.T) {
+	rows := extract(t, testLocationZones, 1)
+	assertString(t, "zone_type", rows[0].ZoneType, ZoneTypeLocationZone)
+	assertInt(t, "requests", rows[0].Requests, 50)
+}
+
+func Test_PlusApiSnapshotExtractor_Extract_Invalid(t *testing.T) {
+	for _, input := range []any{"", "Active connections: 1", `{"peers": []}`, 42} {
+		if _, err := NewPlusApiSnapshotExtractor().Extract(context.Background(), input); err == nil {
+			t.Errorf("expected error for %v", input)
+		}
+	}
+}
+
+func extract(t *testing.T, input string, wantCount int) []*PlusApiSnapshot {
+	t.Helper()
+	got, err := NewPlusApiSnapshotExtractor().Extract(context.Background(), []byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != wantCount {
+		t.Fatalf("got %d rows, want %d", len(got), wantCount)
+	}
+	rows := make([]*PlusApiSnapshot, len(got))
+	for i, r := range got {
+		rows[i] = r.(*PlusApiSnapshot)
+	}
+	return rows
+}
+
+func assertString(t *testing.T, name string, got *string, want string) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %q", name, got, want)
+	}
+}
+
+func assertInt(t *testing.T, name string, got *int64, want int64) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %d", name, got, want)
+	}
+}
+
+func assertBool(t *testing.T, name string, got *bool, want bool) {
+	t.Helper()
+	if got == nil || *got != want {
+		t.Errorf("%s: got %v, want %v", name, got, want)
+	}
+}
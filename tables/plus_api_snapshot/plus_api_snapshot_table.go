@@ -0,0 +1,66 @@
+package plus_api_snapshot
+
+import (
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/turbot/go-kit/types"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/snapshot"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source_config"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/table"
+)
+
+const PlusApiSnapshotTableIdentifier = "nginx_plus_api_snapshot"
+
+// defaultFileLayout matches snapshots named with the unix time they were taken, e.g. 'upstreams_1729080000.json'
+const defaultFileLayout = `%{DATA}_%{INT:timestamp}.json`
+
+// PlusApiSnapshotTable - table for periodic snapshots of the NGINX Plus API zone and upstream endpoints
+type PlusApiSnapshotTable struct {
+}
+
+func (c *PlusApiSnapshotTable) Identifier() string {
+	return PlusApiSnapshotTableIdentifier
+}
+
+func (c *PlusApiSnapshotTable) GetDescription() string {
+	return "Periodic snapshots of the NGINX Plus API, with a row per server zone, location zone and upstream peer holding the counters and health at the time each snapshot was taken."
+}
+
+func (c *PlusApiSnapshotTable) GetSourceMetadata() ([]*table.SourceMetadata[*PlusApiSnapshot], error) {
+	defaultArtifactConfig := &artifact_source_config.ArtifactSourceConfigImpl{
+		FileLayout: types.String(defaultFileLayout),
+	}
+
+	return []*table.SourceMetadata[*PlusApiSnapshot]{
+		{
+			// any artifact source
+			// each artifact is a single snapshot, from which the extractor returns a row per zone or peer
+			SourceName: constants.ArtifactSourceIdentifier,
+			Options: []row_source.RowSourceOption{
+				artifact_source.WithArtifactExtractor(NewPlusApiSnapshotExtractor()),
+				artifact_source.WithDefaultArtifactSourceConfig(defaultArtifactConfig),
+			},
+		},
+	}, nil
+}
+
+func (c *PlusApiSnapshotTable) EnrichRow(row *PlusApiSnapshot, sourceEnrichmentFields schema.SourceEnrichment) (*PlusApiSnapshot, error) {
+	// the snapshot output contains no time, so use the time from the artifact path
+	timestamp, err := snapshot.Timestamp(sourceEnrichmentFields.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	row.CommonFields = sourceEnrichmentFields.CommonFields
+	row.TpID = xid.New().String()
+	row.TpIngestTimestamp = time.Now()
+	row.TpTimestamp = timestamp
+	row.TpDate = timestamp.Truncate(24 * time.Hour)
+
+	return row, nil
+}
@@ -0,0 +1,59 @@
+// Package snapshot contains helpers shared by the tables which ingest periodic snapshots of nginx status data.
+package snapshot
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+)
+
+// TemplateFieldTimestamp is the file layout field holding the snapshot time, as unix seconds or RFC 3339
+const TemplateFieldTimestamp = "timestamp"
+
+// Timestamp returns the time a snapshot was taken, using the metadata extracted from the artifact path
+//
+// The time is taken from the 'timestamp' field if present, otherwise it is built from the
+// 'year', 'month', 'day', 'hour', 'minute' and 'second' fields, of which the date fields are required
+func Timestamp(metadata map[string]string) (time.Time, error) {
+	if value, ok := metadata[TemplateFieldTimestamp]; ok {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC(), nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid snapshot timestamp '%s'", value)
+		}
+		return t.UTC(), nil
+	}
+
+	fields := []struct {
+		name     string
+		required bool
+	}{
+		{constants.TemplateFieldYear, true},
+		{constants.TemplateFieldMonth, true},
+		{constants.TemplateFieldDay, true},
+		{constants.TemplateFieldHour, false},
+		{constants.TemplateFieldMinute, false},
+		{constants.TemplateFieldSecond, false},
+	}
+	values := make([]int, len(fields))
+	for i, f := range fields {
+		value, ok := metadata[f.name]
+		if !ok {
+			if f.required {
+				return time.Time{}, fmt.Errorf("snapshot time not found in artifact path, file_layout must contain '%s' or '%s'", TemplateFieldTimestamp, f.name)
+			}
+			continue
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid snapshot %s '%s'", f.name, value)
+		}
+		values[i] = v
+	}
+
+	return time.Date(values[0], time.Month(values[1]), values[2], values[3], values[4], values[5], 0, time.UTC), nil
+}
@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "Unix timestamp",
+			metadata: map[string]string{"timestamp": "1729080000"},
+			want:     time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "RFC 3339 timestamp",
+			metadata: map[string]string{"timestamp": "2024-10-16T14:00:00+02:00"},
+			want:     time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Date and time fields",
+			metadata: map[string]string{"year": "2024", "month": "10", "day": "16", "hour": "12", "minute": "05", "second": "30"},
+			want:     time.Date(2024, 10, 16, 12, 5, 30, 0, time.UTC),
+		},
+		{
+			name:     "Date fields only",
+			metadata: map[string]string{"year": "2024", "month": "10", "day": "16"},
+			want:     time.Date(2024, 10, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Missing day",
+			metadata: map[string]string{"year": "2024", "month": "10"},
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid timestamp",
+			metadata: map[string]string{"timestamp": "yesterday"},
+			wantErr:  true,
+		},
+		{
+			name:     "No metadata",
+			metadata: map[string]string{},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Timestamp(tt.metadata)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Timestamp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Timestamp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
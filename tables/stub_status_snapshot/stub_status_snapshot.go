@@ -0,0 +1,35 @@
+package stub_status_snapshot
+
+import (
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+// StubStatusSnapshot is the row struct for a single snapshot of the ngx_http_stub_status_module output
+type StubStatusSnapshot struct {
+	schema.CommonFields
+
+	ActiveConnections *int64 `json:"active_connections,omitempty"`
+	Accepts           *int64 `json:"accepts,omitempty"`
+	Handled           *int64 `json:"handled,omitempty"`
+	Dropped           *int64 `json:"dropped,omitempty"`
+	Requests          *int64 `json:"requests,omitempty"`
+	Reading           *int64 `json:"reading,omitempty"`
+	Writing           *int64 `json:"writing,omitempty"`
+	Waiting           *int64 `json:"waiting,omitempty"`
+}
+
+func (s *StubStatusSnapshot) GetColumnDescriptions() map[string]string {
+	return map[string]string{
+		"active_connections": "The current number of active client connections, including waiting connections",
+		"accepts":            "The total number of accepted client connections since nginx started",
+		"handled":            "The total number of handled connections since nginx started",
+		"dropped":            "The total number of connections dropped because of resource limits, i.e. accepts less handled",
+		"requests":           "The total number of client requests since nginx started",
+		"reading":            "The current number of connections where nginx is reading the request header",
+		"writing":            "The current number of connections where nginx is writing the response back to the client",
+		"waiting":            "The current number of idle client connections waiting for a request",
+
+		// Override table specific tp_* column descriptions
+		"tp_timestamp": "The time the snapshot was taken",
+	}
+}
@@ -0,0 +1,64 @@
+package stub_status_snapshot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/turbot/tailpipe-plugin-sdk/mappers"
+)
+
+// stubStatusRegex matches the stub_status output, e.g.
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+var stubStatusRegex = regexp.MustCompile(`Active connections:\s*(\d+)\s+server accepts handled requests\s+(\d+)\s+(\d+)\s+(\d+)\s+Reading:\s*(\d+)\s+Writing:\s*(\d+)\s+Waiting:\s*(\d+)`)
+
+// StubStatusSnapshotMapper maps the stub_status output to a row
+type StubStatusSnapshotMapper struct {
+}
+
+func (c *StubStatusSnapshotMapper) Identifier() string {
+	return "nginx_stub_status_snapshot_mapper"
+}
+
+func (c *StubStatusSnapshotMapper) Map(_ context.Context, a any, _ ...mappers.MapOption[*StubStatusSnapshot]) (*StubStatusSnapshot, error) {
+	var input string
+	switch v := a.(type) {
+	case string:
+		input = v
+	case []byte:
+		input = string(v)
+	default:
+		return nil, fmt.Errorf("expected string or []byte, got %T", a)
+	}
+
+	match := stubStatusRegex.FindStringSubmatch(input)
+	if match == nil {
+		return nil, fmt.Errorf("invalid stub_status output")
+	}
+
+	values := make([]int64, len(match)-1)
+	for i, m := range match[1:] {
+		v, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stub_status value '%s': %w", m, err)
+		}
+		values[i] = v
+	}
+	dropped := values[1] - values[2]
+
+	return &StubStatusSnapshot{
+		ActiveConnections: &values[0],
+		Accepts:           &values[1],
+		Handled:           &values[2],
+		Dropped:           &dropped,
+		Requests:          &values[3],
+		Reading:           &values[4],
+		Writing:           &values[5],
+		Waiting:           &values[6],
+	}, nil
+}
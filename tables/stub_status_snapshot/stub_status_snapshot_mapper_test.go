@@ -0,0 +1,42 @@
+package stub_status_snapshot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func Test_StubStatusSnapshotMapper_Map(t *testing.T) {
+	input := "Active connections: 291 \nserver accepts handled requests\n 16630948 16630940 31070465 \nReading: 6 Writing: 179 Waiting: 106 \n"
+
+	got, err := (&StubStatusSnapshotMapper{}).Map(context.Background(), []byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &StubStatusSnapshot{
+		ActiveConnections: ptr(291),
+		Accepts:           ptr(16630948),
+		Handled:           ptr(16630940),
+		Dropped:           ptr(8),
+		Requests:          ptr(31070465),
+		Reading:           ptr(6),
+		Writing:           ptr(179),
+		Waiting:           ptr(106),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Map() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_StubStatusSnapshotMapper_Map_Invalid(t *testing.T) {
+	for _, input := range []any{"", "Active connections: 1\n", `{"connections":{}}`, 42} {
+		if _, err := (&StubStatusSnapshotMapper{}).Map(context.Background(), input); err == nil {
+			t.Errorf("expected error for %v", input)
+		}
+	}
+}
+
+func ptr(v int64) *int64 {
+	return &v
+}
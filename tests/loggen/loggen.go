@@ -0,0 +1,294 @@
+// Package loggen generates realistic nginx access and error log lines for tests and benchmarks.
+//
+// Access log lines can be generated for any nginx log_format layout. Generation is deterministic for a seed, so
+// tests can build large fixtures on the fly rather than checking them in.
+package loggen
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"time"
+)
+
+// CombinedLayout is the layout of the nginx combined log format
+const CombinedLayout = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// the number of clients with open keep-alive connections at any time
+const clientPoolSize = 64
+
+// Weighted is a value chosen with a probability proportional to its weight
+type Weighted[T any] struct {
+	Value  T
+	Weight int
+}
+
+// TrafficMix describes the normal (non-attack) requests to generate
+type TrafficMix struct {
+	Methods    []Weighted[string]
+	Statuses   []Weighted[int]
+	Paths      []string
+	Hosts      []string
+	UserAgents []string
+	// the proportion of requests proxied to an upstream server, between 0 and 1
+	UpstreamRate float64
+	// the proportion of clients with an IPv6 address, between 0 and 1
+	IPv6Rate float64
+	// the proportion of requests made on an existing keep-alive connection, between 0 and 1
+	KeepAliveRate float64
+}
+
+// DefaultTrafficMix is a mix of mostly successful requests for pages, static assets and an API
+var DefaultTrafficMix = TrafficMix{
+	Methods: []Weighted[string]{
+		{"GET", 85}, {"POST", 10}, {"HEAD", 2}, {"PUT", 1}, {"DELETE", 1}, {"OPTIONS", 1},
+	},
+	Statuses: []Weighted[int]{
+		{200, 80}, {204, 2}, {301, 3}, {304, 6}, {400, 1}, {403, 1}, {404, 5}, {499, 1}, {500, 1}, {502, 1}, {504, 1},
+	},
+	Paths: []string{
+		"/", "/about", "/contact", "/products", "/products/42", "/search?q=shoes&page=2",
+		"/api/users", "/api/products", "/api/orders/1001", "/static/main.css", "/static/app.js",
+		"/images/logo.png", "/favicon.ico", "/robots.txt",
+	},
+	Hosts: []string{"example.com", "www.example.com", "api.example.com"},
+	UserAgents: []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_6_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		"curl/8.4.0",
+	},
+	UpstreamRate:  0.6,
+	IPv6Rate:      0.1,
+	KeepAliveRate: 0.7,
+}
+
+// Config configures a Generator
+type Config struct {
+	// the seed - generators with the same config generate the same lines
+	Seed uint64
+	// the time of the first request (defaults to 2024-10-16 00:00:00 UTC)
+	Start time.Time
+	// the mean time between requests (defaults to 100ms)
+	Interval time.Duration
+	// the time zone of $time_local, $time_iso8601 and error log times (defaults to UTC)
+	TimeZone *time.Location
+	// the normal requests to generate (defaults to DefaultTrafficMix)
+	Mix *TrafficMix
+	// the proportion of requests which are attacks, between 0 and 1
+	AttackRate float64
+	// the attacks to inject (defaults to DefaultAttacks)
+	Attacks []Attack
+	// the name of the server, for $hostname (defaults to 'web-01')
+	Hostname string
+}
+
+// Request is a generated request, from which log lines are rendered
+type Request struct {
+	Time          time.Time
+	RemoteAddr    string
+	RemotePort    int
+	RemoteUser    string
+	Method        string
+	URI           string
+	Protocol      string
+	Scheme        string
+	Host          string
+	Status        int
+	BodyBytesSent int
+	BytesSent     int
+	RequestLength int
+	Referer       string
+	UserAgent     string
+	RequestTime   time.Duration
+	RequestID     string
+
+	// the connection serial number, and the number of requests made on the connection including this one
+	Connection         int64
+	ConnectionRequests int
+
+	// upstream details, empty if the request was not proxied
+	UpstreamAddr         string
+	UpstreamStatus       int
+	UpstreamConnectTime  time.Duration
+	UpstreamResponseTime time.Duration
+	UpstreamCacheStatus  string
+
+	// the name of the attack, if the request is an attack
+	Attack string
+}
+
+// client is a client with an open keep-alive connection
+type client struct {
+	addr       string
+	port       int
+	userAgent  string
+	connection int64
+	requests   int
+}
+
+// Generator generates requests and renders them as log lines
+type Generator struct {
+	config Config
+	mix    TrafficMix
+	r      *rand.Rand
+
+	now        time.Time
+	connection int64
+	clients    []*client
+}
+
+// New returns a generator for the config
+func New(config Config) (*Generator, error) {
+	if config.AttackRate < 0 || config.AttackRate > 1 {
+		return nil, fmt.Errorf("attack rate must be between 0 and 1, got %v", config.AttackRate)
+	}
+	if config.Start.IsZero() {
+		config.Start = time.Date(2024, 10, 16, 0, 0, 0, 0, time.UTC)
+	}
+	if config.Interval <= 0 {
+		config.Interval = 100 * time.Millisecond
+	}
+	if config.TimeZone == nil {
+		config.TimeZone = time.UTC
+	}
+	if config.Attacks == nil {
+		config.Attacks = DefaultAttacks
+	}
+	if config.Hostname == "" {
+		config.Hostname = "web-01"
+	}
+	mix := DefaultTrafficMix
+	if config.Mix != nil {
+		mix = *config.Mix
+	}
+	if len(mix.Methods) == 0 || len(mix.Statuses) == 0 || len(mix.Paths) == 0 || len(mix.Hosts) == 0 || len(mix.UserAgents) == 0 {
+		return nil, fmt.Errorf("the traffic mix must have methods, statuses, paths, hosts and user agents")
+	}
+
+	return &Generator{
+		config: config,
+		mix:    mix,
+		r:      rand.New(rand.NewPCG(config.Seed, config.Seed)),
+		now:    config.Start,
+	}, nil
+}
+
+// Next generates the next request - requests are in time order
+func (g *Generator) Next() *Request {
+	g.now = g.now.Add(time.Duration(g.r.ExpFloat64() * float64(g.config.Interval)))
+
+	req := &Request{
+		Time:       g.now,
+		RemoteUser: "-",
+		Protocol:   pick(g.r, []string{"HTTP/1.1", "HTTP/1.1", "HTTP/2.0"}),
+		Scheme:     "https",
+		Host:       pick(g.r, g.mix.Hosts),
+		Referer:    "-",
+		RequestID:  fmt.Sprintf("%016x%016x", g.r.Uint64(), g.r.Uint64()),
+	}
+
+	var c *client
+	if len(g.config.Attacks) > 0 && g.r.Float64() < g.config.AttackRate {
+		attack := g.config.Attacks[g.r.IntN(len(g.config.Attacks))]
+		c = g.newClient(attack.randomAddr(g.r), pick(g.r, attack.UserAgents))
+		req.Attack = attack.Name
+		req.Method = pick(g.r, attack.Methods)
+		req.URI = pick(g.r, attack.Paths)
+		req.Status = pick(g.r, attack.Statuses)
+	} else {
+		c = g.client()
+		req.Method = pickWeighted(g.r, g.mix.Methods)
+		req.URI = pick(g.r, g.mix.Paths)
+		req.Status = pickWeighted(g.r, g.mix.Statuses)
+		if g.r.IntN(3) == 0 {
+			req.Referer = "https://" + req.Host + pick(g.r, g.mix.Paths)
+		}
+		if g.r.IntN(20) == 0 {
+			req.RemoteUser = pick(g.r, []string{"alice", "bob", "admin"})
+		}
+	}
+	c.requests++
+	req.RemoteAddr, req.RemotePort, req.UserAgent = c.addr, c.port, c.userAgent
+	req.Connection, req.ConnectionRequests = c.connection, c.requests
+
+	req.RequestLength = 80 + len(req.URI) + len(req.UserAgent) + g.r.IntN(400)
+	if req.Status != 204 && req.Status != 304 && req.Method != "HEAD" {
+		req.BodyBytesSent = 100 + g.r.IntN(15000)
+	}
+	if req.Status == 499 {
+		req.BodyBytesSent = 0
+	}
+	req.BytesSent = req.BodyBytesSent + 150 + g.r.IntN(200)
+	req.RequestTime = time.Duration(g.r.ExpFloat64()*30) * time.Millisecond
+
+	if req.Attack == "" && g.r.Float64() < g.mix.UpstreamRate {
+		req.UpstreamAddr = fmt.Sprintf("10.0.1.%d:8080", 10+g.r.IntN(4))
+		req.UpstreamStatus = req.Status
+		req.UpstreamConnectTime = time.Duration(g.r.IntN(3)) * time.Millisecond
+		req.UpstreamResponseTime = req.RequestTime
+		req.UpstreamCacheStatus = pick(g.r, []string{"MISS", "MISS", "HIT", "BYPASS", "EXPIRED"})
+		if req.Status == 504 {
+			req.UpstreamResponseTime = 60 * time.Second
+			req.RequestTime = req.UpstreamResponseTime
+		}
+	}
+	return req
+}
+
+// client returns a client from the pool, or a new client on a new connection
+func (g *Generator) client() *client {
+	if len(g.clients) > 0 && g.r.Float64() < g.mix.KeepAliveRate {
+		return g.clients[g.r.IntN(len(g.clients))]
+	}
+
+	var addr netip.Addr
+	if g.r.Float64() < g.mix.IPv6Rate {
+		var b [16]byte
+		b[0], b[1], b[2], b[3] = 0x20, 0x01, 0x0d, 0xb8
+		for i := 8; i < 16; i++ {
+			b[i] = byte(g.r.IntN(256))
+		}
+		addr = netip.AddrFrom16(b)
+	} else {
+		addr = netip.AddrFrom4([4]byte{byte(1 + g.r.IntN(223)), byte(g.r.IntN(256)), byte(g.r.IntN(256)), byte(1 + g.r.IntN(254))})
+	}
+	c := g.newClient(addr.String(), pick(g.r, g.mix.UserAgents))
+	if len(g.clients) < clientPoolSize {
+		g.clients = append(g.clients, c)
+	} else {
+		g.clients[g.r.IntN(len(g.clients))] = c
+	}
+	return c
+}
+
+// newClient returns a client on a new connection
+func (g *Generator) newClient(addr, userAgent string) *client {
+	g.connection++
+	return &client{
+		addr:       addr,
+		port:       1024 + g.r.IntN(64511),
+		userAgent:  userAgent,
+		connection: g.connection,
+	}
+}
+
+func pick[T any](r *rand.Rand, values []T) T {
+	return values[r.IntN(len(values))]
+}
+
+func pickWeighted[T any](r *rand.Rand, values []Weighted[T]) T {
+	total := 0
+	for _, v := range values {
+		total += v.Weight
+	}
+	n := r.IntN(max(total, 1))
+	for _, v := range values {
+		if n < v.Weight {
+			return v.Value
+		}
+		n -= v.Weight
+	}
+	return values[len(values)-1].Value
+}
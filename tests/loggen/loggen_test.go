@@ -0,0 +1,167 @@
+package loggen
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/tailpipe-plugin-nginx/sources/log_file"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/access_log"
+	"github.com/turbot/tailpipe-plugin-nginx/tables/error_log"
+	"github.com/turbot/tailpipe-plugin-sdk/schema"
+)
+
+// accessLogLines returns n access log lines written with the combined layout
+func accessLogLines(t *testing.T, config Config, n int) []string {
+	t.Helper()
+	g, err := New(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = g.AccessLine(CombinedLayout, g.Next())
+	}
+	return lines
+}
+
+func Test_Generator_Deterministic(t *testing.T) {
+	config := Config{Seed: 42, AttackRate: 0.2}
+	a := accessLogLines(t, config, 200)
+	if b := accessLogLines(t, config, 200); !slices.Equal(a, b) {
+		t.Error("expected the same seed to generate the same lines")
+	}
+	config.Seed = 43
+	if c := accessLogLines(t, config, 200); slices.Equal(a, c) {
+		t.Error("expected a different seed to generate different lines")
+	}
+}
+
+func Test_Generator_Next(t *testing.T) {
+	g, err := New(Config{Seed: 1, AttackRate: 0.25})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var last time.Time
+	attacks := 0
+	connections := make(map[int64]int)
+	const n = 10000
+	for range n {
+		req := g.Next()
+		if req.Time.Before(last) {
+			t.Fatalf("request at %v is before the previous request at %v", req.Time, last)
+		}
+		last = req.Time
+		if req.Attack != "" {
+			attacks++
+		}
+		connections[req.Connection]++
+		if connections[req.Connection] != req.ConnectionRequests {
+			t.Fatalf("connection %d: got connection_requests %d, want %d", req.Connection, req.ConnectionRequests, connections[req.Connection])
+		}
+	}
+	if rate := float64(attacks) / n; rate < 0.2 || rate > 0.3 {
+		t.Errorf("got attack rate %v, want about 0.25", rate)
+	}
+	if len(connections) == n {
+		t.Error("expected some requests to reuse keep-alive connections")
+	}
+}
+
+func Test_New_Invalid(t *testing.T) {
+	if _, err := New(Config{AttackRate: 1.5}); err == nil {
+		t.Error("expected an error for an attack rate above 1")
+	}
+	if _, err := New(Config{Mix: &TrafficMix{}}); err == nil {
+		t.Error("expected an error for an empty traffic mix")
+	}
+}
+
+func Test_Generator_AccessLine(t *testing.T) {
+	g, err := New(Config{TimeZone: time.FixedZone("", -7*60*60), Hostname: "web-07"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := &Request{
+		Time:       time.Date(2024, 10, 10, 20, 55, 36, 123e6, time.UTC),
+		RemoteAddr: "2001:db8::1",
+		RemoteUser: "-",
+		Method:     "GET",
+		URI:        `/search?q="quoted"`,
+		Protocol:   "HTTP/2.0",
+		Status:     200,
+		Referer:    "-",
+		UserAgent:  "curl/8.4.0",
+		Connection: 7,
+	}
+	layout := `$remote_addr $remote_user [$time_local] $time_iso8601 $msec "$request" $uri $args $status "$http_referer" $upstream_addr $hostname $http2 $connection $http_x_unknown`
+	want := `2001:db8::1 - [10/Oct/2024:13:55:36 -0700] 2024-10-10T13:55:36-07:00 1728593736.123 "GET /search?q=\x22quoted\x22 HTTP/2.0" /search q=\x22quoted\x22 200 "-" - web-07 h2 7 -`
+	if got := g.AccessLine(layout, req); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// Test_Generator_Parse checks that the plugin parses the generated logs, and that access and error log entries
+// for the same request can be correlated
+func Test_Generator_Parse(t *testing.T) {
+	// the error log is written in the local time of the server, so use a time zone other than UTC
+	g, err := New(Config{Seed: 7, AttackRate: 0.1, TimeZone: time.FixedZone("", -7*60*60)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	format := &access_log.AccessLogTableFormat{
+		Name:   "test",
+		Layout: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $server_name $pid $connection $upstream_addr $upstream_response_time $request_time`,
+	}
+	mapper, err := format.GetMapper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var access, errors bytes.Buffer
+	if err := g.WriteLogs(&access, &errors, format.Layout, 2000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requestKeys := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(access.String()), "\n") {
+		row, err := mapper.Map(context.Background(), line)
+		if err != nil {
+			t.Fatalf("error parsing access log line %q: %v", line, err)
+		}
+		method, _ := row.GetSourceValue("request_method")
+		uri, _ := row.GetSourceValue("request_uri")
+		protocol, _ := row.GetSourceValue("server_protocol")
+		serverName, _ := row.GetSourceValue("server_name")
+		pid, _ := row.GetSourceValue("pid")
+		connection, _ := row.GetSourceValue("connection")
+		timeLocal, _ := row.GetSourceValue("time_local")
+		timestamp, err := time.Parse("02/Jan/2006:15:04:05 -0700", timeLocal)
+		if err != nil {
+			t.Fatalf("error parsing access log time %q: %v", timeLocal, err)
+		}
+		requestKeys[access_log.RequestKey(serverName, pid, connection, timestamp.UTC(), method+" "+uri+" "+protocol)] = true
+	}
+
+	errorLines := strings.Split(strings.TrimSpace(errors.String()), "\n")
+	if len(errorLines) < 10 {
+		t.Fatalf("expected error log entries, got %d", len(errorLines))
+	}
+	for _, line := range errorLines {
+		row, err := (&error_log.ErrorLogMapper{}).Map(context.Background(), line)
+		if err != nil {
+			t.Fatalf("error parsing error log line %q: %v", line, err)
+		}
+		row, err = (&error_log.ErrorLogTable{}).EnrichRow(row, *schema.NewSourceEnrichment(map[string]string{log_file.DefaultTimeZoneMetadataKey: "-07:00"}))
+		if err != nil {
+			t.Fatalf("error enriching error log line %q: %v", line, err)
+		}
+		if row.RequestKey == nil || !requestKeys[*row.RequestKey] {
+			t.Errorf("error log line %q does not correlate with an access log line", line)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package loggentest provides helpers for using the loggen log generator in tests and benchmarks.
+//
+// The helpers are kept out of the loggen package, so the loggen command does not link the testing package.
+package loggentest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbot/tailpipe-plugin-nginx/tests/loggen"
+)
+
+// AccessLogLines returns n access log lines written with the layout, failing the test if the config is invalid
+func AccessLogLines(tb testing.TB, config loggen.Config, layout string, n int) []string {
+	tb.Helper()
+	g, err := loggen.New(config)
+	if err != nil {
+		tb.Fatalf("invalid log generator config: %v", err)
+	}
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = g.AccessLine(layout, g.Next())
+	}
+	return lines
+}
+
+// LogFiles writes n requests to 'access.log' and their error log entries to 'error.log' in a temporary directory,
+// returning the paths of the files and failing the test on any error
+func LogFiles(tb testing.TB, config loggen.Config, layout string, n int) (accessLog, errorLog string) {
+	tb.Helper()
+	g, err := loggen.New(config)
+	if err != nil {
+		tb.Fatalf("invalid log generator config: %v", err)
+	}
+
+	dir := tb.TempDir()
+	accessLog, errorLog = filepath.Join(dir, "access.log"), filepath.Join(dir, "error.log")
+	access, err := os.Create(accessLog)
+	if err != nil {
+		tb.Fatalf("error creating access log: %v", err)
+	}
+	defer access.Close()
+	errors, err := os.Create(errorLog)
+	if err != nil {
+		tb.Fatalf("error creating error log: %v", err)
+	}
+	defer errors.Close()
+
+	if err := g.WriteLogs(access, errors, layout, n); err != nil {
+		tb.Fatalf("error writing logs: %v", err)
+	}
+	return accessLog, errorLog
+}
@@ -0,0 +1,210 @@
+package loggen
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the nginx variables in a log_format layout, e.g. '$remote_addr'
+var variableRegex = regexp.MustCompile(`\$\w+`)
+
+// the worker process that handles all generated requests
+const workerPid = 1234
+
+// AccessLine renders a request as an access log line written with the layout, e.g. the nginx combined format
+//
+// variables are written as nginx writes them: empty values are written as '-', and quotes, backslashes and
+// non-printable characters are escaped as '\xHH'
+func (g *Generator) AccessLine(layout string, req *Request) string {
+	return variableRegex.ReplaceAllStringFunc(layout, func(token string) string {
+		value := g.Variable(req, strings.TrimPrefix(token, "$"))
+		if value == "" {
+			return "-"
+		}
+		return escape(value)
+	})
+}
+
+// Variable returns the value of an nginx variable for a request, or an empty string if it has no value
+// variables which are not modelled by the generator have no value
+func (g *Generator) Variable(req *Request, name string) string {
+	path, query, hasQuery := strings.Cut(req.URI, "?")
+	localTime := req.Time.In(g.config.TimeZone)
+	proxied := req.UpstreamAddr != ""
+
+	switch name {
+	case "remote_addr", "realip_remote_addr":
+		return req.RemoteAddr
+	case "binary_remote_addr":
+		addr, err := netip.ParseAddr(req.RemoteAddr)
+		if err != nil {
+			return ""
+		}
+		return string(addr.AsSlice())
+	case "remote_port", "realip_remote_port":
+		return strconv.Itoa(req.RemotePort)
+	case "remote_user":
+		if req.RemoteUser == "-" {
+			return ""
+		}
+		return req.RemoteUser
+	case "time_local":
+		return localTime.Format("02/Jan/2006:15:04:05 -0700")
+	case "time_iso8601":
+		return localTime.Format(time.RFC3339)
+	case "msec":
+		return fmt.Sprintf("%d.%03d", req.Time.Unix(), req.Time.Nanosecond()/int(time.Millisecond))
+	case "request":
+		return req.Method + " " + req.URI + " " + req.Protocol
+	case "request_method":
+		return req.Method
+	case "request_uri":
+		return req.URI
+	case "uri", "document_uri":
+		return path
+	case "args", "query_string":
+		return query
+	case "is_args":
+		if hasQuery {
+			return "?"
+		}
+		return ""
+	case "server_protocol":
+		return req.Protocol
+	case "scheme":
+		return req.Scheme
+	case "https":
+		if req.Scheme == "https" {
+			return "on"
+		}
+		return ""
+	case "host", "http_host", "server_name", "ssl_server_name":
+		return req.Host
+	case "status":
+		return strconv.Itoa(req.Status)
+	case "body_bytes_sent":
+		return strconv.Itoa(req.BodyBytesSent)
+	case "bytes_sent":
+		return strconv.Itoa(req.BytesSent)
+	case "request_length":
+		return strconv.Itoa(req.RequestLength)
+	case "request_time":
+		return seconds(req.RequestTime)
+	case "request_id":
+		return req.RequestID
+	case "request_completion":
+		if req.Status == 499 {
+			return ""
+		}
+		return "OK"
+	case "http_referer":
+		if req.Referer == "-" {
+			return ""
+		}
+		return req.Referer
+	case "http_user_agent":
+		return req.UserAgent
+	case "server_addr":
+		return "10.0.0.5"
+	case "server_port":
+		return "443"
+	case "connection":
+		return strconv.FormatInt(req.Connection, 10)
+	case "connection_requests":
+		return strconv.Itoa(req.ConnectionRequests)
+	case "pipe":
+		return "."
+	case "pid":
+		return strconv.Itoa(workerPid)
+	case "hostname":
+		return g.config.Hostname
+	case "nginx_version":
+		return "1.25.3"
+	case "ssl_protocol":
+		return "TLSv1.3"
+	case "ssl_cipher":
+		return "TLS_AES_128_GCM_SHA256"
+	case "ssl_session_reused":
+		if req.ConnectionRequests > 1 {
+			return "r"
+		}
+		return "."
+	case "http2":
+		if req.Protocol == "HTTP/2.0" {
+			return "h2"
+		}
+		return ""
+	case "upstream_addr":
+		return req.UpstreamAddr
+	case "upstream_status":
+		if proxied {
+			return strconv.Itoa(req.UpstreamStatus)
+		}
+	case "upstream_connect_time":
+		if proxied {
+			return seconds(req.UpstreamConnectTime)
+		}
+	case "upstream_header_time", "upstream_response_time":
+		if proxied {
+			return seconds(req.UpstreamResponseTime)
+		}
+	case "upstream_cache_status":
+		return req.UpstreamCacheStatus
+	}
+	return ""
+}
+
+// ErrorLine renders the error log entry nginx writes for a request, if it writes one
+// the entry has the request's connection and request line, so it can be correlated with the access log
+func (g *Generator) ErrorLine(req *Request) (string, bool) {
+	level := "error"
+	var message string
+	switch {
+	case req.Status == 404:
+		path, _, _ := strings.Cut(req.URI, "?")
+		message = fmt.Sprintf(`open() "/usr/share/nginx/html%s" failed (2: No such file or directory)`, path)
+	case req.Status == 403:
+		message = "access forbidden by rule"
+	case req.Status == 502 && req.UpstreamAddr != "":
+		message = "connect() failed (111: Connection refused) while connecting to upstream"
+	case req.Status == 504 && req.UpstreamAddr != "":
+		message = "upstream timed out (110: Connection timed out) while reading response header from upstream"
+	case req.Status == 499 && req.UpstreamAddr != "":
+		level = "info"
+		message = "epoll_wait() reported that client prematurely closed connection, so upstream connection is closed too while sending request to upstream"
+	default:
+		return "", false
+	}
+
+	line := fmt.Sprintf(`%s [%s] %d#%d: *%d %s, client: %s, server: %s, request: "%s"`,
+		req.Time.In(g.config.TimeZone).Format("2006/01/02 15:04:05"), level, workerPid, workerPid, req.Connection, message,
+		req.RemoteAddr, req.Host, escape(g.Variable(req, "request")))
+	if req.UpstreamAddr != "" {
+		line += fmt.Sprintf(`, upstream: "http://%s%s"`, req.UpstreamAddr, req.URI)
+	}
+	line += fmt.Sprintf(`, host: "%s"`, req.Host)
+	return line, true
+}
+
+// seconds formats a duration as nginx writes times, in seconds with millisecond resolution
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%d.%03d", d/time.Second, (d%time.Second)/time.Millisecond)
+}
+
+// escape escapes a value as nginx does by default
+func escape(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '"' || c == '\\' || c < 0x20 || c >= 0x7f {
+			fmt.Fprintf(&sb, `\x%02X`, c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
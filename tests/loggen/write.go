@@ -0,0 +1,40 @@
+package loggen
+
+import (
+	"bufio"
+	"io"
+)
+
+// WriteLogs generates n requests, writing an access log line written with the layout for each to access, and
+// any error log entries for them to errors
+// errors may be nil if the error log is not needed
+func (g *Generator) WriteLogs(access, errors io.Writer, layout string, n int) error {
+	accessWriter := bufio.NewWriter(access)
+	var errorWriter *bufio.Writer
+	if errors != nil {
+		errorWriter = bufio.NewWriter(errors)
+	}
+
+	for range n {
+		req := g.Next()
+		if _, err := accessWriter.WriteString(g.AccessLine(layout, req) + "\n"); err != nil {
+			return err
+		}
+		if errorWriter == nil {
+			continue
+		}
+		if line, ok := g.ErrorLine(req); ok {
+			if _, err := errorWriter.WriteString(line + "\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := accessWriter.Flush(); err != nil {
+		return err
+	}
+	if errorWriter != nil {
+		return errorWriter.Flush()
+	}
+	return nil
+}